@@ -0,0 +1,21 @@
+module github.com/borkshop/bork
+
+go 1.18
+
+require (
+	github.com/Azure/go-ansiterm v0.0.0-20170929234023-d6e3b3328b78
+	github.com/disintegration/imaging v1.6.2
+	github.com/nsf/termbox-go v0.0.0-20190817171036-93860e161317
+	github.com/ojrac/opensimplex-go v1.0.2
+	github.com/pkg/term v1.1.0
+	github.com/stretchr/testify v1.10.0
+	golang.org/x/sys v0.9.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/mattn/go-runewidth v0.0.9 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/image v0.18.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -56,7 +56,7 @@ var letters [26]string
 
 func init() {
 	for i := range letters {
-		letters[i] = string('a' + i)
+		letters[i] = string(rune('a' + i))
 	}
 }
 
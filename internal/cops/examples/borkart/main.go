@@ -55,7 +55,7 @@ Loop:
 		floor := rectangle.Inset(walls, 3, 1)
 
 		// generate floor tile noise
-		noise := opensimplex.NewWithSeed(0)
+		noise := opensimplex.New(0)
 		for y := walls.Min.Y; y < walls.Max.Y; y++ {
 			for x := walls.Min.X; x < walls.Max.X; x++ {
 				n := noise.Eval2(float64((x+1)/4), float64(y/2))
@@ -59,7 +59,7 @@ func run() (err error) {
 		}
 	}
 
-	page.Fill(image.Rect(0, 0, 1, h), string(0x28ff), display.Colors[15], color.Transparent)
+	page.Fill(image.Rect(0, 0, 1, h), string(rune(0x28ff)), display.Colors[15], color.Transparent)
 	braille.DrawBitmap(page, rb, bmp, image.ZP, image.ZP, display.Colors[7])
 
 	var buf []byte
@@ -8,13 +8,14 @@ import (
 	"unsafe"
 
 	"github.com/pkg/term/termios"
+	"golang.org/x/sys/unix"
 )
 
 // Terminal models a virtual terminal's current and former capabilities, so
 // they can be easily altered and restored.
 type Terminal struct {
 	fd       uintptr
-	old, now syscall.Termios
+	old, now unix.Termios
 }
 
 // New returns a Terminal for the given file descriptor, capable of restoring
@@ -39,7 +40,7 @@ func (t *Terminal) Restore() error {
 // SetNoEcho suppresses input to output echoing, so printable characters typed
 // into the terminal are not implicitly written back out.
 func (t Terminal) SetNoEcho() error {
-	t.now.Lflag &^= syscall.ECHO
+	t.now.Lflag &^= unix.ECHO
 	return t.set()
 }
 
@@ -1,14 +1,12 @@
 package ecs
 
-import (
-	"fmt"
-	"strings"
-)
+import "fmt"
 
 // TypeClause is a logical filter for ComponentTypes.
 type TypeClause interface {
 	CursorOpt
-	test(ComponentType) bool
+	NCursorOpt
+	test(TypeMask) bool
 	// TODO this is a convenient place to start, but to make it perform, we'll
 	// need to compile to a tighter for linear scan and/or to proper planning
 	// wrt available indexing.
@@ -24,62 +22,64 @@ var (
 
 // All return a clause that matches only if all of the type bits are set.  If
 // the type is NoType, the clause never matches (always returns false).
-func (t ComponentType) All() TypeClause {
-	if t == NoType {
+func (t ComponentType) All() TypeClause { return t.Mask().All() }
+
+// Any return a clause that matches only if at least one of the type bits is
+// set. If the type is NoType, the clause always matches (always returns true).
+func (t ComponentType) Any() TypeClause { return t.Mask().Any() }
+
+// NotAll return a clause that matches only if at least one of the type bits is not set.
+func (t ComponentType) NotAll() TypeClause { return t.Mask().NotAll() }
+
+// NotAny return a clause that matches only if none of the type bits are not set.
+func (t ComponentType) NotAny() TypeClause { return t.Mask().NotAny() }
+
+// All is like ComponentType.All, but for a wide type mask.
+func (m TypeMask) All() TypeClause {
+	if m.IsZero() {
 		return FalseClause
 	}
-	return allClause(t)
+	return allClause(m)
 }
 
-// Any return a clause that matches only if at least one of the type bits is
-// set. If the type is NoType, the clause always matches (always returns true).
-func (t ComponentType) Any() TypeClause {
-	if t == NoType {
+// Any is like ComponentType.Any, but for a wide type mask.
+func (m TypeMask) Any() TypeClause {
+	if m.IsZero() {
 		return TrueClause
 	}
-	return anyClause(t)
+	return anyClause(m)
 }
 
-// NotAll return a clause that matches only if at least one of the type bits is not set.
-func (t ComponentType) NotAll() TypeClause { return notAllClause(t) }
+// NotAll is like ComponentType.NotAll, but for a wide type mask.
+func (m TypeMask) NotAll() TypeClause { return notAllClause(m) }
 
-// NotAny return a clause that matches only if none of the type bits are not set.
-func (t ComponentType) NotAny() TypeClause { return notAnyClause(t) }
+// NotAny is like ComponentType.NotAny, but for a wide type mask.
+func (m TypeMask) NotAny() TypeClause { return notAnyClause(m) }
 
 type constClause bool
-type allClause ComponentType
-type anyClause ComponentType
-type notAllClause ComponentType
-type notAnyClause ComponentType
+type allClause TypeMask
+type anyClause TypeMask
+type notAllClause TypeMask
+type notAnyClause TypeMask
 type andClause []TypeClause
 type orClause []TypeClause
 
-func (cc constClause) String() string { return fmt.Sprintf("%v", bool(cc)) }
-func (t allClause) String() string    { return fmt.Sprintf("All(%v)", ComponentType(t)) }
-func (t anyClause) String() string    { return fmt.Sprintf("Any(%v)", ComponentType(t)) }
-func (t notAllClause) String() string { return fmt.Sprintf("NotAll(%v)", ComponentType(t)) }
-func (t notAnyClause) String() string { return fmt.Sprintf("NotAny(%v)", ComponentType(t)) }
-func (tcls andClause) String() string {
-	ss := make([]string, len(tcls))
-	for i := range tcls {
-		ss = append(ss, fmt.Sprint(tcls[i]))
-	}
-	return fmt.Sprintf("And(%s)", strings.Join(ss, " "))
-}
-func (tcls orClause) String() string {
-	ss := make([]string, len(tcls))
-	for i := range tcls {
-		ss = append(ss, fmt.Sprint(tcls[i]))
-	}
-	return fmt.Sprintf("Or(%s)", strings.Join(ss, " "))
-}
+// String methods format clauses as expressions, naming type bits by
+// DefaultTypeNames; see TypeNames.Parse.
+func (cc constClause) String() string { return DefaultTypeNames.FormatClause(cc) }
+func (t allClause) String() string    { return DefaultTypeNames.FormatClause(t) }
+func (t anyClause) String() string    { return DefaultTypeNames.FormatClause(t) }
+func (t notAllClause) String() string { return DefaultTypeNames.FormatClause(t) }
+func (t notAnyClause) String() string { return DefaultTypeNames.FormatClause(t) }
+func (tcls andClause) String() string { return DefaultTypeNames.FormatClause(tcls) }
+func (tcls orClause) String() string  { return DefaultTypeNames.FormatClause(tcls) }
 
-func (cc constClause) test(ComponentType) bool    { return bool(cc) }
-func (t allClause) test(ot ComponentType) bool    { return ot&ComponentType(t) == ComponentType(t) }
-func (t anyClause) test(ot ComponentType) bool    { return ot&ComponentType(t) != 0 }
-func (t notAllClause) test(ot ComponentType) bool { return ot&ComponentType(t) != ComponentType(t) }
-func (t notAnyClause) test(ot ComponentType) bool { return ot&ComponentType(t) == 0 }
-func (tcls andClause) test(ot ComponentType) bool {
+func (cc constClause) test(TypeMask) bool    { return bool(cc) }
+func (t allClause) test(ot TypeMask) bool    { return ot.And(TypeMask(t)) == TypeMask(t) }
+func (t anyClause) test(ot TypeMask) bool    { return !ot.And(TypeMask(t)).IsZero() }
+func (t notAllClause) test(ot TypeMask) bool { return ot.And(TypeMask(t)) != TypeMask(t) }
+func (t notAnyClause) test(ot TypeMask) bool { return ot.And(TypeMask(t)).IsZero() }
+func (tcls andClause) test(ot TypeMask) bool {
 	for i := range tcls {
 		if !tcls[i].test(ot) {
 			return false
@@ -87,7 +87,7 @@ func (tcls andClause) test(ot ComponentType) bool {
 	}
 	return true
 }
-func (tcls orClause) test(ot ComponentType) bool {
+func (tcls orClause) test(ot TypeMask) bool {
 	for i := range tcls {
 		if tcls[i].test(ot) {
 			return true
@@ -141,17 +141,20 @@ func and(a, b TypeClause) TypeClause {
 		return FalseClause
 	}
 
+	// single bit any and all are equivalent, as are notAny and notAll
+	a, b = asAll(a), asAll(b)
+
 	// all(a) && all(b) = all(a|b)
 	if allA, ok := a.(allClause); ok {
 		if allB, ok := b.(allClause); ok {
-			return allClause(allA | allB)
+			return allClause(TypeMask(allA).Or(TypeMask(allB)))
 		}
 	}
 
 	// notAny(a) && notAny(b) = notAny(a|b)
 	if notAnyA, ok := a.(notAnyClause); ok {
 		if notAnyB, ok := b.(notAnyClause); ok {
-			return notAnyClause(notAnyA | notAnyB)
+			return notAnyClause(TypeMask(notAnyA).Or(TypeMask(notAnyB)))
 		}
 	}
 
@@ -161,11 +164,14 @@ func and(a, b TypeClause) TypeClause {
 		if !ok {
 			tclsB = andClause{b}
 		}
+	merge:
 		for _, b := range tclsB {
 			for i := range r {
 				if tcl := and(r[i], b); tcl != nil {
-					r[i] = tcl
-					continue
+					if _, isAnd := tcl.(andClause); !isAnd {
+						r[i] = tcl
+						continue merge
+					}
 				}
 			}
 			r = append(r, b)
@@ -187,17 +193,20 @@ func or(a, b TypeClause) TypeClause {
 		return b
 	}
 
-	// any(a) || any(b) = any(a&b)
+	// single bit any and all are equivalent, as are notAny and notAll
+	a, b = asAny(a), asAny(b)
+
+	// any(a) || any(b) = any(a|b)
 	if anyA, ok := a.(anyClause); ok {
 		if anyB, ok := b.(anyClause); ok {
-			return anyClause(anyA & anyB)
+			return anyClause(TypeMask(anyA).Or(TypeMask(anyB)))
 		}
 	}
 
-	// notAll(a) || notAll(b) = notAll(a&b)
+	// notAll(a) || notAll(b) = notAll(a|b)
 	if notAllA, ok := a.(notAllClause); ok {
 		if notAllB, ok := b.(notAllClause); ok {
-			return notAllClause(notAllA & notAllB)
+			return notAllClause(TypeMask(notAllA).Or(TypeMask(notAllB)))
 		}
 	}
 
@@ -207,11 +216,14 @@ func or(a, b TypeClause) TypeClause {
 		if !ok {
 			tclsB = orClause{b}
 		}
+	merge:
 		for _, b := range tclsB {
 			for i := range r {
 				if tcl := or(r[i], b); tcl != nil {
-					r[i] = tcl
-					continue
+					if _, isOr := tcl.(orClause); !isOr {
+						r[i] = tcl
+						continue merge
+					}
 				}
 			}
 			r = append(r, b)
@@ -222,6 +234,38 @@ func or(a, b TypeClause) TypeClause {
 	return nil
 }
 
+// asAll converts single bit any and notAll clauses to their all and notAny
+// equivalents.
+func asAll(tcl TypeClause) TypeClause {
+	switch val := tcl.(type) {
+	case anyClause:
+		if _, single := singleBit(TypeMask(val)); single {
+			return allClause(val)
+		}
+	case notAllClause:
+		if _, single := singleBit(TypeMask(val)); single {
+			return notAnyClause(val)
+		}
+	}
+	return tcl
+}
+
+// asAny converts single bit all and notAny clauses to their any and notAll
+// equivalents.
+func asAny(tcl TypeClause) TypeClause {
+	switch val := tcl.(type) {
+	case allClause:
+		if _, single := singleBit(TypeMask(val)); single {
+			return anyClause(val)
+		}
+	case notAnyClause:
+		if _, single := singleBit(TypeMask(val)); single {
+			return notAllClause(val)
+		}
+	}
+	return tcl
+}
+
 // Not returns a type clause that matches only the given clause does not match.
 func Not(tcl TypeClause) TypeClause {
 	switch val := tcl.(type) {
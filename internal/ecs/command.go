@@ -0,0 +1,166 @@
+package ecs
+
+// CommandBuffer records entity mutations for later application at a sync point,
+// rather than mutating any Core immediately; this makes it safe to "mutate"
+// while iterating a Core or Relation cursor, since no lifecycle function fires
+// until Apply is called.
+//
+// Commands are applied in the order that they were recorded, so creators and
+// destroyers fire in a deterministic order. A single buffer may hold commands
+// against any number of Cores and Relations.
+//
+// The zero value is an empty buffer ready to use.
+type CommandBuffer struct {
+	cmds    []command
+	ents    []Entity
+	epoch   uint32 // placeholder generation; advances when ents is reset
+	applied bool
+}
+
+type commandOp uint8
+
+const (
+	cmdAdd commandOp = iota
+	cmdDelete
+	cmdSet
+	cmdCreate
+	cmdDestroy
+	cmdInsert
+)
+
+type command struct {
+	op   commandOp
+	ent  Entity
+	t    TypeMask
+	rel  *Relation
+	a, b Entity
+}
+
+// Len returns how many commands are waiting to be applied.
+func (cb *CommandBuffer) Len() int { return len(cb.cmds) }
+
+// AddEntity records the creation of a new entity of the given type in the
+// given Core, returning a placeholder for it. The placeholder may be passed to
+// any other method of this buffer, and resolved to the created entity by
+// Entity after Apply; it is not usable with any Core directly.
+func (cb *CommandBuffer) AddEntity(co *Core, t TypeBits) Entity {
+	cb.reset()
+	ent := cb.placeholder(co)
+	cb.cmds = append(cb.cmds, command{op: cmdCreate, ent: ent, t: t.Mask()})
+	return ent
+}
+
+// Add records the addition of type bits to an entity.
+func (cb *CommandBuffer) Add(ent Entity, t TypeBits) {
+	cb.record(command{op: cmdAdd, ent: ent, t: t.Mask()})
+}
+
+// Delete records the removal of type bits from an entity.
+func (cb *CommandBuffer) Delete(ent Entity, t TypeBits) {
+	cb.record(command{op: cmdDelete, ent: ent, t: t.Mask()})
+}
+
+// SetType records a change to an entity's whole type.
+func (cb *CommandBuffer) SetType(ent Entity, t TypeBits) {
+	cb.record(command{op: cmdSet, ent: ent, t: t.Mask()})
+}
+
+// Destroy records the destruction of an entity.
+func (cb *CommandBuffer) Destroy(ent Entity) {
+	cb.record(command{op: cmdDestroy, ent: ent})
+}
+
+// Insert records the creation of a new relation between a and b, returning a
+// placeholder for the relation entity, just like AddEntity.
+func (cb *CommandBuffer) Insert(rel *Relation, t TypeBits, a, b Entity) Entity {
+	cb.reset()
+	cb.check(a)
+	cb.check(b)
+	ent := cb.placeholder(&rel.Core)
+	cb.cmds = append(cb.cmds, command{op: cmdInsert, ent: ent, t: t.Mask(), rel: rel, a: a, b: b})
+	return ent
+}
+
+// Entity resolves a placeholder returned by AddEntity or Insert into the
+// entity that was created by Apply; any other entity is returned as-is. Returns
+// NilEntity for a placeholder that has not been applied (yet), or whose
+// creation was skipped. Placeholders are only resolvable until the buffer
+// records its next command after Apply; panics if given a placeholder from
+// before then, or from another buffer.
+func (cb *CommandBuffer) Entity(ent Entity) Entity {
+	if ent.co == nil || ent.id >= 0 {
+		return ent
+	}
+	cb.check(ent)
+	if i := int(-ent.id) - 1; i < len(cb.ents) && cb.ents[i].co == ent.co {
+		return cb.ents[i]
+	}
+	return NilEntity
+}
+
+// Apply all recorded commands in order, then clear the buffer. Commands that
+// target an entity destroyed by the time they're applied are skipped, as is
+// any relation insert with a stale or destroyed end.
+//
+// Any commands recorded while applying (e.g. by a creator or destroyer that
+// uses this same buffer) are also applied, after all prior commands.
+func (cb *CommandBuffer) Apply() {
+	for i := 0; i < len(cb.cmds); i++ {
+		cmd := cb.cmds[i]
+		switch cmd.op {
+		case cmdCreate:
+			cb.ents[-cmd.ent.id-1] = cmd.ent.co.AddEntityMask(cmd.t)
+		case cmdInsert:
+			a, b := cb.Entity(cmd.a), cb.Entity(cmd.b)
+			if !cmd.rel.aCore.Valid(a) || !cmd.rel.bCore.Valid(b) {
+				continue
+			}
+			cmd.rel.Upsert(nil, func(uc *UpsertCursor) {
+				cb.ents[-cmd.ent.id-1] = uc.Create(cmd.t.Type(), a, b)
+			})
+			if cmd.t.Wide() {
+				cb.ents[-cmd.ent.id-1].SetMask(cmd.t)
+			}
+		case cmdAdd:
+			cb.Entity(cmd.ent).AddMask(cmd.t)
+		case cmdDelete:
+			cb.Entity(cmd.ent).DeleteMask(cmd.t)
+		case cmdSet:
+			cb.Entity(cmd.ent).SetMask(cmd.t)
+		case cmdDestroy:
+			cb.Entity(cmd.ent).Destroy()
+		}
+	}
+	cb.cmds = cb.cmds[:0]
+	cb.applied = true
+}
+
+func (cb *CommandBuffer) record(cmd command) {
+	cb.reset()
+	cb.check(cmd.ent)
+	cb.cmds = append(cb.cmds, cmd)
+}
+
+func (cb *CommandBuffer) placeholder(co *Core) Entity {
+	ent := Entity{co: co, id: -EntityID(len(cb.ents) + 1), gen: cb.epoch}
+	cb.ents = append(cb.ents, NilEntity)
+	return ent
+}
+
+// check panics if given a placeholder that isn't from the buffer's current
+// epoch; its index may since have been reused by another placeholder.
+func (cb *CommandBuffer) check(ent Entity) {
+	if ent.id < 0 && (ent.gen != cb.epoch || int(-ent.id) > len(cb.ents)) {
+		panic("stale command placeholder")
+	}
+}
+
+// reset forgets any placeholders resolved by the last Apply, once the buffer
+// starts recording again; any still held become stale.
+func (cb *CommandBuffer) reset() {
+	if cb.applied {
+		cb.applied = false
+		cb.ents = cb.ents[:0]
+		cb.epoch++
+	}
+}
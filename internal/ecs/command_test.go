@@ -0,0 +1,81 @@
+package ecs_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/borkshop/bork/internal/ecs"
+)
+
+func TestCommandBuffer(t *testing.T) {
+	s := newStuff()
+	rel := ecs.NewRelation(&s.Core, 0, &s.Core, 0)
+	e1 := s.addData(1)
+	e2 := s.addData(2)
+	e3 := s.addData(3)
+
+	var log []ecs.EntityID
+	s.RegisterCreator(scD2, func(id ecs.EntityID, t ecs.ComponentType) { log = append(log, id) })
+	s.RegisterDestroyer(scD2, func(id ecs.EntityID, t ecs.ComponentType) { log = append(log, -id) })
+
+	// mutate while iterating; nothing happens until Apply
+	var cb ecs.CommandBuffer
+	var p ecs.Entity
+	for it := s.Iter(scData.All()); it.Next(); {
+		switch ent := it.Entity(); ent {
+		case e1:
+			cb.Destroy(ent)
+		case e2:
+			cb.Add(ent, scD2)
+			p = cb.AddEntity(&s.Core, scData|scD2)
+			cb.Insert(rel, srFoo, ent, p)
+		case e3:
+			cb.Insert(rel, srFoo, ent, e1)
+			cb.SetType(p, scData)
+		}
+	}
+	assert.Equal(t, 6, cb.Len())
+	assert.Equal(t, 3, s.Len())
+	assert.Equal(t, 0, rel.Len())
+	assert.Equal(t, ecs.NilEntity, cb.Entity(p))
+	assert.Panics(t, func() { s.Deref(p) }, "placeholders are not entities")
+
+	cb.Apply()
+	assert.Equal(t, 0, cb.Len())
+	assert.False(t, s.Valid(e1))
+	assert.Equal(t, scData|scD2, e2.Type())
+	e4 := cb.Entity(p)
+	assert.True(t, s.Valid(e4))
+	assert.Equal(t, scData, e4.Type())
+	assert.Equal(t, e2, cb.Entity(e2))
+	assert.Equal(t, []ecs.EntityID{e2.ID(), e4.ID(), -e4.ID()}, log, "lifecycle in recorded order")
+
+	// the insert against destroyed e1 was skipped
+	assert.Equal(t, 1, rel.Len())
+	for cur := rel.Select(srFoo.All()); cur.Scan(); {
+		assert.Equal(t, e2, cur.A())
+		assert.Equal(t, e4, cur.B())
+	}
+
+	// recording again forgets placeholders, even once their index is reused
+	cb.Destroy(e4)
+	assert.Panics(t, func() { cb.Entity(p) }, "stale placeholder")
+	p2 := cb.AddEntity(&s.Core, scData)
+	assert.Panics(t, func() { cb.Entity(p) }, "stale placeholder")
+	assert.Panics(t, func() { cb.Add(p, scD2) }, "stale placeholder")
+	assert.Equal(t, ecs.NilEntity, cb.Entity(p2))
+	var other ecs.CommandBuffer
+	assert.Panics(t, func() { other.Destroy(p2) }, "placeholder from another buffer")
+
+	// a System applies its Commands after its procs
+	var sys ecs.System
+	var made ecs.Entity
+	sys.AddProcFunc(func() {
+		made = sys.Commands.AddEntity(&sys.Core, scData)
+		assert.Equal(t, 0, sys.Len())
+	})
+	sys.Process()
+	assert.Equal(t, 1, sys.Len())
+	assert.True(t, sys.Valid(sys.Commands.Entity(made)))
+}
@@ -0,0 +1,141 @@
+package ecs
+
+type remapFunc struct {
+	t TypeMask
+	f func(Remap)
+}
+
+// Remap describes how Core.Compact moved entities around; it is passed to
+// every registered remapper, and returned to the caller of Compact.
+//
+// Compaction preserves the relative order of entities, so a moved entity's new
+// ID is always less than its old ID.
+type Remap struct {
+	co   *Core
+	ids  []EntityID // new ID by old ID-1; 0 if the old ID was unused
+	gens []uint32   // generations by old ID-1, prior to compaction
+	n    int
+}
+
+// Len returns how many entities the Core has after compaction; this is both
+// its new Len() and Cap().
+func (rm Remap) Len() int { return rm.n }
+
+// ID returns the new ID for the given old one; it returns 0 for the zero ID,
+// and for any ID that was unused when the Core was compacted.
+func (rm Remap) ID(old EntityID) EntityID {
+	if old <= 0 || int(old) > len(rm.ids) {
+		return 0
+	}
+	return rm.ids[old-1]
+}
+
+// Entity translates a reference made prior to compaction into one valid
+// after it; it returns NilEntity for foreign or stale references.
+func (rm Remap) Entity(ent Entity) Entity {
+	if ent.co != rm.co || ent.id <= 0 || int(ent.id) > len(rm.ids) {
+		return NilEntity
+	}
+	if rm.gens[ent.id-1] != ent.gen {
+		return NilEntity
+	}
+	return rm.co.Ref(rm.ids[ent.id-1])
+}
+
+// Each calls the given function for every entity that moved, in increasing ID
+// order; since every moved entity's new ID is less than its old one, dense
+// data may be moved in-place by the function.
+func (rm Remap) Each(f func(old, new EntityID)) {
+	for i, id := range rm.ids {
+		if old := EntityID(i + 1); id != 0 && id != old {
+			f(old, id)
+		}
+	}
+}
+
+// RegisterRemapper registers a remapper function. Every allocator MUST have a
+// remapper registered against the same type (or one that contains, or is
+// contained by, the allocator's type), otherwise Compact will panic;
+// remappers may also be registered by anything else that stores entity IDs
+// (e.g. a Relation with foreign entity IDs).
+//
+// Remappers are called after Compact has moved entities around; they must move
+// any associated data from each old ID to its new one, and should release any
+// storage beyond the Remap's Len().
+func (co *Core) RegisterRemapper(t ComponentType, remapper func(Remap)) {
+	co.RegisterRemapperMask(t.Mask(), remapper)
+}
+
+// RegisterRemapperMask is like RegisterRemapper, but registers under a
+// (possibly wide) type mask.
+func (co *Core) RegisterRemapperMask(m TypeMask, remapper func(Remap)) {
+	co.remappers = append(co.remappers, remapFunc{m, remapper})
+}
+
+// Compact defragments the Core's entity space, moving entities into any free
+// IDs so that only IDs 1..Len() remain in use. Every registered remapper is
+// then called, and the Remap is also returned so that the caller may translate
+// any IDs or Entity references that it holds.
+//
+// Any reference to a moved entity is stale after compaction.
+func (co *Core) Compact() Remap {
+	for _, ef := range co.allocators {
+		if !co.hasRemapper(ef.t) {
+			panic("allocator lacks remapper")
+		}
+	}
+
+	rm := Remap{
+		co:   co,
+		ids:  make([]EntityID, len(co.types)),
+		gens: append([]uint32(nil), co.gens...),
+	}
+	for i, t := range co.types {
+		if t.IsZero() {
+			continue
+		}
+		j := rm.n
+		rm.n++
+		rm.ids[i] = EntityID(rm.n)
+		if i == j {
+			continue
+		}
+		// a new generation for the destination stales any reference to either
+		// its prior occupant or the moved entity
+		gen := co.gens[j]
+		if g := co.gens[i]; g > gen {
+			gen = g
+		}
+		co.types[j] = t
+		co.gens[j] = gen + 1
+	}
+
+	// any slots allocated in the future must not alias a stale reference into
+	// the truncated space
+	for _, gen := range co.gens[rm.n:] {
+		if gen >= co.nextGen {
+			co.nextGen = gen + 1
+		}
+	}
+	co.types = co.types[:rm.n]
+	co.gens = co.gens[:rm.n]
+	co.free = co.free[:0]
+	co.freed = make([]bool, rm.n)
+	co.rebuildViews()
+
+	for _, rf := range co.remappers {
+		rf.f(rm)
+	}
+	return rm
+}
+
+// hasRemapper returns true if a remapper is registered for a type that either
+// contains, or is contained by, the given allocator type.
+func (co *Core) hasRemapper(t TypeMask) bool {
+	for _, rf := range co.remappers {
+		if rf.t == t || rf.t.HasAll(t) || t.HasAll(rf.t) {
+			return true
+		}
+	}
+	return false
+}
@@ -5,14 +5,19 @@ import "fmt"
 // Core is the core of an Entity Component System: it manages the entity IDs
 // and types.
 type Core struct {
-	types []ComponentType
-	free  int // TODO: list instead of count
+	types   []TypeMask
+	gens    []uint32
+	nextGen uint32
+	free    []EntityID
+	freed   []bool // whether each ID is on the free list
 
 	allocators, creators, destroyers []entityFunc
+	remappers                        []remapFunc
+	views                            []*View
 }
 
 type entityFunc struct {
-	t ComponentType
+	t TypeMask
 	f func(EntityID, ComponentType)
 }
 
@@ -20,7 +25,8 @@ type entityFunc struct {
 // meaning "null entity".
 type EntityID int
 
-// ComponentType represents the type of an Entity in a Core.
+// ComponentType represents the type of an Entity in a Core; see TypeMask for
+// types that need more than 64 bits.
 type ComponentType uint64
 
 // NoType represents an unused entity; one that has been allocated, but not yet
@@ -44,7 +50,7 @@ func (t ComponentType) ApplyTo(ent Entity) { ent.SetType(t) }
 func (co *Core) Len() int {
 	n := 0
 	for _, t := range co.types {
-		if t != NoType {
+		if !t.IsZero() {
 			n++
 		}
 	}
@@ -60,7 +66,7 @@ func (co *Core) Cap() int {
 // Empty returns true only if there are no active entities.
 func (co *Core) Empty() bool {
 	for _, t := range co.types {
-		if t != NoType {
+		if !t.IsZero() {
 			return false
 		}
 	}
@@ -70,8 +76,8 @@ func (co *Core) Empty() bool {
 // Clear destroys all active entities.
 func (co *Core) Clear() {
 	for i, t := range co.types {
-		if t != NoType {
-			co.SetType(EntityID(i+1), NoType)
+		if !t.IsZero() {
+			co.SetMask(EntityID(i+1), NoMask)
 		}
 	}
 }
@@ -81,14 +87,22 @@ func (co *Core) Clear() {
 //
 // Allocators are called when the Core grows its entity capacity. An allocator
 // must create space in each of its data collections so that the given id has
-// corresponding element(s).
+// corresponding element(s). To support Compact, a remapper must also be
+// registered under the same type, or one that contains or is contained by it;
+// see RegisterRemapper.
 func (co *Core) RegisterAllocator(t ComponentType, allocator func(EntityID, ComponentType)) {
+	co.RegisterAllocatorMask(t.Mask(), allocator)
+}
+
+// RegisterAllocatorMask is like RegisterAllocator, but registers under a
+// (possibly wide) type mask.
+func (co *Core) RegisterAllocatorMask(m TypeMask, allocator func(EntityID, ComponentType)) {
 	for _, ef := range co.allocators {
-		if ef.t.HasAny(t) {
+		if ef.t.HasAny(m) {
 			panic("aspect type conflict")
 		}
 	}
-	co.allocators = append(co.allocators, entityFunc{t, allocator})
+	co.allocators = append(co.allocators, entityFunc{m, allocator})
 }
 
 // RegisterCreator registers a creator function. The Type may overlap any
@@ -101,8 +115,18 @@ func (co *Core) RegisterAllocator(t ComponentType, allocator func(EntityID, Comp
 // Any creators registered against NoType trigger simply at entity creation
 // time; they will be called when an entity transitions from NoType to any
 // arbitrary type. NOTE: this may or may not be proximate to allocation time!
+//
+// Creators are passed only the low 64 bits of the new type; creators
+// registered with RegisterCreatorMask against wide bits should call Core.Mask
+// to get the whole thing.
 func (co *Core) RegisterCreator(t ComponentType, creator func(EntityID, ComponentType)) {
-	co.creators = append(co.creators, entityFunc{t, creator})
+	co.RegisterCreatorMask(t.Mask(), creator)
+}
+
+// RegisterCreatorMask is like RegisterCreator, but registers under a (possibly
+// wide) type mask.
+func (co *Core) RegisterCreatorMask(m TypeMask, creator func(EntityID, ComponentType)) {
+	co.creators = append(co.creators, entityFunc{m, creator})
 }
 
 // RegisterDestroyer registers a destroyer function. The Type may overlap any
@@ -114,6 +138,15 @@ func (co *Core) RegisterCreator(t ComponentType, creator func(EntityID, Componen
 //
 // Any destroyers registered against NoType trigger at entity deletion time;
 // they will be called when an entity transitions to NoType.
+//
+// Like creators, destroyers are passed only the low 64 bits of the new type;
+// call Core.Mask for the rest.
 func (co *Core) RegisterDestroyer(t ComponentType, destroyer func(EntityID, ComponentType)) {
-	co.destroyers = append(co.destroyers, entityFunc{t, destroyer})
+	co.RegisterDestroyerMask(t.Mask(), destroyer)
+}
+
+// RegisterDestroyerMask is like RegisterDestroyer, but registers under a
+// (possibly wide) type mask.
+func (co *Core) RegisterDestroyerMask(m TypeMask, destroyer func(EntityID, ComponentType)) {
+	co.destroyers = append(co.destroyers, entityFunc{m, destroyer})
 }
@@ -26,6 +26,7 @@ func newStuff() *stuff {
 		d2: [][]int{nil},
 	}
 	s.RegisterAllocator(scData, s.allocData)
+	s.RegisterRemapper(scData, s.remapData)
 	s.RegisterCreator(scD2, s.createD2)
 	s.RegisterDestroyer(scD2, s.destroyD2)
 	return s
@@ -47,6 +48,15 @@ func (s *stuff) allocData(id ecs.EntityID, t ecs.ComponentType) {
 	s.d2 = append(s.d2, nil)
 }
 
+func (s *stuff) remapData(rm ecs.Remap) {
+	rm.Each(func(old, new ecs.EntityID) {
+		s.d1[new] = s.d1[old]
+		s.d2[new] = s.d2[old]
+	})
+	s.d1 = s.d1[:rm.Len()+1]
+	s.d2 = s.d2[:rm.Len()+1]
+}
+
 func (s *stuff) createD2(id ecs.EntityID, t ecs.ComponentType) {
 	if s.d2[id] == nil {
 		s.d2[id] = make([]int, 0, 5)
@@ -163,3 +173,169 @@ func TestIter_two(t *testing.T) {
 	assert.Equal(t, ecs.EntityID(0), it.ID())
 	assert.Equal(t, ecs.NoType, it.Type())
 }
+
+func TestEntity_stale(t *testing.T) {
+	s := newStuff()
+
+	e1 := s.AddEntity(scData)
+	assert.True(t, s.Valid(e1))
+	assert.Equal(t, e1, s.Ref(e1.ID()))
+
+	e1.Destroy()
+	assert.False(t, s.Valid(e1))
+	assert.Equal(t, ecs.NoType, e1.Type())
+	assert.Panics(t, func() { s.Deref(e1) })
+
+	e2 := s.AddEntity(scData | scD2)
+	assert.Equal(t, e1.ID(), e2.ID())
+	assert.NotEqual(t, e1, e2)
+	assert.True(t, s.Valid(e2))
+	assert.False(t, s.Valid(e1))
+	assert.Equal(t, e2, s.Ref(e2.ID()))
+
+	// stale references must not affect the new entity
+	e1.Delete(scD2)
+	assert.Equal(t, scData|scD2, e2.Type())
+	e1.Destroy()
+	assert.True(t, s.Valid(e2))
+	assert.Equal(t, ecs.EntityID(1), s.Deref(e2))
+
+	assert.False(t, s.Valid(ecs.NilEntity))
+	assert.False(t, newStuff().Valid(e2))
+}
+
+func TestCore_Compact(t *testing.T) {
+	a, b := newStuff(), newStuff()
+	var as, bs []ecs.Entity
+	for i := 1; i <= 5; i++ {
+		as = append(as, a.addData(i))
+		bs = append(bs, b.addData(10*i, i))
+	}
+	rel := ecs.NewRelation(&a.Core, 0, &b.Core, 0)
+	rel.Upsert(nil, func(uc *ecs.UpsertCursor) {
+		for i := range as {
+			uc.Create(srFoo, as[i], bs[len(bs)-1-i])
+		}
+	})
+
+	as[1].Destroy()
+	as[3].Destroy()
+	bs[0].Destroy()
+	assert.Equal(t, 3, a.Len())
+	assert.Equal(t, 5, a.Cap())
+	assert.Equal(t, 2, rel.Len())
+
+	rm := a.Compact()
+	assert.Equal(t, 3, rm.Len())
+	assert.Equal(t, 3, a.Cap())
+	assert.Equal(t, []int{0, 1, 3, 5}, a.d1)
+	assert.Equal(t, []ecs.EntityID{1, 0, 2, 0, 3}, []ecs.EntityID{
+		rm.ID(1), rm.ID(2), rm.ID(3), rm.ID(4), rm.ID(5),
+	})
+	assert.True(t, a.Valid(as[0]), "unmoved entities stay valid")
+	assert.False(t, a.Valid(as[2]), "moved entities are stale")
+	assert.Equal(t, a.Ref(2), rm.Entity(as[2]))
+	assert.Equal(t, ecs.NilEntity, rm.Entity(as[1]))
+
+	// the relation followed the A-side move
+	type ab struct{ a, b int }
+	var got []ab
+	for cur := rel.Select(srFoo.All()); cur.Scan(); {
+		got = append(got, ab{a.d1[cur.A().ID()], b.d1[cur.B().ID()]})
+	}
+	assert.Equal(t, []ab{{1, 50}, {3, 30}}, got)
+
+	// compacting the relation moves its rows
+	b.Compact()
+	rel.Compact()
+	assert.Equal(t, 2, rel.Cap())
+	got = got[:0]
+	for cur := rel.Select(srFoo.All()); cur.Scan(); {
+		got = append(got, ab{a.d1[cur.A().ID()], b.d1[cur.B().ID()]})
+	}
+	assert.Equal(t, []ab{{1, 50}, {3, 30}}, got)
+
+	// no free slots remain, and fresh slots don't alias stale references
+	e := a.AddEntity(scData)
+	assert.Equal(t, ecs.EntityID(4), e.ID())
+	assert.False(t, a.Valid(as[3]))
+	assert.False(t, a.Valid(as[4]))
+
+	// allocators need a remapper of a containing, or contained, type
+	var co ecs.Core
+	co.RegisterAllocator(scData|scD2, func(ecs.EntityID, ecs.ComponentType) {})
+	co.RegisterRemapper(scD2<<1, func(ecs.Remap) {})
+	assert.PanicsWithValue(t, "allocator lacks remapper", func() { co.Compact() })
+	co.RegisterRemapper(scData, func(ecs.Remap) {})
+	assert.NotPanics(t, func() { co.Compact() })
+
+	// a revived and re-destroyed entity is reused just once
+	e = co.AddEntity(scData)
+	e.Destroy()
+	co.SetType(e.ID(), scData)
+	co.SetType(e.ID(), ecs.NoType)
+	assert.Equal(t, e.ID(), co.AddEntity(scData).ID())
+	assert.NotEqual(t, e.ID(), co.AddEntity(scData).ID())
+}
+
+func TestTypeMask(t *testing.T) {
+	var (
+		wide1 = ecs.TypeBit(64)
+		wide2 = ecs.TypeBit(200)
+	)
+	assert.Equal(t, scD2.Mask(), ecs.TypeBit(1))
+	assert.Equal(t, "00000000000000010000000000000001", wide1.Or(scData.Mask()).String())
+	assert.Equal(t, "0000000000000002", scD2.Mask().String())
+	assert.Panics(t, func() { ecs.TypeBit(ecs.MaxTypeBits) })
+
+	s := newStuff()
+	var created, destroyed []ecs.EntityID
+	s.RegisterCreatorMask(wide1, func(id ecs.EntityID, _ ecs.ComponentType) {
+		created = append(created, id)
+	})
+	s.RegisterDestroyerMask(wide1, func(id ecs.EntityID, _ ecs.ComponentType) {
+		destroyed = append(destroyed, id)
+	})
+
+	e1 := s.AddEntity(scData)
+	e2 := s.AddEntityMask(scData.Mask().Or(wide1))
+	e3 := s.AddEntityMask(wide1.Or(wide2))
+	e1.AddMask(wide2)
+	assert.Equal(t, []ecs.EntityID{2, 3}, created)
+	assert.Equal(t, scData, e2.Type())
+	assert.True(t, e2.Mask().Wide())
+	assert.Equal(t, ecs.NoType, e3.Type())
+	assert.True(t, s.Valid(e3), "wide-only entities are live")
+
+	collect := func(tcls ...ecs.TypeClause) (ids []ecs.EntityID) {
+		for it := s.Iter(tcls...); it.Next(); {
+			ids = append(ids, it.ID())
+		}
+		return ids
+	}
+	assert.Equal(t, []ecs.EntityID{2, 3}, collect(wide1.All()))
+	assert.Equal(t, []ecs.EntityID{1, 3}, collect(wide2.All()))
+	assert.Equal(t, []ecs.EntityID{3}, collect(wide1.All(), scData.NotAny()))
+	assert.Equal(t, []ecs.EntityID{1, 2, 3}, collect(ecs.Or(wide1.Any(), wide2.Any())))
+	assert.Equal(t, []ecs.EntityID{1}, collect(ecs.Not(wide1.Any()), wide2.All()))
+
+	e2.DeleteMask(wide1)
+	e3.Destroy()
+	assert.Equal(t, []ecs.EntityID{2, 3}, destroyed)
+	assert.Equal(t, scData.Mask(), e2.Mask())
+}
+
+func TestTypeClause_Or(t *testing.T) {
+	s := newStuff()
+	s.AddEntity(scData)
+	s.AddEntity(scD2)
+	s.AddEntity(scData | scD2)
+	collect := func(tcl ecs.TypeClause) (ids []ecs.EntityID) {
+		for it := s.Iter(tcl); it.Next(); {
+			ids = append(ids, it.ID())
+		}
+		return ids
+	}
+	assert.Equal(t, []ecs.EntityID{1, 2, 3}, collect(ecs.Or(scData.Any(), scD2.Any())))
+	assert.Equal(t, []ecs.EntityID{1, 2}, collect(ecs.Or(scData.NotAll(), scD2.NotAll())))
+}
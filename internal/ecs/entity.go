@@ -2,10 +2,14 @@ package ecs
 
 import "fmt"
 
-// Entity is a reference to an entity in a Core
+// Entity is a reference to an entity in a Core; it carries the generation of
+// its ID at the time the reference was made, so that references to a
+// since-destroyed entity become stale, rather than aliasing whatever entity
+// later re-uses the ID.
 type Entity struct {
-	co *Core
-	id EntityID
+	co  *Core
+	id  EntityID
+	gen uint32
 }
 
 // NilEntity is the zero of Entity, representing "no entity, in no Core".
@@ -15,21 +19,33 @@ func (ent Entity) String() string {
 	if ent.co == nil {
 		return fmt.Sprintf("Nil<>[%v]", ent.id)
 	}
-	if ent.co == nil {
+	if ent.id == 0 {
 		return fmt.Sprintf("%p<>[%v]", ent.co, ent.id)
 	}
-	return fmt.Sprintf("%p<%v>[%v]",
+	return fmt.Sprintf("%p<%v>[%v.%v]",
 		ent.co,
-		ent.co.types[ent.id-1],
+		ent.Mask(),
 		ent.id,
+		ent.gen,
 	)
 }
 
+// live returns true only if the reference is non-nil and not stale.
+func (ent Entity) live() bool {
+	return ent.co != nil && ent.id > 0 &&
+		int(ent.id) <= len(ent.co.gens) &&
+		ent.co.gens[ent.id-1] == ent.gen
+}
+
 // Type returns the type of the referenced entity, or NoType if the reference
-// is empty.
-func (ent Entity) Type() ComponentType {
-	if ent.co == nil || ent.id == 0 {
-		return NoType
+// is empty or stale; see Mask for any wide type bits.
+func (ent Entity) Type() ComponentType { return ent.Mask().Type() }
+
+// Mask returns the whole type mask of the referenced entity, or NoMask if the
+// reference is empty or stale.
+func (ent Entity) Mask() TypeMask {
+	if !ent.live() {
+		return NoMask
 	}
 	return ent.co.types[ent.id-1]
 }
@@ -45,9 +61,13 @@ func (ent Entity) ID() EntityID {
 }
 
 // Deref unpacks an Entity reference, returning its ID; it panics if the Core
-// doesn't own the Entity.
+// doesn't own the Entity, or if the reference is stale (its entity has since
+// been destroyed).
 func (co *Core) Deref(e Entity) EntityID {
 	if e.co == co {
+		if !e.live() {
+			panic("stale entity")
+		}
 		return e.id
 	} else if e.co == nil {
 		panic("nil entity")
@@ -56,6 +76,13 @@ func (co *Core) Deref(e Entity) EntityID {
 	}
 }
 
+// Valid returns true only if the given Entity refers to a live entity within
+// the Core; it returns false for NilEntity, foreign entities, and stale
+// references to since-destroyed entities (even if their ID has been re-used).
+func (co *Core) Valid(e Entity) bool {
+	return e.co == co && e.live() && !co.types[e.id-1].IsZero()
+}
+
 // Ref returns an Entity reference to the given ID; it is valid to return a
 // reference to the zero entity, to represent "no entity, in this Core" (e.g.
 // will Deref() to 0 EntityID).
@@ -63,7 +90,7 @@ func (co *Core) Ref(id EntityID) Entity {
 	if id == 0 {
 		return NilEntity
 	}
-	return Entity{co, id}
+	return Entity{co, id, co.gens[id-1]}
 }
 
 // AddEntity adds an entity to a core, returning an Entity reference; it MAY
@@ -71,104 +98,138 @@ func (co *Core) Ref(id EntityID) Entity {
 // NoType). MAY invokes all allocators to make space for more entities (will do
 // so if Cap() == Len()).
 func (co *Core) AddEntity(nt ComponentType) Entity {
-	ent := Entity{co, co.allocate()}
-	co.SetType(ent.id, nt)
+	return co.AddEntityMask(nt.Mask())
+}
+
+// AddEntityMask is like AddEntity, but takes a wide type mask.
+func (co *Core) AddEntityMask(nt TypeMask) Entity {
+	ent := co.Ref(co.allocate())
+	co.SetMask(ent.id, nt)
 	return ent
 }
 
 // Add sets bits in the entity's type, calling any creators that are newly
-// satisfied by the new type.
-func (ent Entity) Add(t ComponentType) {
-	if ent.co != nil && ent.id > 0 {
+// satisfied by the new type; it does nothing if the reference is stale.
+func (ent Entity) Add(t ComponentType) { ent.AddMask(t.Mask()) }
+
+// AddMask is like Add, but takes a wide type mask.
+func (ent Entity) AddMask(m TypeMask) {
+	if ent.live() {
 		old := ent.co.types[ent.id-1]
-		ent.co.SetType(ent.id, old|t)
+		ent.co.SetMask(ent.id, old.Or(m))
 	}
 }
 
 // Delete clears bits in the entity's type, calling any destroyers that are no
-// longer satisfied by the new type (which may be NoType).
-func (ent Entity) Delete(t ComponentType) {
-	if ent.co != nil && ent.id > 0 {
+// longer satisfied by the new type (which may be NoType); it does nothing if
+// the reference is stale.
+func (ent Entity) Delete(t ComponentType) { ent.DeleteMask(t.Mask()) }
+
+// DeleteMask is like Delete, but takes a wide type mask.
+func (ent Entity) DeleteMask(m TypeMask) {
+	if ent.live() {
 		old := ent.co.types[ent.id-1]
-		ent.co.SetType(ent.id, old & ^t)
+		ent.co.SetMask(ent.id, old.AndNot(m))
 	}
 }
 
 // Destroy sets the entity's type to NoType, invoking any destroyers that match
-// the prior type.`
+// the prior type; it does nothing if the reference is stale.
 func (ent Entity) Destroy() {
-	if ent.co != nil && ent.id > 0 {
-		ent.co.SetType(ent.id, NoType)
+	if ent.live() {
+		ent.co.SetMask(ent.id, NoMask)
 	}
 }
 
-// SetType sets the entity's type; may invoke creators and destroyers as
-// appropriate.
-func (ent Entity) SetType(t ComponentType) {
-	if ent.co != nil && ent.id > 0 {
-		ent.co.SetType(ent.id, t)
+// SetType sets the entity's type, clearing any wide type bits; may invoke
+// creators and destroyers as appropriate; it does nothing if the reference is
+// stale.
+func (ent Entity) SetType(t ComponentType) { ent.SetMask(t.Mask()) }
+
+// SetMask is like SetType, but takes a wide type mask.
+func (ent Entity) SetMask(m TypeMask) {
+	if ent.live() {
+		ent.co.SetMask(ent.id, m)
 	}
 }
 
 func (co *Core) allocate() EntityID {
-	if co.free > 0 {
-		for i := 0; i < len(co.types); i++ {
-			if co.types[i] == NoType {
-				co.free--
-				return EntityID(i + 1)
-			}
+	for i := len(co.free) - 1; i >= 0; i-- {
+		id := co.free[i]
+		co.free = co.free[:i]
+		co.freed[id-1] = false
+		// skip any that have since been revived by a direct SetType
+		if co.types[id-1].IsZero() {
+			return id
 		}
 	}
 	id := EntityID(len(co.types) + 1)
-	co.types = append(co.types, NoType)
+	co.types = append(co.types, NoMask)
+	co.freed = append(co.freed, false)
+	co.gens = append(co.gens, co.nextGen)
 	for _, ef := range co.allocators {
 		ef.f(id, NoType)
 	}
 	return id
 }
 
-// Type returns the entity's type.
-func (co *Core) Type(id EntityID) ComponentType { return co.types[id-1] }
+// Type returns the entity's type; see Mask for any wide type bits.
+func (co *Core) Type(id EntityID) ComponentType { return co.types[id-1].Type() }
+
+// Mask returns the entity's whole type mask.
+func (co *Core) Mask(id EntityID) TypeMask { return co.types[id-1] }
 
-// SetType changes an entity's type, calling any relevant lifecycle functions.
-func (co *Core) SetType(id EntityID, new ComponentType) {
+// SetType changes an entity's type, clearing any wide type bits, calling any
+// relevant lifecycle functions.
+func (co *Core) SetType(id EntityID, new ComponentType) { co.SetMask(id, new.Mask()) }
+
+// SetMask changes an entity's whole type mask, calling any relevant lifecycle
+// functions. Destroying an entity (setting its type to NoType) advances the
+// generation of its ID, staling any outstanding references to it.
+func (co *Core) SetMask(id EntityID, new TypeMask) {
 	i := id - 1
 	old := co.types[i]
 	if old == new {
 		return
 	}
 	co.types[i] = new
-	if old == NoType {
+	if old.IsZero() {
 		for _, ef := range co.creators {
-			if ef.t == NoType {
-				ef.f(id, new)
+			if ef.t.IsZero() {
+				ef.f(id, new.Type())
 				new = co.types[i]
 			}
 		}
 	}
-	if new & ^old != 0 {
+	if !new.AndNot(old).IsZero() {
 		for _, ef := range co.creators {
 			if new.HasAll(ef.t) && !old.HasAll(ef.t) {
-				ef.f(id, new)
+				ef.f(id, new.Type())
 				new = co.types[i]
 			}
 		}
 	}
-	if old & ^new != 0 {
+	if !old.AndNot(new).IsZero() {
 		for _, ef := range co.destroyers {
 			if old.HasAll(ef.t) && !new.HasAll(ef.t) {
-				ef.f(id, new)
+				ef.f(id, new.Type())
 				new = co.types[i]
 			}
 		}
 	}
-	if new == NoType {
+	if new.IsZero() {
 		for _, ef := range co.destroyers {
-			if ef.t == NoType {
-				ef.f(id, new)
+			if ef.t.IsZero() {
+				ef.f(id, new.Type())
 				new = co.types[i]
 			}
 		}
-		co.free++
+		co.gens[i]++
+		// an entity revived by a direct SetType may still be on the free list
+		if !co.freed[i] {
+			co.freed[i] = true
+			co.free = append(co.free, id)
+		}
 	}
+	co.updateViews(id)
 }
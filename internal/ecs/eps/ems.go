@@ -1,6 +1,7 @@
 package eps
 
 import (
+	"encoding/json"
 	"image"
 
 	"github.com/borkshop/bork/internal/ecs"
@@ -34,8 +35,8 @@ type Moves struct {
 	collMask ecs.ComponentType
 
 	ecs.Relation
-	dir []image.Point
-	mag []int
+	dir ecs.RelationColumn[image.Point]
+	mag ecs.RelationColumn[int]
 }
 
 const (
@@ -60,21 +61,50 @@ func (mov *Moves) Init(eps *EPS, collMask ecs.ComponentType) {
 	mov.eps = eps
 	mov.collMask = collMask
 
-	mov.Relation.Init(mov.eps.core, 0, mov.eps.core, 0)
-	mov.dir = []image.Point{image.ZP}
-	mov.mag = []int{0}
-	mov.Core.RegisterAllocator(movDir|movMag, mov.alloc)
-	mov.Core.RegisterDestroyer(movDir, mov.destroyDir)
-	mov.Core.RegisterDestroyer(movMag, mov.destroyMag)
+	mov.Relation.Init(mov.eps.core, ecs.RelationIndexed, mov.eps.core, ecs.RelationIndexed)
+	mov.Relation.Constrain(movRelPending, ecs.RelationUnique, 0)
+	mov.dir.Init(&mov.Relation, movDir)
+	mov.mag.Init(&mov.Relation, movMag)
 }
 
-func (mov *Moves) alloc(id ecs.EntityID, _ ecs.ComponentType) {
-	mov.dir = append(mov.dir, image.ZP)
-	mov.mag = append(mov.mag, 0)
+type movesSnapshot struct {
+	Relation json.RawMessage `json:"relation"`
+	Dir      json.RawMessage `json:"dir"`
+	Mag      json.RawMessage `json:"mag"`
 }
 
-func (mov *Moves) destroyDir(id ecs.EntityID, _ ecs.ComponentType) { mov.dir[id] = image.ZP }
-func (mov *Moves) destroyMag(id ecs.EntityID, _ ecs.ComponentType) { mov.mag[id] = 0 }
+// SaveSnapshot saves all pending moves and collisions; the EPS and its Core
+// must be saved separately.
+func (mov *Moves) SaveSnapshot() ([]byte, error) {
+	var ms movesSnapshot
+	var err error
+	if ms.Relation, err = mov.Relation.SaveSnapshot(); err != nil {
+		return nil, err
+	}
+	if ms.Dir, err = mov.dir.SaveSnapshot(); err != nil {
+		return nil, err
+	}
+	if ms.Mag, err = mov.mag.SaveSnapshot(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(ms)
+}
+
+// LoadSnapshot restores pending moves and collisions into an empty Moves; the
+// EPS Core must already have been loaded.
+func (mov *Moves) LoadSnapshot(data []byte) error {
+	var ms movesSnapshot
+	if err := json.Unmarshal(data, &ms); err != nil {
+		return err
+	}
+	if err := mov.Relation.LoadSnapshot(ms.Relation); err != nil {
+		return err
+	}
+	if err := mov.dir.LoadSnapshot(ms.Dir); err != nil {
+		return err
+	}
+	return mov.mag.LoadSnapshot(ms.Mag)
+}
 
 func (mov *Moves) pendingCur(ent ecs.Entity) ecs.Cursor {
 	return mov.Select(movRelPending.All(),
@@ -84,45 +114,38 @@ func (mov *Moves) pendingCur(ent ecs.Entity) ecs.Cursor {
 // Mag returns any magnitude associated with the given move relation; 0 means
 // no magnitude defined.
 func (mov *Moves) Mag(move ecs.Entity) int {
-	if move.Type().HasAll(movMag) {
-		return mov.mag[move.ID()]
-	}
-	return 0
+	mag, _ := mov.mag.Get(move)
+	return mag
 }
 
 // Dir returns any direction associated with the given move relation; the bool
 // return is true only if the move has a defined direction.
 func (mov *Moves) Dir(move ecs.Entity) (image.Point, bool) {
-	if move.Type().HasAll(movDir) {
-		return mov.dir[move.ID()], true
-	}
-	return image.ZP, false
+	return mov.dir.Get(move)
 }
 
 // SetMag sets the magnitude associated with the given move relation; 0 removes
 // the magnitude component (and destroys the move if it is pending).
 func (mov *Moves) SetMag(move ecs.Entity, mag int) {
 	if mag == 0 {
-		move.Delete(movMag)
+		mov.mag.Delete(move)
 		if move.Type().HasAll(movRelPending) {
 			move.Destroy()
 		}
 	} else {
-		move.Add(movMag)
-		mov.mag[move.ID()] = mag
+		mov.mag.Set(move, mag)
 	}
 }
 
 // SetDir sets the direction associated with the given move relation.
 func (mov *Moves) SetDir(move ecs.Entity, dir image.Point) {
-	move.Add(movDir)
-	mov.dir[move.ID()] = dir
+	mov.dir.Set(move, dir)
 }
 
 // DeleteDir deletes any direction associated with the given move relation,
 // destroying it if it's now reduced to a magnitude-less pending move.
 func (mov *Moves) DeleteDir(move ecs.Entity) {
-	move.Delete(movDir)
+	mov.dir.Delete(move)
 	if t := move.Type(); t.HasAll(movRelPending) && !t.HasAny(movMag) {
 		move.Destroy()
 	}
@@ -141,42 +164,30 @@ func (mov *Moves) GetPendingMove(ent ecs.Entity) ecs.Entity {
 // entity, overwriting the direction. Ensures that at most one pending move is
 // definded for the given entity.
 func (mov *Moves) AddPendingMove(ent ecs.Entity, dir image.Point, mag, maxMag int) ecs.Entity {
-	// TODO better support upsert reduction
-	accum := ecs.NilEntity
-	mov.Upsert(mov.pendingCur(ent), func(uc *ecs.UpsertCursor) {
-		if move := uc.R(); move.Type().HasAll(movMag) {
-			mag += mov.mag[move.ID()]
-			if maxMag > 0 && mag > maxMag {
-				mag = maxMag
-			}
-		}
-		if accum == ecs.NilEntity {
-			accum = uc.Emit(movRelPending|movDir, ent, ent)
-			mov.dir[accum.ID()] = dir
+	if n := mov.Mag(mov.GetPendingMove(ent)); n > 0 {
+		mag += n
+		if maxMag > 0 && mag > maxMag {
+			mag = maxMag
 		}
-		mov.SetMag(accum, mag)
-	})
-	return accum
+	}
+	move := mov.SetPendingMove(ent, dir, 0)
+	mov.SetMag(move, mag)
+	return move
 }
 
 // SetPendingMove sets both magnitude and direction on an existing or new
 // pending move for the given entity. Ensures that at most one pending move is
 // defined for the given entity.
 func (mov *Moves) SetPendingMove(ent ecs.Entity, dir image.Point, mag int) ecs.Entity {
-	// TODO better support upsert reduction
-	accum := ecs.NilEntity
-	mov.Upsert(mov.pendingCur(ent), func(uc *ecs.UpsertCursor) {
-		if accum != ecs.NilEntity {
-			return
-		}
-		accum = uc.Emit(movRelPending|movDir, ent, ent)
-		mov.dir[accum.ID()] = dir
-		if mag > 0 {
-			accum.Add(movMag)
-			mov.mag[accum.ID()] = mag
-		}
+	var move ecs.Entity
+	mov.Upsert(nil, func(uc *ecs.UpsertCursor) {
+		move = uc.Create(movRelPending|movDir, ent, ent)
 	})
-	return accum
+	mov.dir.Set(move, dir)
+	if mag > 0 {
+		mov.mag.Set(move, mag)
+	}
+	return move
 }
 
 // Process applies pending moves, generating any consequesnt collisons; any
@@ -193,7 +204,8 @@ func (mov *Moves) processPendingMove(uc *ecs.UpsertCursor) {
 		return
 	}
 
-	dir, mag := mov.dir[move.ID()], mov.mag[move.ID()]
+	dir, _ := mov.dir.Get(move)
+	mag, _ := mov.mag.Get(move)
 	limit := mag
 	if mov.PreCheck != nil {
 		dir, mag, limit = mov.PreCheck(uc, dir, mag)
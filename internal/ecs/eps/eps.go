@@ -2,6 +2,7 @@ package eps
 
 import (
 	"encoding/json"
+	"fmt"
 	"image"
 	"log"
 	"math"
@@ -39,6 +40,7 @@ func (eps *EPS) Init(core *ecs.Core, t ecs.ComponentType) {
 	eps.core = core
 	eps.t = t
 	eps.core.RegisterAllocator(eps.t, eps.alloc)
+	eps.core.RegisterRemapper(eps.t, eps.remap)
 	eps.core.RegisterCreator(eps.t, eps.create)
 	eps.core.RegisterDestroyer(eps.t, eps.destroy)
 	// TODO allow user to pass or change bounds
@@ -68,12 +70,12 @@ func (eps *EPS) Bounds() (box image.Rectangle) {
 }
 
 // Get the position of an entity; the bool argument is true only if
-// the entity actually has a position.
+// the entity actually has a position; stale entities have no position.
 func (eps *EPS) Get(ent ecs.Entity) (image.Point, bool) {
-	if ent == ecs.NilEntity {
+	if ent == ecs.NilEntity || !eps.core.Valid(ent) {
 		return image.ZP, false
 	}
-	id := eps.core.Deref(ent)
+	id := ent.ID()
 	return eps.pt[id-1], eps.ix.flg[id-1]&epsDef != 0
 }
 
@@ -92,6 +94,45 @@ func (eps *EPS) Set(ent ecs.Entity, pt image.Point) {
 	}
 }
 
+type epsSnapshot struct {
+	ID    ecs.EntityID `json:"id"`
+	Point image.Point  `json:"point"`
+}
+
+// SaveSnapshot saves the position of every positioned entity; the Core must be
+// saved separately.
+func (eps *EPS) SaveSnapshot() ([]byte, error) {
+	var data []epsSnapshot
+	for i, flg := range eps.ix.flg {
+		if flg&epsDef != 0 {
+			data = append(data, epsSnapshot{ecs.EntityID(i + 1), eps.pt[i]})
+		}
+	}
+	return json.Marshal(data)
+}
+
+// LoadSnapshot restores entity positions; the Core must already have been
+// loaded, and must not have had any positions set since.
+func (eps *EPS) LoadSnapshot(d []byte) error {
+	var data []epsSnapshot
+	if err := json.Unmarshal(d, &data); err != nil {
+		return err
+	}
+	for _, dat := range data {
+		if dat.ID <= 0 || int(dat.ID) > len(eps.pt) {
+			return fmt.Errorf("invalid eps snapshot entity %v", dat.ID)
+		}
+	}
+	for _, dat := range data {
+		i := dat.ID - 1
+		eps.pt[i] = dat.Point
+		eps.ix.flg[i] |= epsDef
+		eps.ix.key[i] = eps.frame.Key(dat.Point)
+	}
+	eps.invalidateAll()
+	return nil
+}
+
 // At returns a slice of entities at a given point; NOTE the slice is not safe
 // to retain long term, and MAY be re-used by the next call to EPS.At.
 //
@@ -115,6 +156,23 @@ func (eps *EPS) At(pt image.Point) []ecs.Entity {
 	return eps.resEnts
 }
 
+// Colocated returns the other entities at the same position as the given
+// one, or nil if it has no position; e.g. to Expand a Query over entities that
+// share a position. Unlike At, the returned slice may be retained.
+func (eps *EPS) Colocated(ent ecs.Entity) []ecs.Entity {
+	pt, def := eps.Get(ent)
+	if !def {
+		return nil
+	}
+	var ents []ecs.Entity
+	for _, other := range eps.At(pt) {
+		if other != ent {
+			ents = append(ents, other)
+		}
+	}
+	return ents
+}
+
 type epsIterator struct {
 	eps *EPS
 	id  ecs.EntityID
@@ -168,6 +226,7 @@ func (epi epsIterator) Count() (n int) {
 
 func (epi *epsIterator) ID() ecs.EntityID        { return epi.id }
 func (epi *epsIterator) Type() ecs.ComponentType { return epi.eps.core.Type(epi.ID()) }
+func (epi *epsIterator) Mask() ecs.TypeMask      { return epi.eps.core.Mask(epi.ID()) }
 func (epi *epsIterator) Entity() ecs.Entity      { return epi.eps.core.Ref(epi.ID()) }
 
 // TODO: NN queries, range queries, etc
@@ -182,6 +241,29 @@ func (eps *EPS) alloc(id ecs.EntityID, t ecs.ComponentType) {
 	eps.ix.ix = append(eps.ix.ix, i)
 }
 
+func (eps *EPS) remap(rm ecs.Remap) {
+	rm.Each(func(old, new ecs.EntityID) {
+		eps.pt[new-1] = eps.pt[old-1]
+		eps.ix.flg[new-1] = eps.ix.flg[old-1]
+		eps.ix.key[new-1] = eps.ix.key[old-1]
+	})
+	n := rm.Len()
+	eps.pt = eps.pt[:n]
+	eps.ix.flg = eps.ix.flg[:n]
+	eps.ix.key = eps.ix.key[:n]
+	eps.ix.ix = eps.ix.ix[:n]
+	eps.invalidateAll()
+}
+
+// invalidateAll marks every index entry invalid, forcing a full re-sort.
+func (eps *EPS) invalidateAll() {
+	for i := range eps.ix.ix {
+		eps.ix.ix[i] = i
+		eps.ix.flg[i] |= epsInval
+	}
+	eps.inval = len(eps.ix.ix)
+}
+
 func (eps *EPS) create(id ecs.EntityID, t ecs.ComponentType) {
 	eps.ix.flg[id-1] |= epsDef
 	eps.ix.key[id-1] = eps.frame.Key(eps.pt[id-1])
@@ -10,6 +10,7 @@ import (
 	"github.com/borkshop/bork/internal/ecs"
 	"github.com/borkshop/bork/internal/ecs/eps"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -27,13 +28,25 @@ func (tps *tps) init() {
 	tps.pos.Init(&tps.Core, tpsPos)
 	tps.nom = []string{""}
 	tps.Core.RegisterAllocator(tpsNom, tps.alloc)
+	tps.Core.RegisterRemapper(tpsNom, tps.remap)
 	tps.Core.RegisterDestroyer(tpsNom, tps.destroyNom)
 }
 
+func newTPS() *tps {
+	var ts tps
+	ts.init()
+	return &ts
+}
+
 func (tps *tps) alloc(id ecs.EntityID, t ecs.ComponentType) {
 	tps.nom = append(tps.nom, "")
 }
 
+func (tps *tps) remap(rm ecs.Remap) {
+	rm.Each(func(old, new ecs.EntityID) { tps.nom[new] = tps.nom[old] })
+	tps.nom = tps.nom[:rm.Len()+1]
+}
+
 func (tps *tps) destroyNom(id ecs.EntityID, t ecs.ComponentType) {
 	tps.nom[id] = ""
 }
@@ -184,6 +197,88 @@ func TestEPS(t *testing.T) {
 		}
 	})
 
+	tps.nomed("0").Destroy()
+	tps.Compact()
+
+	t.Run("At compacted", func(t *testing.T) {
+		assert.Equal(t, 4, tps.Cap())
+		for i, tc := range []struct {
+			x, y int
+			noms []string
+		}{
+			{0, 0, nil},
+			{-1, 1, []string{"b"}},
+			{9, 9, []string{"a", "e"}},
+		} {
+			ents := tps.pos.At(image.Pt(tc.x, tc.y))
+			noms := tps.noms(ents)
+			sort.Strings(noms)
+			assert.Equal(t, tc.noms, noms, "[%v] noms", i)
+		}
+		pos, ok := tps.pos.Get(tps.nomed("e"))
+		assert.True(t, ok)
+		assert.Equal(t, image.Pt(9, 9), pos)
+	})
+
+	t.Run("At snapshotted", func(t *testing.T) {
+		snap := ecs.NewSnapshot()
+		require.NoError(t, snap.Save("core", &tps.Core))
+		require.NoError(t, snap.Save("pos", &tps.pos))
+
+		tps2 := newTPS()
+		require.NoError(t, snap.Load("core", &tps2.Core))
+		require.NoError(t, snap.Load("pos", &tps2.pos))
+		copy(tps2.nom, tps.nom)
+
+		for i, tc := range []struct {
+			x, y int
+			noms []string
+		}{
+			{0, 0, nil},
+			{-1, 1, []string{"b"}},
+			{9, 9, []string{"a", "e"}},
+		} {
+			ents := tps2.pos.At(image.Pt(tc.x, tc.y))
+			noms := tps2.noms(ents)
+			sort.Strings(noms)
+			assert.Equal(t, tc.noms, noms, "[%v] noms", i)
+		}
+		assert.Equal(t, tps.pos.Bounds(), tps2.pos.Bounds())
+	})
+}
+
+func TestMoves_snapshot(t *testing.T) {
+	t1 := newTPS()
+	var mov eps.Moves
+	mov.Init(&t1.pos, tpsPos)
+	t1.load("a", 0, 0, "b", 2, 0)
+	mov.AddPendingMove(t1.nomed("a"), image.Pt(1, 0), 2, 2)
+
+	snap := ecs.NewSnapshot()
+	require.NoError(t, snap.Save("core", &t1.Core))
+	require.NoError(t, snap.Save("pos", &t1.pos))
+	require.NoError(t, snap.Save("mov", &mov))
+
+	t2 := newTPS()
+	var mov2 eps.Moves
+	mov2.Init(&t2.pos, tpsPos)
+	require.NoError(t, snap.Load("core", &t2.Core))
+	require.NoError(t, snap.Load("pos", &t2.pos))
+	require.NoError(t, snap.Load("mov", &mov2))
+	copy(t2.nom, t1.nom)
+
+	a := t2.nomed("a")
+	pend := mov2.GetPendingMove(a)
+	dir, ok := mov2.Dir(pend)
+	assert.True(t, ok)
+	assert.Equal(t, image.Pt(1, 0), dir)
+	assert.Equal(t, 2, mov2.Mag(pend))
+
+	mov.Process()
+	mov2.Process()
+	pos, _ := t1.pos.Get(t1.nomed("a"))
+	pos2, _ := t2.pos.Get(a)
+	assert.Equal(t, pos, pos2)
 }
 
 func TestEPS_Iter(t *testing.T) {
@@ -235,3 +330,24 @@ func TestEPS_Iter(t *testing.T) {
 		})
 	}
 }
+
+func TestEPS_Colocated(t *testing.T) {
+	tps := newTPS()
+	tps.load("a", 0, 0, "b", 0, 0, "c", 1, 0)
+	tps.AddEntity(tpsNom)
+	assert.Equal(t, []string{"b"}, tps.noms(tps.pos.Colocated(tps.nomed("a"))))
+	assert.Nil(t, tps.pos.Colocated(tps.nomed("c")))
+
+	// join position-sharing entities
+	q := ecs.NewQuery()
+	x, y := q.Entity(&tps.Core, tpsNom.All()), q.Entity(&tps.Core, tpsNom.All())
+	q.From(x, tps.pos.Iter())
+	q.Expand(x, y, tps.pos.Colocated)
+	assert.Equal(t, "scan $0; expand $0 -> $1", q.Plan())
+	var pairs [][2]string
+	q.Each(func(res ecs.QueryResult) {
+		pairs = append(pairs, [2]string{tps.nom[res.Get(x).ID()], tps.nom[res.Get(y).ID()]})
+	})
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i][0] < pairs[j][0] })
+	assert.Equal(t, [][2]string{{"a", "b"}, {"b", "a"}}, pairs)
+}
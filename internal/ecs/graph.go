@@ -38,7 +38,9 @@ func (G *Graph) roots(
 	tcl TypeClause,
 	where func(ent, a, b Entity, r ComponentType) bool,
 ) (map[EntityID]bool, int) {
-	// TODO: leverage index if available
+	if G.aIndex != nil && G.bIndex != nil {
+		return G.indexedTriset(G.aIndex, G.bIndex, tcl, where)
+	}
 	it := G.Iter(tcl)
 	triset := make(map[EntityID]bool, it.Count())
 	n := 0
@@ -87,7 +89,9 @@ func (G *Graph) leaves(
 	tcl TypeClause,
 	where func(ent, a, b Entity, r ComponentType) bool,
 ) (map[EntityID]bool, int) {
-	// TODO: leverage index if available
+	if G.bIndex != nil && G.aIndex != nil {
+		return G.indexedTriset(G.bIndex, G.aIndex, tcl, where)
+	}
 	it := G.Iter(tcl)
 	triset := make(map[EntityID]bool, it.Count())
 	n := 0
@@ -98,7 +102,7 @@ func (G *Graph) leaves(
 			it.Entity(),
 			G.aCore.Ref(G.aids[i]),
 			G.aCore.Ref(G.bids[i]),
-			G.types[i],
+			it.Type(),
 		) {
 			continue
 		}
@@ -115,3 +119,48 @@ func (G *Graph) leaves(
 	}
 	return triset, n
 }
+
+// indexedTriset finds entities with matching out-relations, mapping them to
+// true only if they have no matching in-relation.
+func (G *Graph) indexedTriset(
+	out, in relIndex,
+	tcl TypeClause,
+	where func(ent, a, b Entity, r ComponentType) bool,
+) (map[EntityID]bool, int) {
+	triset := make(map[EntityID]bool, len(out))
+	n := 0
+	for id, rids := range out {
+		if !G.anyMatch(rids, tcl, where) {
+			continue
+		}
+		isIn := G.anyMatch(in[id], tcl, where)
+		triset[id] = !isIn
+		if !isIn {
+			n++
+		}
+	}
+	return triset, n
+}
+
+func (G *Graph) anyMatch(
+	rids []EntityID,
+	tcl TypeClause,
+	where func(ent, a, b Entity, r ComponentType) bool,
+) bool {
+	for _, rid := range rids {
+		i := rid - 1
+		t := G.types[i]
+		if t.IsZero() || !tcl.test(t) {
+			continue
+		}
+		if where == nil || where(
+			G.Ref(rid),
+			G.aCore.Ref(G.aids[i]),
+			G.aCore.Ref(G.bids[i]),
+			t.Type(),
+		) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+package ecs
+
+import "sort"
+
+// Descendants returns every node reachable from any of the given nodes,
+// following edges matching the edges clause into nodes matching the nodes
+// clause (nil matches any), in breadth first order; the given nodes themselves
+// are never included, even if reachable from one another.
+func (G *Graph) Descendants(edges, nodes TypeClause, ids ...EntityID) []Entity {
+	return G.reachable(edges, nodes, TraverseBFS, ids)
+}
+
+// Ancestors returns every node from which any of the given nodes is
+// reachable, just like Descendants, but following edges in reverse.
+func (G *Graph) Ancestors(edges, nodes TypeClause, ids ...EntityID) []Entity {
+	return G.reachable(edges, nodes, TraverseCoBFS, ids)
+}
+
+func (G *Graph) reachable(edges, nodes TypeClause, mode TraversalMode, ids []EntityID) []Entity {
+	if len(ids) == 0 {
+		return nil
+	}
+	var result []Entity
+	gt := G.TraverseNodes(edges, nodes, mode)
+	for gt.Init(ids...); gt.Traverse(); {
+		if gt.Edge() != NilEntity {
+			result = append(result, gt.Node())
+		}
+	}
+	return result
+}
+
+// ShortestPath returns the nodes, and the edges between them, along a path
+// with the fewest edges from one node to another; the path starts with from,
+// and ends with to. Only edges matching the edges clause, into nodes matching
+// the nodes clause (nil matches any), are followed. If there is no such path,
+// then both slices are nil.
+func (G *Graph) ShortestPath(edges, nodes TypeClause, from, to EntityID) (path, via []Entity) {
+	gt := G.TraverseNodes(edges, nodes, TraverseBFS).(*bfsTraverser)
+	prior := make(map[EntityID]bfsStep)
+	for gt.Init(from); gt.Traverse(); {
+		if gt.edge != 0 {
+			prior[gt.node] = bfsStep{gt.edge, G.aids[gt.edge-1]}
+		}
+		if gt.node != to {
+			continue
+		}
+		for id := to; ; {
+			path = append(path, G.aCore.Ref(id))
+			step, def := prior[id]
+			if !def {
+				break
+			}
+			via = append(via, G.Ref(step.edge))
+			id = step.node
+		}
+		reverseEntities(path)
+		reverseEntities(via)
+		return path, via
+	}
+	return nil, nil
+}
+
+func reverseEntities(ents []Entity) {
+	for i, j := 0, len(ents)-1; i < j; i, j = i+1, j-1 {
+		ents[i], ents[j] = ents[j], ents[i]
+	}
+}
+
+// TopoSort returns every node connected by edges matching the edges clause,
+// and matching the nodes clause (nil matches any), in topological order: every
+// node comes before any node that it has an edge to; ties are broken by ID.
+// If the graph has any cycle, the order is partial, and false is returned.
+func (G *Graph) TopoSort(edges, nodes TypeClause) ([]Entity, bool) {
+	adj, ids := G.adjacency(edges, nodes)
+	in := make(map[EntityID]int, len(ids))
+	for _, outs := range adj {
+		for _, id := range outs {
+			in[id]++
+		}
+	}
+
+	var q, order []EntityID
+	for _, id := range ids {
+		if in[id] == 0 {
+			q = append(q, id)
+		}
+	}
+	for len(q) > 0 {
+		id := q[0]
+		q = q[1:]
+		order = append(order, id)
+		for _, out := range adj[id] {
+			if in[out]--; in[out] == 0 {
+				// keep q sorted, so that the least ready node is next
+				i := sort.Search(len(q), func(i int) bool { return q[i] > out })
+				q = append(q, 0)
+				copy(q[i+1:], q[i:])
+				q[i] = out
+			}
+		}
+	}
+
+	result := make([]Entity, len(order))
+	for i, id := range order {
+		result[i] = G.aCore.Ref(id)
+	}
+	return result, len(order) == len(ids)
+}
+
+// Cycle returns the nodes of some cycle of edges, matching the edges clause,
+// between nodes matching the nodes clause (nil matches any); the last node
+// has an edge back to the first. Returns nil if the graph is acyclic.
+func (G *Graph) Cycle(edges, nodes TypeClause) []Entity {
+	const (
+		unseen = iota
+		open
+		done
+	)
+	adj, ids := G.adjacency(edges, nodes)
+	state := make(map[EntityID]int, len(ids))
+
+	type frame struct {
+		id EntityID
+		i  int
+	}
+	var stack []frame
+	for _, root := range ids {
+		if state[root] != unseen {
+			continue
+		}
+		state[root] = open
+		stack = append(stack[:0], frame{root, 0})
+		for len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			if top.i >= len(adj[top.id]) {
+				state[top.id] = done
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			next := adj[top.id][top.i]
+			top.i++
+			switch state[next] {
+			case unseen:
+				state[next] = open
+				stack = append(stack, frame{next, 0})
+			case open:
+				var cycle []Entity
+				for i := len(stack) - 1; i >= 0; i-- {
+					cycle = append(cycle, G.aCore.Ref(stack[i].id))
+					if stack[i].id == next {
+						break
+					}
+				}
+				reverseEntities(cycle)
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// adjacency returns the out-neighbors of every node, in edge storage order,
+// along with the IDs of all such nodes in order.
+func (G *Graph) adjacency(edges, nodes TypeClause) (map[EntityID][]EntityID, []EntityID) {
+	adj := make(map[EntityID][]EntityID)
+	var ids []EntityID
+	add := func(id EntityID) {
+		if _, def := adj[id]; !def {
+			adj[id] = nil
+			ids = append(ids, id)
+		}
+	}
+	for it := G.Iter(edges); it.Next(); {
+		i := it.ID() - 1
+		aid, bid := G.aids[i], G.bids[i]
+		if G.types[i].IsZero() || aid == 0 || bid == 0 {
+			continue
+		}
+		if nodes != nil && (!nodes.test(G.aCore.Mask(aid)) || !nodes.test(G.aCore.Mask(bid))) {
+			continue
+		}
+		add(aid)
+		add(bid)
+		adj[aid] = append(adj[aid], bid)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return adj, ids
+}
@@ -0,0 +1,112 @@
+package ecs
+
+// GraphEdge records a graph edge, e.g. one that has been detached.
+type GraphEdge struct {
+	Type ComponentType
+	A, B Entity
+}
+
+// Subtree returns the given nodes, followed by all of their descendants, in
+// breadth first order; only edges matching the type clause are followed.
+func (G *Graph) Subtree(tcl TypeClause, ids ...EntityID) []Entity {
+	var nodes []Entity
+	gt := G.Traverse(tcl, TraverseBFS)
+	for gt.Init(ids...); gt.Traverse(); {
+		nodes = append(nodes, gt.Node())
+	}
+	return nodes
+}
+
+func (G *Graph) subtreeSet(tcl TypeClause, ids []EntityID) map[EntityID]struct{} {
+	nodes := G.Subtree(tcl, ids...)
+	set := make(map[EntityID]struct{}, len(nodes))
+	for _, node := range nodes {
+		set[node.id] = struct{}{}
+	}
+	return set
+}
+
+// Detach cuts the subtrees rooted at the given nodes out of the graph,
+// destroying every edge, matching the type clause, that leads into or within
+// them. The edges within the subtrees are returned, in storage order, so that
+// they may be re-created elsewhere; the nodes themselves are left alone.
+func (G *Graph) Detach(tcl TypeClause, ids ...EntityID) []GraphEdge {
+	if len(ids) == 0 {
+		return nil
+	}
+	set := G.subtreeSet(tcl, ids)
+	var edges []GraphEdge
+	G.Upsert(G.Select(tcl, Filter(func(cur Cursor) bool {
+		_, in := set[cur.B().id]
+		return in
+	})), func(uc *UpsertCursor) {
+		if r := uc.R(); r != NilEntity {
+			if _, in := set[uc.A().id]; in {
+				edges = append(edges, GraphEdge{r.Type(), uc.A(), uc.B()})
+			}
+		}
+	})
+	return edges
+}
+
+// Clone copies the subtrees rooted at the given nodes, following edges matching
+// the type clause, into another graph; usually one over another Core. The clone
+// function is called for every node, in breadth first order, and returns its
+// copy, or NilEntity to skip the node. Every edge between copied nodes is then
+// copied too. Returns a mapping from original node IDs to their copies.
+func (G *Graph) Clone(
+	tcl TypeClause,
+	dst *Graph,
+	clone func(node Entity) Entity,
+	ids ...EntityID,
+) map[EntityID]Entity {
+	nodes := G.Subtree(tcl, ids...)
+	xlate := make(map[EntityID]Entity, len(nodes))
+	for _, node := range nodes {
+		if cp := clone(node); cp != NilEntity {
+			xlate[node.id] = cp
+		}
+	}
+	dst.Upsert(nil, func(uc *UpsertCursor) {
+		for _, node := range nodes {
+			a, def := xlate[node.id]
+			if !def {
+				continue
+			}
+			for cur := G.Select(tcl, InA(node.id)); cur.Scan(); {
+				if b, def := xlate[cur.B().id]; def {
+					uc.Create(cur.R().Type(), a, b)
+				}
+			}
+		}
+	})
+	return xlate
+}
+
+// Reparent destroys every edge, matching the type clause, that leads into the
+// given node, and then creates a new edge of type t from the new parent to
+// it, which is returned; if parent is 0, the node is simply made a root, and
+// NilEntity is returned. Panics if the new parent is the node itself, or one of
+// its descendants (following edges matching the type clause), since that would
+// create a cycle.
+func (G *Graph) Reparent(tcl TypeClause, t ComponentType, id, parent EntityID) Entity {
+	if parent != 0 {
+		if parent == id {
+			panic("reparent cycle")
+		}
+		for _, node := range G.Descendants(tcl, nil, id) {
+			if node.id == parent {
+				panic("reparent cycle")
+			}
+		}
+	}
+	G.Upsert(G.Select(tcl, InB(id)), nil)
+	if parent == 0 {
+		return NilEntity
+	}
+	var edge Entity
+	G.Upsert(nil, func(uc *UpsertCursor) {
+		edge = uc.Create(t, G.aCore.Ref(parent), G.aCore.Ref(id))
+	})
+	return edge
+}
@@ -1,6 +1,7 @@
 package ecs_test
 
 import (
+	"sort"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -18,7 +19,7 @@ func setupGraphTest(flag ecs.RelationFlags) (*stuff, *ecs.Graph) {
 	s6 := s.addData(34)
 	s7 := s.addData(55)
 
-	G := ecs.NewGraph(&s.Core, 0)
+	G := ecs.NewGraph(&s.Core, flag)
 	G.Upsert(nil, func(uc *ecs.UpsertCursor) {
 		uc.Create(srFoo, s1, s2)
 		uc.Create(srFoo, s1, s3)
@@ -32,10 +33,23 @@ func setupGraphTest(flag ecs.RelationFlags) (*stuff, *ecs.Graph) {
 }
 
 func TestGraph_Roots(t *testing.T) {
-	s, G := setupGraphTest(0)
-	roots := G.Roots(ecs.TrueClause, nil)
-	assert.Equal(t, 1, len(roots))
-	assert.Equal(t, s.Ref(1), roots[0])
+	for _, flag := range []ecs.RelationFlags{0, ecs.RelationIndexed} {
+		s, G := setupGraphTest(flag)
+		roots := G.Roots(ecs.TrueClause, nil)
+		assert.Equal(t, 1, len(roots))
+		assert.Equal(t, s.Ref(1), roots[0])
+
+		leaves := G.Leaves(ecs.TrueClause, nil)
+		sort.Slice(leaves, func(i, j int) bool { return leaves[i].ID() < leaves[j].ID() })
+		assert.Equal(t, []ecs.Entity{s.Ref(4), s.Ref(5), s.Ref(6), s.Ref(7)}, leaves)
+
+		// without s1 -> s3, s3 is a root too
+		roots = G.Roots(ecs.TrueClause, func(_, a, b ecs.Entity, _ ecs.ComponentType) bool {
+			return a.ID() != 1 || b.ID() != 3
+		})
+		sort.Slice(roots, func(i, j int) bool { return roots[i].ID() < roots[j].ID() })
+		assert.Equal(t, []ecs.Entity{s.Ref(1), s.Ref(3)}, roots, "flag: %v", flag)
+	}
 }
 
 func gtids(gt ecs.GraphTraverser) []ecs.EntityID {
@@ -73,3 +87,135 @@ func TestGraph_Traverse(t *testing.T) {
 		}},
 	}.run(t)
 }
+
+func entids(ents []ecs.Entity) []ecs.EntityID {
+	var ids []ecs.EntityID
+	for _, ent := range ents {
+		ids = append(ids, ent.ID())
+	}
+	return ids
+}
+
+func TestGraph_BFS(t *testing.T) {
+	s, G := setupGraphTest(0)
+	gt := G.Traverse(ecs.TrueClause, ecs.TraverseBFS)
+	gt.Init()
+	assert.Equal(t, []ecs.EntityID{1, 2, 3, 4, 5, 6, 7}, gtids(gt))
+
+	gt = G.Traverse(ecs.TrueClause, ecs.TraverseCoBFS)
+	gt.Init()
+	assert.Equal(t, []ecs.EntityID{4, 5, 6, 7, 2, 3, 1}, gtids(gt))
+
+	// node clauses prune whole subtrees, while edge clauses select edges
+	s.Ref(3).Add(scD2)
+	gt = G.TraverseNodes(ecs.TrueClause, scD2.NotAll(), ecs.TraverseBFS)
+	gt.Init()
+	assert.Equal(t, []ecs.EntityID{1, 2, 4, 5}, gtids(gt))
+	gt = G.TraverseNodes(ecs.TrueClause, scD2.NotAll(), ecs.TraverseDFS)
+	gt.Init(3)
+	assert.Empty(t, gtids(gt), "non-matching seeds are skipped")
+	G.Upsert(nil, func(uc *ecs.UpsertCursor) { uc.Create(srBar, s.Ref(4), s.Ref(6)) })
+	gt = G.Traverse(srBar.All(), ecs.TraverseBFS)
+	gt.Init()
+	assert.Equal(t, []ecs.EntityID{4, 6}, gtids(gt))
+}
+
+func TestGraph_search(t *testing.T) {
+	for _, flag := range []ecs.RelationFlags{0, ecs.RelationIndexed} {
+		s, G := setupGraphTest(flag)
+
+		assert.Equal(t, []ecs.EntityID{2, 3, 4, 5, 6, 7}, entids(G.Descendants(ecs.TrueClause, nil, 1)))
+		assert.Equal(t, []ecs.EntityID{4, 5, 6, 7}, entids(G.Descendants(ecs.TrueClause, nil, 2, 3)))
+		assert.Equal(t, []ecs.EntityID{2, 6, 7, 4, 5}, entids(G.Descendants(ecs.TrueClause, nil, 1, 3)))
+		assert.Equal(t, []ecs.EntityID{1}, entids(G.Ancestors(ecs.TrueClause, nil, 3, 7)))
+		assert.Equal(t, []ecs.EntityID{3, 1}, entids(G.Ancestors(ecs.TrueClause, nil, 7)))
+		assert.Empty(t, G.Descendants(ecs.TrueClause, nil, 7))
+		assert.Empty(t, G.Descendants(ecs.TrueClause, nil))
+
+		order, ok := G.TopoSort(ecs.TrueClause, nil)
+		assert.True(t, ok)
+		assert.Equal(t, []ecs.EntityID{1, 2, 3, 4, 5, 6, 7}, entids(order))
+		assert.Nil(t, G.Cycle(ecs.TrueClause, nil))
+
+		path, via := G.ShortestPath(ecs.TrueClause, nil, 1, 6)
+		assert.Equal(t, []ecs.EntityID{1, 3, 6}, entids(path))
+		assert.Equal(t, []ecs.EntityID{2, 5}, entids(via))
+		path, via = G.ShortestPath(ecs.TrueClause, nil, 2, 2)
+		assert.Equal(t, []ecs.EntityID{2}, entids(path))
+		assert.Empty(t, via)
+		path, _ = G.ShortestPath(ecs.TrueClause, nil, 2, 6)
+		assert.Nil(t, path)
+
+		// a shortcut, then a cycle: 6 -> 2 -> 5 -> 6
+		G.Upsert(nil, func(uc *ecs.UpsertCursor) {
+			uc.Create(srFoo, s.Ref(2), s.Ref(6))
+		})
+		path, _ = G.ShortestPath(ecs.TrueClause, nil, 1, 6)
+		assert.Equal(t, []ecs.EntityID{1, 2, 6}, entids(path))
+		path, _ = G.ShortestPath(ecs.TrueClause, scD2.NotAll(), 1, 6)
+		assert.Equal(t, []ecs.EntityID{1, 2, 6}, entids(path))
+		s.Ref(2).Add(scD2)
+		path, _ = G.ShortestPath(ecs.TrueClause, scD2.NotAll(), 1, 6)
+		assert.Equal(t, []ecs.EntityID{1, 3, 6}, entids(path))
+		s.Ref(2).Delete(scD2)
+
+		G.Upsert(nil, func(uc *ecs.UpsertCursor) {
+			uc.Create(srBar, s.Ref(5), s.Ref(6))
+			uc.Create(srBar, s.Ref(6), s.Ref(2))
+		})
+		assert.Nil(t, G.Cycle(srFoo.All(), nil))
+		assert.Equal(t, []ecs.EntityID{2, 5, 6}, entids(G.Cycle(ecs.TrueClause, nil)))
+		order, ok = G.TopoSort(ecs.TrueClause, nil)
+		assert.False(t, ok)
+		assert.Equal(t, []ecs.EntityID{1, 3, 7}, entids(order))
+		assert.Nil(t, G.Cycle(ecs.TrueClause, scData.NotAll()))
+	}
+}
+
+func TestGraph_subtree(t *testing.T) {
+	for _, flag := range []ecs.RelationFlags{0, ecs.RelationIndexed} {
+		s, G := setupGraphTest(flag)
+		assert.Equal(t, []ecs.EntityID{2, 4, 5}, entids(G.Subtree(ecs.TrueClause, 2)))
+
+		// clone the s2 subtree, except for s5, into another core
+		o := newStuff()
+		oG := ecs.NewGraph(&o.Core, flag)
+		xlate := G.Clone(srFoo.All(), oG, func(node ecs.Entity) ecs.Entity {
+			if node.ID() == 5 {
+				return ecs.NilEntity
+			}
+			return o.addData(s.d1[node.ID()])
+		}, 2)
+		assert.Equal(t, map[ecs.EntityID]ecs.Entity{2: o.Ref(1), 4: o.Ref(2)}, xlate)
+		var edges [][2]int
+		for cur := oG.Select(srFoo.All()); cur.Scan(); {
+			edges = append(edges, [2]int{o.d1[cur.A().ID()], o.d1[cur.B().ID()]})
+		}
+		assert.Equal(t, [][2]int{{5, 13}}, edges)
+		assert.Equal(t, 6, G.Len(), "cloning leaves the source alone")
+
+		// detach the s3 subtree
+		detached := G.Detach(ecs.TrueClause, 3)
+		assert.Equal(t, []ecs.GraphEdge{
+			{srFoo, s.Ref(3), s.Ref(6)},
+			{srFoo, s.Ref(3), s.Ref(7)},
+		}, detached)
+		assert.Equal(t, 3, G.Len())
+		assert.Equal(t, []ecs.EntityID{2, 4, 5}, entids(G.Descendants(ecs.TrueClause, nil, 1)))
+		assert.True(t, s.Valid(s.Ref(3)), "nodes are left alone")
+
+		// reparent s2 under s7, and cut s4 loose
+		edge := G.Reparent(srFoo.All(), srBar, 2, 7)
+		assert.Equal(t, [2]ecs.Entity{s.Ref(7), s.Ref(2)}, [2]ecs.Entity{G.A(edge), G.B(edge)})
+		assert.Equal(t, ecs.NilEntity, G.Reparent(ecs.TrueClause, srBar, 4, 0))
+		roots := G.Roots(ecs.TrueClause, nil)
+		sort.Slice(roots, func(i, j int) bool { return roots[i].ID() < roots[j].ID() })
+		assert.Equal(t, []ecs.EntityID{7}, entids(roots))
+		assert.Equal(t, []ecs.EntityID{2, 5}, entids(G.Descendants(ecs.TrueClause, nil, 7)))
+
+		// a node can't be moved under itself, or its descendants
+		assert.Panics(t, func() { G.Reparent(ecs.TrueClause, srBar, 7, 7) })
+		assert.Panics(t, func() { G.Reparent(ecs.TrueClause, srBar, 7, 5) })
+		assert.Equal(t, 2, G.Len(), "nothing changes on a rejected reparent")
+	}
+}
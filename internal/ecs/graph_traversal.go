@@ -1,5 +1,7 @@
 package ecs
 
+import "sort"
+
 // TraversalMode represents a graph traversal mode.
 type TraversalMode uint8
 
@@ -9,20 +11,43 @@ const (
 	TraverseDFS TraversalMode = 1 << iota
 	traverseCo
 
+	// TraverseBFS is Breadth First Search traversal, starting from all
+	// matching roots.
+	TraverseBFS
+
 	// TraverseCoDFS is Reversed Depth First Search traversal, starting from
 	// all matching leaves.
 	TraverseCoDFS = traverseCo | TraverseDFS
 
-	// TODO: other modes like BFS
+	// TraverseCoBFS is Reversed Breadth First Search traversal, starting from
+	// all matching leaves.
+	TraverseCoBFS = traverseCo | TraverseBFS
 )
 
 // Traverse returns a new graph travers for the given type clause and mode.
 func (G *Graph) Traverse(tcl TypeClause, mode TraversalMode) GraphTraverser {
+	return G.TraverseNodes(tcl, nil, mode)
+}
+
+// TraverseNodes returns a new graph traverser, like Traverse, that only
+// follows edges matching the edges clause into nodes matching the nodes
+// clause; a nil nodes clause matches any node. Seed nodes that don't match
+// are skipped.
+func (G *Graph) TraverseNodes(edges, nodes TypeClause, mode TraversalMode) GraphTraverser {
 	switch mode {
 	case TraverseDFS, TraverseCoDFS:
 		return &dfsTraverser{
 			g:    G,
-			tcl:  tcl,
+			tcl:  edges,
+			ntcl: nodes,
+			mode: mode,
+		}
+
+	case TraverseBFS, TraverseCoBFS:
+		return &bfsTraverser{
+			g:    G,
+			tcl:  edges,
+			ntcl: nodes,
 			mode: mode,
 		}
 
@@ -43,6 +68,7 @@ type GraphTraverser interface {
 type dfsTraverser struct {
 	g    *Graph
 	tcl  TypeClause
+	ntcl TypeClause
 	mode TraversalMode
 	seen map[EntityID]struct{}
 	edge EntityID
@@ -66,13 +92,7 @@ func (gt *dfsTraverser) Traverse() bool {
 
 func (gt *dfsTraverser) traverse() bool {
 	if gt.node != 0 {
-		var cur Cursor
-		if gt.mode&traverseCo == 0 {
-			cur = gt.g.Select(gt.tcl, InA(gt.node))
-		} else {
-			cur = gt.g.Select(gt.tcl, InB(gt.node))
-		}
-		if cur.Scan() {
+		if cur := gt.g.step(gt.tcl, gt.ntcl, gt.mode, gt.node); cur.Scan() {
 			gt.curs = append(gt.curs, cur)
 			gt.setState(cur)
 			return true
@@ -105,41 +125,143 @@ func (gt *dfsTraverser) setState(cur Cursor) {
 }
 
 func (gt *dfsTraverser) Init(seed ...EntityID) {
-	if len(gt.seen) > 0 {
-		for id := range gt.seen {
-			delete(gt.seen, id)
+	gt.seen = gt.g.resetSeen(gt.seen)
+	gt.edge = 0
+	gt.node = 0
+	gt.q = gt.g.seeds(gt.q[:0], gt.tcl, gt.ntcl, gt.mode, seed)
+}
+
+type bfsStep struct{ edge, node EntityID }
+
+type bfsTraverser struct {
+	g    *Graph
+	tcl  TypeClause
+	ntcl TypeClause
+	mode TraversalMode
+	seen map[EntityID]struct{}
+	edge EntityID
+	node EntityID
+	q    []bfsStep
+	seed []EntityID
+}
+
+func (gt *bfsTraverser) G() *Graph    { return gt.g }
+func (gt *bfsTraverser) Edge() Entity { return gt.g.Ref(gt.edge) }
+func (gt *bfsTraverser) Node() Entity { return gt.g.aCore.Ref(gt.node) }
+func (gt *bfsTraverser) Traverse() bool {
+	for len(gt.q) > 0 {
+		step := gt.q[0]
+		gt.q = gt.q[1:]
+		if _, seen := gt.seen[step.node]; seen {
+			continue
 		}
-	} else {
-		// TODO: shave down this estimate?
-		gt.seen = make(map[EntityID]struct{}, gt.g.Len())
+		gt.seen[step.node] = struct{}{}
+		gt.edge, gt.node = step.edge, step.node
+		for cur := gt.g.step(gt.tcl, gt.ntcl, gt.mode, gt.node); cur.Scan(); {
+			next := bfsStep{edge: cur.R().id, node: cur.B().id}
+			if gt.mode&traverseCo != 0 {
+				next.node = cur.A().id
+			}
+			if _, seen := gt.seen[next.node]; !seen {
+				gt.q = append(gt.q, next)
+			}
+		}
+		return true
 	}
 	gt.edge = 0
 	gt.node = 0
+	return false
+}
+
+func (gt *bfsTraverser) Init(seed ...EntityID) {
+	gt.seen = gt.g.resetSeen(gt.seen)
+	gt.edge = 0
+	gt.node = 0
+	gt.seed = gt.g.seeds(gt.seed[:0], gt.tcl, gt.ntcl, gt.mode, seed)
 	gt.q = gt.q[:0]
+	for _, id := range gt.seed {
+		gt.q = append(gt.q, bfsStep{node: id})
+	}
+}
 
-	if len(seed) > 0 {
-		gt.q = append(gt.q, seed...)
-	} else {
-		var (
-			triset map[EntityID]bool
-			n      int
-		)
-		if gt.mode&traverseCo == 0 {
-			triset, n = gt.g.roots(gt.tcl, nil)
-		} else {
-			triset, n = gt.g.leaves(gt.tcl, nil)
-		}
-		if n <= 0 {
-			return
+// step returns a cursor over the edges, matching the edges clause, leading out
+// of (or, for co-traversals, into) the given node from nodes matching the
+// nodes clause.
+func (G *Graph) step(edges, nodes TypeClause, mode TraversalMode, id EntityID) Cursor {
+	if mode&traverseCo == 0 {
+		if nodes == nil {
+			return G.Select(edges, InA(id))
 		}
+		return G.Select(edges, InA(id), Filter(func(cur Cursor) bool {
+			return nodes.test(cur.B().Mask())
+		}))
+	}
+	if nodes == nil {
+		return G.Select(edges, InB(id))
+	}
+	return G.Select(edges, InB(id), Filter(func(cur Cursor) bool {
+		return nodes.test(cur.A().Mask())
+	}))
+}
 
-		if cap(gt.q) < n {
-			gt.q = make([]EntityID, 0, n)
+func (G *Graph) resetSeen(seen map[EntityID]struct{}) map[EntityID]struct{} {
+	if len(seen) > 0 {
+		for id := range seen {
+			delete(seen, id)
 		}
-		for id, in := range triset {
-			if in {
-				gt.q = append(gt.q, id)
+		return seen
+	}
+	// TODO: shave down this estimate?
+	return make(map[EntityID]struct{}, G.Len())
+}
+
+// seeds appends any given seed nodes that match the nodes clause, or all roots
+// (or, for co-traversals, leaves) in ID order if none are given, to the given
+// queue.
+func (G *Graph) seeds(q []EntityID, edges, nodes TypeClause, mode TraversalMode, seed []EntityID) []EntityID {
+	if len(seed) > 0 {
+		for _, id := range seed {
+			if nodes == nil || nodes.test(G.aCore.Mask(id)) {
+				q = append(q, id)
 			}
 		}
+		return q
+	}
+
+	var where func(ent, a, b Entity, r ComponentType) bool
+	if nodes != nil {
+		where = func(_, a, b Entity, _ ComponentType) bool {
+			return nodes.test(a.Mask()) && nodes.test(b.Mask())
+		}
+	}
+	var (
+		triset map[EntityID]bool
+		n      int
+	)
+	if mode&traverseCo == 0 {
+		triset, n = G.roots(edges, where)
+	} else {
+		triset, n = G.leaves(edges, where)
+	}
+	if n <= 0 {
+		return q
+	}
+
+	if cap(q) < n {
+		q = make([]EntityID, 0, n)
+	}
+	i := len(q)
+	for id, in := range triset {
+		if in {
+			q = append(q, id)
+		}
+	}
+	roots := q[i:]
+	if mode&TraverseDFS != 0 {
+		// q is a stack, so the least root should be last
+		sort.Slice(roots, func(i, j int) bool { return roots[i] > roots[j] })
+	} else {
+		sort.Slice(roots, func(i, j int) bool { return roots[i] < roots[j] })
 	}
+	return q
 }
@@ -6,6 +6,7 @@ type Iterator interface {
 	Reset()
 	Count() int
 	Type() ComponentType
+	Mask() TypeMask
 	ID() EntityID
 	Entity() Entity
 }
@@ -59,11 +60,15 @@ func (it coreIterator) Count() int {
 
 // Type returns the type of the current entity, or NoType if iteration is
 // done.
-func (it coreIterator) Type() ComponentType {
-	if it.i < len(it.co.types) {
+func (it coreIterator) Type() ComponentType { return it.Mask().Type() }
+
+// Mask returns the whole type mask of the current entity, or NoMask if
+// iteration is done.
+func (it coreIterator) Mask() TypeMask {
+	if it.i >= 0 && it.i < len(it.co.types) {
 		return it.co.types[it.i]
 	}
-	return NoType
+	return NoMask
 }
 
 // ID returns the type of the current entity, or 0 if iteration is done.
@@ -78,7 +83,7 @@ func (it coreIterator) ID() EntityID {
 // iteration is done.
 func (it coreIterator) Entity() Entity {
 	if it.i < len(it.co.types) {
-		return Entity{it.co, EntityID(it.i + 1)}
+		return it.co.Ref(EntityID(it.i + 1))
 	}
 	return NilEntity
 }
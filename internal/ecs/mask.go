@@ -0,0 +1,112 @@
+package ecs
+
+import (
+	"fmt"
+	"strings"
+)
+
+const maskWords = 4
+
+// MaxTypeBits is how many distinct component type bits a TypeMask can hold.
+const MaxTypeBits = 64 * maskWords
+
+// TypeMask is a wide ComponentType, for when more than the 64 bits afforded by
+// ComponentType are needed; it is how a Core stores entity types. Its first
+// word coincides with ComponentType, so any ComponentType may be widened by
+// ComponentType.Mask.
+type TypeMask [maskWords]uint64
+
+// TypeBits is implemented by both ComponentType and TypeMask; it's accepted
+// wherever either may be used.
+type TypeBits interface {
+	Mask() TypeMask
+}
+
+// NoMask is the empty TypeMask, equivalent to NoType.
+var NoMask TypeMask
+
+// TypeBit returns a TypeMask with only the given bit set; panics if the bit is
+// not less than MaxTypeBits.
+func TypeBit(bit uint) TypeMask {
+	if bit >= MaxTypeBits {
+		panic("type bit out of range")
+	}
+	var m TypeMask
+	m[bit/64] = 1 << (bit % 64)
+	return m
+}
+
+// Mask returns the given type as a TypeMask.
+func (t ComponentType) Mask() TypeMask { return TypeMask{uint64(t)} }
+
+// Mask returns the mask itself; it makes TypeMask implement TypeBits.
+func (m TypeMask) Mask() TypeMask { return m }
+
+// Type returns the first 64 bits of the mask as a ComponentType.
+func (m TypeMask) Type() ComponentType { return ComponentType(m[0]) }
+
+// Wide returns true only if any bits beyond the first 64 are set.
+func (m TypeMask) Wide() bool {
+	for _, w := range m[1:] {
+		if w != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// IsZero returns true only if no bits are set.
+func (m TypeMask) IsZero() bool { return m == NoMask }
+
+// Or returns the union of two masks.
+func (m TypeMask) Or(o TypeMask) TypeMask {
+	for i := range m {
+		m[i] |= o[i]
+	}
+	return m
+}
+
+// And returns the intersection of two masks.
+func (m TypeMask) And(o TypeMask) TypeMask {
+	for i := range m {
+		m[i] &= o[i]
+	}
+	return m
+}
+
+// AndNot returns the mask with any bits set in the other one cleared.
+func (m TypeMask) AndNot(o TypeMask) TypeMask {
+	for i := range m {
+		m[i] &^= o[i]
+	}
+	return m
+}
+
+// HasAll returns true only if all of the masked type bits are set. If the mask
+// is NoMask, always returns false.
+func (m TypeMask) HasAll(mask TypeMask) bool {
+	return !mask.IsZero() && m.And(mask) == mask
+}
+
+// HasAny returns true only if at least one of the masked type bits is set. If
+// the mask is NoMask, always returns true.
+func (m TypeMask) HasAny(mask TypeMask) bool {
+	return mask.IsZero() || !m.And(mask).IsZero()
+}
+
+// ApplyTo sets the given entity's type to m; simply a dual of Entity.SetMask.
+func (m TypeMask) ApplyTo(ent Entity) { ent.SetMask(m) }
+
+// String formats the mask as a hex number, just like ComponentType does if
+// no wide bits are set.
+func (m TypeMask) String() string {
+	i := len(m) - 1
+	for i > 0 && m[i] == 0 {
+		i--
+	}
+	parts := make([]string, 0, i+1)
+	for ; i >= 0; i-- {
+		parts = append(parts, fmt.Sprintf("%016x", m[i]))
+	}
+	return strings.Join(parts, "")
+}
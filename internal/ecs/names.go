@@ -0,0 +1,341 @@
+package ecs
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+// TypeNames is a registry of names for component type bits; it is used to
+// format TypeClauses and masks readably, and to parse TypeClause expressions.
+//
+// A name may stand for any mask: single-bit names are used when formatting,
+// while multi-bit names are only aliases for parsing.
+type TypeNames struct {
+	byName map[string]TypeMask
+	byBit  [MaxTypeBits]string
+}
+
+// DefaultTypeNames is the registry used by TypeClause String methods, and the
+// package level RegisterTypeName and ParseClause functions.
+var DefaultTypeNames TypeNames
+
+// RegisterTypeName registers a name in DefaultTypeNames.
+func RegisterTypeName(name string, t TypeBits) { DefaultTypeNames.Register(name, t) }
+
+// ParseClause parses an expression using DefaultTypeNames.
+func ParseClause(expr string) (TypeClause, error) { return DefaultTypeNames.Parse(expr) }
+
+// Register a name for the given type bits. Panics if the name isn't an
+// identifier, if the mask is empty, or if the name is already registered for
+// a different mask. The first name registered for any single bit is the one
+// used to format it.
+func (tn *TypeNames) Register(name string, t TypeBits) {
+	m := t.Mask()
+	if !isTypeIdent(name) || name == "true" || name == "false" {
+		panic(fmt.Sprintf("invalid type name %q", name))
+	}
+	if m.IsZero() {
+		panic("cannot name NoType")
+	}
+	if prior, def := tn.byName[name]; def {
+		if prior != m {
+			panic(fmt.Sprintf("type name %q already registered", name))
+		}
+		return
+	}
+	if tn.byName == nil {
+		tn.byName = make(map[string]TypeMask)
+	}
+	tn.byName[name] = m
+	if bit, single := singleBit(m); single && tn.byBit[bit] == "" {
+		tn.byBit[bit] = name
+	}
+}
+
+// Lookup returns the mask registered under a name.
+func (tn *TypeNames) Lookup(name string) (TypeMask, bool) {
+	m, def := tn.byName[name]
+	return m, def
+}
+
+// FormatMask formats each bit in the mask by name, joined by "|"; any unnamed
+// bits are formatted as hex literals.
+func (tn *TypeNames) FormatMask(t TypeBits) string {
+	m := t.Mask()
+	if m.IsZero() {
+		return "0x0"
+	}
+	return strings.Join(tn.bitNames(m), "|")
+}
+
+// FormatClause formats a TypeClause as an expression that Parse accepts.
+func (tn *TypeNames) FormatClause(tcl TypeClause) string {
+	s, _ := tn.formatClause(tcl)
+	return s
+}
+
+// ParseMask parses a mask formatted by FormatMask: names (or hex literals)
+// joined by "|".
+func (tn *TypeNames) ParseMask(s string) (TypeMask, error) {
+	var m TypeMask
+	for _, part := range strings.Split(s, "|") {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, "0x") {
+			pm, err := parseHexMask(part[2:])
+			if err != nil {
+				return TypeMask{}, err
+			}
+			m = m.Or(pm)
+		} else if pm, def := tn.byName[part]; def {
+			m = m.Or(pm)
+		} else {
+			return TypeMask{}, fmt.Errorf("unknown type name %q", part)
+		}
+	}
+	return m, nil
+}
+
+// parseHexMask parses the digits of a hex literal mask, which must not be
+// empty.
+func parseHexMask(digits string) (m TypeMask, err error) {
+	if digits == "" {
+		return m, errors.New("empty hex literal")
+	}
+	err = m.UnmarshalText([]byte(digits))
+	return m, err
+}
+
+// Parse parses a TypeClause expression like "position & glyph & !wall | (ai &
+// input)". Each name term matches only if all of its type bits are set, as
+// does a hex literal term like "0x4"; "true" and "false" are also terms. Terms
+// may be negated with "!", and combined with "&" (which binds tighter) and
+// "|"; parentheses group. The resulting clause is simplified by And and Or.
+func (tn *TypeNames) Parse(expr string) (TypeClause, error) {
+	p := clauseParser{tn: tn, s: expr}
+	tcl, err := p.or()
+	if err == nil && p.next() != "" {
+		err = p.errorf("unexpected %q", p.tok)
+	}
+	return tcl, err
+}
+
+func (tn *TypeNames) bitNames(m TypeMask) []string {
+	var parts []string
+	for i, w := range m {
+		for w != 0 {
+			bit := bits.TrailingZeros64(w)
+			w &^= 1 << uint(bit)
+			bit += 64 * i
+			if name := tn.byBit[bit]; name != "" {
+				parts = append(parts, name)
+			} else {
+				parts = append(parts, hexLiteral(TypeBit(uint(bit))))
+			}
+		}
+	}
+	return parts
+}
+
+// clause formatting precedence levels
+const (
+	precOr = iota + 1
+	precAnd
+	precUnary
+)
+
+func (tn *TypeNames) formatClause(tcl TypeClause) (string, int) {
+	switch val := tcl.(type) {
+	case constClause:
+		return fmt.Sprint(bool(val)), precUnary
+	case allClause:
+		return tn.formatJoin(TypeMask(val), " & ", precAnd)
+	case anyClause:
+		return tn.formatJoin(TypeMask(val), " | ", precOr)
+	case notAllClause:
+		s, prec := tn.formatJoin(TypeMask(val), " & ", precAnd)
+		return "!" + paren(s, prec, precUnary), precUnary
+	case notAnyClause:
+		s, prec := tn.formatJoin(TypeMask(val), " | ", precOr)
+		return "!" + paren(s, prec, precUnary), precUnary
+	case andClause:
+		return tn.formatList(val, " & ", precAnd), precAnd
+	case orClause:
+		return tn.formatList(val, " | ", precOr), precOr
+	default:
+		return fmt.Sprint(tcl), precUnary
+	}
+}
+
+func (tn *TypeNames) formatJoin(m TypeMask, sep string, prec int) (string, int) {
+	if m.IsZero() {
+		return "0x0", precUnary
+	}
+	parts := tn.bitNames(m)
+	if len(parts) == 1 {
+		return parts[0], precUnary
+	}
+	return strings.Join(parts, sep), prec
+}
+
+func (tn *TypeNames) formatList(tcls []TypeClause, sep string, prec int) string {
+	parts := make([]string, 0, len(tcls))
+	for _, tcl := range tcls {
+		s, sprec := tn.formatClause(tcl)
+		parts = append(parts, paren(s, sprec, prec))
+	}
+	return strings.Join(parts, sep)
+}
+
+func paren(s string, prec, min int) string {
+	if prec < min {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+func hexLiteral(m TypeMask) string {
+	s := strings.TrimLeft(m.String(), "0")
+	if s == "" {
+		s = "0"
+	}
+	return "0x" + s
+}
+
+func singleBit(m TypeMask) (int, bool) {
+	bit, n := 0, 0
+	for i, w := range m {
+		if c := bits.OnesCount64(w); c > 0 {
+			n += c
+			bit = 64*i + bits.TrailingZeros64(w)
+		}
+	}
+	return bit, n == 1
+}
+
+func isTypeIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_', 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z':
+		case i > 0 && ('0' <= r && r <= '9' || r == '.' || r == '-'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+type clauseParser struct {
+	tn  *TypeNames
+	s   string
+	i   int // offset of the next token
+	at  int // offset of the current token
+	tok string
+	// peeked is true if tok has been scanned but not consumed
+	peeked bool
+}
+
+func (p *clauseParser) errorf(mess string, args ...interface{}) error {
+	return fmt.Errorf("invalid type clause %q at %d: %s", p.s, p.at, fmt.Sprintf(mess, args...))
+}
+
+// next consumes and returns the next token, or "" at the end of input.
+func (p *clauseParser) next() string {
+	tok := p.peek()
+	p.peeked = false
+	return tok
+}
+
+func (p *clauseParser) peek() string {
+	if p.peeked {
+		return p.tok
+	}
+	for p.i < len(p.s) && (p.s[p.i] == ' ' || p.s[p.i] == '\t' || p.s[p.i] == '\n') {
+		p.i++
+	}
+	p.at = p.i
+	p.peeked = true
+	if p.i >= len(p.s) {
+		p.tok = ""
+		return p.tok
+	}
+	switch p.s[p.i] {
+	case '&', '|', '!', '(', ')':
+		p.i++
+	default:
+		for p.i < len(p.s) && !strings.ContainsRune(" \t\n&|!()", rune(p.s[p.i])) {
+			p.i++
+		}
+	}
+	p.tok = p.s[p.at:p.i]
+	return p.tok
+}
+
+func (p *clauseParser) or() (TypeClause, error) {
+	tcl, err := p.and()
+	for err == nil && p.peek() == "|" {
+		p.next()
+		var b TypeClause
+		if b, err = p.and(); err == nil {
+			tcl = Or(tcl, b)
+		}
+	}
+	return tcl, err
+}
+
+func (p *clauseParser) and() (TypeClause, error) {
+	tcl, err := p.unary()
+	for err == nil && p.peek() == "&" {
+		p.next()
+		var b TypeClause
+		if b, err = p.unary(); err == nil {
+			tcl = And(tcl, b)
+		}
+	}
+	return tcl, err
+}
+
+func (p *clauseParser) unary() (TypeClause, error) {
+	switch tok := p.next(); tok {
+	case "":
+		return nil, p.errorf("unexpected end of expression")
+	case "!":
+		tcl, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return Not(tcl), nil
+	case "(":
+		tcl, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, p.errorf("expected \")\", got %q", p.tok)
+		}
+		return tcl, nil
+	case "&", "|", ")":
+		return nil, p.errorf("unexpected %q", tok)
+	case "true":
+		return TrueClause, nil
+	case "false":
+		return FalseClause, nil
+	default:
+		if strings.HasPrefix(tok, "0x") {
+			m, err := parseHexMask(tok[2:])
+			if err != nil {
+				return nil, p.errorf("%v", err)
+			}
+			return m.All(), nil
+		}
+		m, def := p.tn.byName[tok]
+		if !def {
+			return nil, p.errorf("unknown type name %q", tok)
+		}
+		return m.All(), nil
+	}
+}
@@ -0,0 +1,109 @@
+package ecs_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/borkshop/bork/internal/ecs"
+)
+
+func TestTypeNames(t *testing.T) {
+	const (
+		tnPosition ecs.ComponentType = 1 << iota
+		tnGlyph
+		tnWall
+		tnAI
+		tnInput
+		tnUnnamed
+	)
+	var tn ecs.TypeNames
+	tn.Register("position", tnPosition)
+	tn.Register("glyph", tnGlyph)
+	tn.Register("wall", tnWall)
+	tn.Register("ai", tnAI)
+	tn.Register("input", tnInput)
+	tn.Register("actor", tnAI|tnInput)
+	tn.Register("wide", ecs.TypeBit(100))
+	assert.Panics(t, func() { tn.Register("wall", tnAI) })
+	assert.Panics(t, func() { tn.Register("not a name", tnAI) })
+
+	assert.Equal(t, "position|glyph|0x20", tn.FormatMask(tnPosition|tnGlyph|tnUnnamed))
+	assert.Equal(t, "position|wide", tn.FormatMask(tnPosition.Mask().Or(ecs.TypeBit(100))))
+	m, err := tn.ParseMask("position|glyph|0x20")
+	require.NoError(t, err)
+	assert.Equal(t, (tnPosition | tnGlyph | tnUnnamed).Mask(), m)
+	_, err = tn.ParseMask("position|0x")
+	assert.Error(t, err)
+
+	for _, tc := range []struct {
+		name   string
+		clause ecs.TypeClause
+		expr   string
+	}{
+		{"all", (tnPosition | tnGlyph).All(), "position & glyph"},
+		{"any", (tnPosition | tnGlyph).Any(), "position | glyph"},
+		{"notAll", (tnAI | tnInput).NotAll(), "!(ai & input)"},
+		{"notAny", (tnAI | tnInput).NotAny(), "!(ai | input)"},
+		{"single", tnWall.NotAll(), "!wall"},
+		{"unnamed", tnUnnamed.All(), "0x20"},
+		{"const", ecs.TrueClause, "true"},
+		{"and", ecs.And(tnPosition.All(), tnWall.NotAll(), (tnAI | tnInput).Any()),
+			"position & !wall & (ai | input)"},
+		{"or", ecs.Or((tnPosition | tnGlyph).All(), (tnAI | tnInput).NotAll()),
+			"position & glyph | !(ai & input)"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expr, tn.FormatClause(tc.clause))
+			tcl, err := tn.Parse(tc.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tc.clause, tcl, "round trip")
+		})
+	}
+
+	// String uses DefaultTypeNames, here with no names registered
+	assert.Equal(t, "0x1 & !0x4", fmt.Sprint(ecs.And(tnPosition.All(), tnWall.NotAll())))
+
+	t.Run("parse", func(t *testing.T) {
+		tcl, err := tn.Parse("position & glyph & !wall | (ai & input)")
+		require.NoError(t, err)
+		assert.Equal(t, "position & glyph & !wall | ai & input", tn.FormatClause(tcl))
+		for _, tc := range []struct {
+			t     ecs.ComponentType
+			match bool
+		}{
+			{tnPosition | tnGlyph, true},
+			{tnPosition | tnGlyph | tnWall, false},
+			{tnPosition | tnWall | tnAI | tnInput, true},
+			{tnAI, false},
+		} {
+			assert.Equal(t, tc.match, matches(tcl, tc.t), "%v", tc.t)
+		}
+
+		// single bits merge under either operator, aliases expand
+		tcl, err = tn.Parse("ai | input")
+		require.NoError(t, err)
+		assert.Equal(t, (tnAI | tnInput).Any(), tcl)
+		tcl, err = tn.Parse("!ai & !input & actor")
+		require.NoError(t, err)
+		assert.Equal(t, ecs.And((tnAI|tnInput).NotAny(), (tnAI|tnInput).All()), tcl)
+		tcl, err = tn.Parse("wide & 0x1")
+		require.NoError(t, err)
+		assert.Equal(t, ecs.TypeBit(100).Or(tnPosition.Mask()).All(), tcl)
+
+		for _, expr := range []string{
+			"", "position &", "(position", "position)", "nope", "& wall", "0xzz", "0x", "wall & 0x",
+		} {
+			_, err := tn.Parse(expr)
+			assert.Error(t, err, "%q", expr)
+		}
+	})
+}
+
+func matches(tcl ecs.TypeClause, t ecs.ComponentType) bool {
+	var co ecs.Core
+	co.AddEntity(t)
+	return co.Iter(tcl).Count() == 1
+}
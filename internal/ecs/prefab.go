@@ -0,0 +1,274 @@
+package ecs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// Prefab is an entity template: the type bits, and initial component data,
+// that an instantiated entity gets. A prefab may extend another, inheriting
+// its type bits and any data that it doesn't itself define.
+//
+// Prefabs are usually loaded from JSON documents like:
+//
+//	{
+//		"monster": {"type": "position|glyph|ai", "data": {"glyph": "m"}},
+//		"goblin": {"extends": "monster", "data": {"glyph": "g", "name": "goblin"}}
+//	}
+type Prefab struct {
+	Extends string                     `json:"extends,omitempty"`
+	Type    string                     `json:"type,omitempty"`
+	Data    map[string]json.RawMessage `json:"data,omitempty"`
+}
+
+// PrefabData is implemented by anything that can set an entity's component
+// data from a prefab's JSON value; DenseStore and SparseStore implement it.
+type PrefabData interface {
+	// Type returns the type bits implied by the data; every entity
+	// instantiated with such data gets them.
+	Type() TypeMask
+
+	// SetPrefabData sets an entity's component data from a JSON value.
+	SetPrefabData(ent Entity, data json.RawMessage) error
+}
+
+// PrefabFunc adapts a function into PrefabData implying the given type bits.
+func PrefabFunc(t TypeBits, f func(Entity, json.RawMessage) error) PrefabData {
+	return prefabFunc{t.Mask(), f}
+}
+
+type prefabFunc struct {
+	t TypeMask
+	f func(Entity, json.RawMessage) error
+}
+
+func (pf prefabFunc) Type() TypeMask                                    { return pf.t }
+func (pf prefabFunc) SetPrefabData(ent Entity, d json.RawMessage) error { return pf.f(ent, d) }
+
+// Prefabs is a collection of named Prefabs that instantiate entities in a
+// Core; data keys must be registered before any prefab using them is
+// instantiated.
+type Prefabs struct {
+	Names *TypeNames // used to parse Prefab types; defaults to DefaultTypeNames
+
+	co       *Core
+	data     map[string]PrefabData
+	defs     map[string]Prefab
+	resolved map[string]*resolvedPrefab
+}
+
+type resolvedPrefab struct {
+	t    TypeMask
+	keys []string
+	data []json.RawMessage
+}
+
+// NewPrefabs creates a new prefab collection that instantiates into the
+// given Core.
+func NewPrefabs(co *Core) *Prefabs {
+	pf := &Prefabs{}
+	pf.Init(co)
+	return pf
+}
+
+// Init ialize the prefab collection; useful for embedding.
+func (pf *Prefabs) Init(co *Core) {
+	pf.co = co
+	pf.data = make(map[string]PrefabData)
+	pf.defs = make(map[string]Prefab)
+	pf.resolved = make(map[string]*resolvedPrefab)
+}
+
+// RegisterData registers a handler for a prefab data key. Panics if the key
+// is already registered.
+func (pf *Prefabs) RegisterData(key string, pd PrefabData) {
+	if _, def := pf.data[key]; def {
+		panic(fmt.Sprintf("prefab data %q already registered", key))
+	}
+	pf.data[key] = pd
+	pf.resolved = make(map[string]*resolvedPrefab)
+}
+
+// Define adds (or replaces) a named prefab.
+func (pf *Prefabs) Define(name string, p Prefab) {
+	pf.defs[name] = p
+	pf.resolved = make(map[string]*resolvedPrefab)
+}
+
+// Load defines every prefab in a JSON document, which maps prefab names to
+// Prefab objects. Prefabs may extend ones defined by a prior, or later, Load.
+func (pf *Prefabs) Load(data []byte) error {
+	var defs map[string]Prefab
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return fmt.Errorf("invalid prefabs: %v", err)
+	}
+	for name, p := range defs {
+		pf.Define(name, p)
+	}
+	return nil
+}
+
+// LoadFile calls Load with the contents of the named file.
+func (pf *Prefabs) LoadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := pf.Load(data); err != nil {
+		return fmt.Errorf("%v: %v", path, err)
+	}
+	return nil
+}
+
+// Has returns true if the named prefab has been defined.
+func (pf *Prefabs) Has(name string) bool {
+	_, def := pf.defs[name]
+	return def
+}
+
+// Type returns the type bits that the named prefab instantiates with.
+func (pf *Prefabs) Type(name string) (TypeMask, error) {
+	rp, err := pf.resolve(name, nil)
+	if err != nil {
+		return TypeMask{}, err
+	}
+	return rp.t, nil
+}
+
+// Check resolves every defined prefab, returning the first error (if any):
+// e.g. an unknown type name, data key, or base prefab, or an inheritance cycle.
+func (pf *Prefabs) Check() error {
+	names := make([]string, 0, len(pf.defs))
+	for name := range pf.defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := pf.resolve(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Instantiate creates a new entity from the named prefab. All creators fire
+// before any data is set, so prefab data overrides any defaults that they set.
+// If setting any data fails, the new entity is destroyed.
+func (pf *Prefabs) Instantiate(name string) (Entity, error) {
+	rp, err := pf.resolve(name, nil)
+	if err != nil {
+		return NilEntity, err
+	}
+	ent := pf.co.AddEntityMask(rp.t)
+	for i, key := range rp.keys {
+		if err := pf.data[key].SetPrefabData(ent, rp.data[i]); err != nil {
+			ent.Destroy()
+			return NilEntity, fmt.Errorf("prefab %q: invalid %q data: %v", name, key, err)
+		}
+	}
+	return ent, nil
+}
+
+// MustInstantiate is like Instantiate, but panics on error.
+func (pf *Prefabs) MustInstantiate(name string) Entity {
+	ent, err := pf.Instantiate(name)
+	if err != nil {
+		panic(err)
+	}
+	return ent
+}
+
+func (pf *Prefabs) resolve(name string, seen []string) (*resolvedPrefab, error) {
+	if rp := pf.resolved[name]; rp != nil {
+		return rp, nil
+	}
+	for _, prior := range seen {
+		if prior == name {
+			return nil, fmt.Errorf("prefab inheritance cycle: %v -> %v",
+				strings.Join(seen, " -> "), name)
+		}
+	}
+	p, def := pf.defs[name]
+	if !def {
+		if len(seen) > 0 {
+			return nil, fmt.Errorf("prefab %q extends unknown prefab %q", seen[len(seen)-1], name)
+		}
+		return nil, fmt.Errorf("unknown prefab %q", name)
+	}
+
+	var (
+		t    TypeMask
+		data = make(map[string]json.RawMessage, len(p.Data))
+	)
+	if p.Extends != "" {
+		base, err := pf.resolve(p.Extends, append(seen, name))
+		if err != nil {
+			return nil, err
+		}
+		t = base.t
+		for i, key := range base.keys {
+			data[key] = base.data[i]
+		}
+	}
+	if p.Type != "" {
+		pt, err := pf.names().ParseMask(p.Type)
+		if err != nil {
+			return nil, fmt.Errorf("prefab %q: %v", name, err)
+		}
+		t = t.Or(pt)
+	}
+	for key, val := range p.Data {
+		data[key] = val
+	}
+
+	rp := &resolvedPrefab{keys: make([]string, 0, len(data))}
+	for key := range data {
+		rp.keys = append(rp.keys, key)
+	}
+	sort.Strings(rp.keys)
+	rp.data = make([]json.RawMessage, len(rp.keys))
+	for i, key := range rp.keys {
+		pd, def := pf.data[key]
+		if !def {
+			return nil, fmt.Errorf("prefab %q: unknown data %q", name, key)
+		}
+		t = t.Or(pd.Type())
+		rp.data[i] = data[key]
+	}
+	if t.IsZero() {
+		return nil, fmt.Errorf("prefab %q has no type", name)
+	}
+	rp.t = t
+	pf.resolved[name] = rp
+	return rp, nil
+}
+
+func (pf *Prefabs) names() *TypeNames {
+	if pf.Names != nil {
+		return pf.Names
+	}
+	return &DefaultTypeNames
+}
+
+// SetPrefabData unmarshals a JSON value, and Sets it for the entity.
+func (ds *DenseStore[T]) SetPrefabData(ent Entity, data json.RawMessage) error {
+	var val T
+	if err := json.Unmarshal(data, &val); err != nil {
+		return err
+	}
+	ds.Set(ent, val)
+	return nil
+}
+
+// SetPrefabData unmarshals a JSON value, and Sets it for the entity.
+func (ss *SparseStore[T]) SetPrefabData(ent Entity, data json.RawMessage) error {
+	var val T
+	if err := json.Unmarshal(data, &val); err != nil {
+		return err
+	}
+	ss.Set(ent, val)
+	return nil
+}
@@ -0,0 +1,113 @@
+package ecs_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/borkshop/bork/internal/ecs"
+)
+
+const (
+	pfMonster ecs.ComponentType = 1 << (iota + 2)
+	pfSolid
+	pfGold
+)
+
+func TestPrefabs(t *testing.T) {
+	n := newNamed()
+	var tn ecs.TypeNames
+	tn.Register("name", stName)
+	tn.Register("tag", stTag)
+	tn.Register("monster", pfMonster)
+	tn.Register("solid", pfSolid)
+
+	var created []ecs.EntityID
+	n.RegisterCreator(stTag, func(id ecs.EntityID, _ ecs.ComponentType) { created = append(created, id) })
+
+	pf := ecs.NewPrefabs(&n.Core)
+	pf.Names = &tn
+	pf.RegisterData("name", &n.name)
+	pf.RegisterData("tag", &n.tag)
+	pf.RegisterData("gold", ecs.PrefabFunc(pfGold, func(ent ecs.Entity, data json.RawMessage) error {
+		var gold int
+		if err := json.Unmarshal(data, &gold); err != nil {
+			return err
+		}
+		if gold < 0 {
+			return errors.New("negative gold")
+		}
+		return nil
+	}))
+	assert.Panics(t, func() { pf.RegisterData("name", &n.name) })
+
+	require.NoError(t, pf.Load([]byte(`{
+		"monster": {"type": "monster|solid", "data": {"name": "monster", "tag": 1}},
+		"goblin": {"extends": "monster", "data": {"name": "goblin", "gold": 3}},
+		"ghost": {"extends": "monster", "type": "0x1"},
+		"rich": {"extends": "goblin", "data": {"gold": 100, "tag": 7}}
+	}`)))
+	require.NoError(t, pf.Check())
+
+	for _, tc := range []struct {
+		prefab string
+		t      ecs.ComponentType
+		name   string
+		tag    int
+	}{
+		{"monster", stName | stTag | pfMonster | pfSolid, "monster", 1},
+		{"goblin", stName | stTag | pfMonster | pfSolid | pfGold, "goblin", 1},
+		{"ghost", stName | stTag | pfMonster | pfSolid, "monster", 1},
+		{"rich", stName | stTag | pfMonster | pfSolid | pfGold, "goblin", 7},
+	} {
+		t.Run(tc.prefab, func(t *testing.T) {
+			created = created[:0]
+			ent, err := pf.Instantiate(tc.prefab)
+			require.NoError(t, err)
+			assert.Equal(t, tc.t, ent.Type())
+			name, _ := n.name.Get(ent)
+			assert.Equal(t, tc.name, name)
+			tag, _ := n.tag.Get(ent)
+			assert.Equal(t, tc.tag, tag)
+			assert.Equal(t, []ecs.EntityID{ent.ID()}, created, "creators fire once")
+		})
+	}
+
+	// later loads may override, or be extended by, earlier prefabs
+	require.NoError(t, pf.Load([]byte(`{"goblin": {"extends": "monster", "data": {"name": "hob"}}}`)))
+	ent := pf.MustInstantiate("rich")
+	assert.Equal(t, stName|stTag|pfMonster|pfSolid|pfGold, ent.Type())
+	name, _ := n.name.Get(ent)
+	assert.Equal(t, "hob", name)
+
+	// errors
+	before := n.Len()
+	require.NoError(t, pf.Load([]byte(`{
+		"loop1": {"extends": "loop2"},
+		"loop2": {"extends": "loop1"},
+		"orphan": {"extends": "nope"},
+		"badType": {"type": "nope"},
+		"badKey": {"type": "solid", "data": {"nope": 1}},
+		"badData": {"type": "solid", "data": {"gold": -1}},
+		"empty": {}
+	}`)))
+	assert.Error(t, pf.Check())
+	for name, mess := range map[string]string{
+		"nope":    `unknown prefab "nope"`,
+		"loop1":   `prefab inheritance cycle: loop1 -> loop2 -> loop1`,
+		"orphan":  `prefab "orphan" extends unknown prefab "nope"`,
+		"badType": `prefab "badType": unknown type name "nope"`,
+		"badKey":  `prefab "badKey": unknown data "nope"`,
+		"badData": `prefab "badData": invalid "gold" data: negative gold`,
+		"empty":   `prefab "empty" has no type`,
+	} {
+		_, err := pf.Instantiate(name)
+		assert.EqualError(t, err, mess, name)
+	}
+	assert.Equal(t, before, n.Len(), "failed instances are destroyed")
+	assert.Panics(t, func() { pf.MustInstantiate("nope") })
+	assert.Error(t, pf.Load([]byte(`[]`)))
+}
@@ -0,0 +1,309 @@
+package ecs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// QueryVar identifies an entity variable within a Query.
+type QueryVar int
+
+// Query joins entities across Cores and Relations: it declares entity
+// variables, and terms that relate them, and then evaluates a nested loop join
+// over every binding of its variables that satisfies all of its terms.
+//
+// Evaluation is planned greedily each time that the query runs: variables are
+// bound first by relation terms that may be answered by an index on an already
+// bound side, then by expansions from bound variables, and only then by
+// scanning the smallest remaining Relation or Core.
+type Query struct {
+	vars  []queryVar
+	terms []queryTerm
+}
+
+type queryVar struct {
+	co    *Core
+	tcl   TypeClause
+	it    Iterator
+	where []func(Entity) bool
+	bound Entity
+}
+
+// queryTerm is either a relation term, binding r to the relation entities
+// between a and b, or an expansion (when rel is nil) from a to b.
+type queryTerm struct {
+	rel     *Relation
+	tcl     TypeClause
+	r, a, b QueryVar
+	expand  func(Entity) []Entity
+}
+
+type queryStepKind uint8
+
+const (
+	queryBind    queryStepKind = iota // check a bound variable
+	queryScan                         // scan a variable's Core or iterator
+	queryRelScan                      // scan a relation
+	queryRelA                         // lookup relations by bound A entity
+	queryRelB                         // lookup relations by bound B entity
+	queryRelR                         // check a bound relation entity
+	queryExpand                       // expand from a bound variable
+)
+
+type queryStep struct {
+	kind queryStepKind
+	v    QueryVar // for bind and scan steps
+	term int      // for all other steps
+}
+
+// NewQuery creates a new empty query.
+func NewQuery() *Query { return &Query{} }
+
+// Entity declares a new variable, ranging over entities in the given Core that
+// match the type clause (nil matches any).
+func (q *Query) Entity(co *Core, tcl TypeClause) QueryVar {
+	q.vars = append(q.vars, queryVar{co: co, tcl: tcl})
+	return QueryVar(len(q.vars) - 1)
+}
+
+// From sets the iterator used whenever the variable is scanned, e.g. an EPS
+// iterator to visit entities in position order; iterated entities must be in
+// the variable's Core, and are still checked against its type clause.
+func (q *Query) From(v QueryVar, it Iterator) {
+	q.vars[v].it = it
+}
+
+// Related declares a new variable, ranging over the entities in the given
+// Relation, matching the type clause (nil matches any), that relate the a
+// variable to the b variable. Panics if the a and b variables do not range
+// over the Relation's A and B Cores.
+func (q *Query) Related(rel *Relation, tcl TypeClause, a, b QueryVar) QueryVar {
+	if q.vars[a].co != rel.aCore || q.vars[b].co != rel.bCore {
+		panic("query variables do not range over the relation's Cores")
+	}
+	r := q.Entity(&rel.Core, tcl)
+	q.terms = append(q.terms, queryTerm{rel: rel, tcl: tcl, r: r, a: a, b: b})
+	return r
+}
+
+// Expand relates the to variable to every entity returned by the given
+// function for the from variable's entity; e.g. those at the same position
+// within an EPS. Only evaluated once from is bound; any returned entities
+// that are in another Core are ignored.
+func (q *Query) Expand(from, to QueryVar, expand func(Entity) []Entity) {
+	q.terms = append(q.terms, queryTerm{a: from, b: to, expand: expand})
+}
+
+// Where adds a predicate that every entity bound to the variable must satisfy.
+func (q *Query) Where(v QueryVar, pred func(Entity) bool) {
+	q.vars[v].where = append(q.vars[v].where, pred)
+}
+
+// Bind fixes the variable to the given entity for any subsequent evaluation;
+// binding NilEntity frees the variable again.
+func (q *Query) Bind(v QueryVar, ent Entity) {
+	q.vars[v].bound = ent
+}
+
+// QueryResult is a binding for every variable in a Query; it is only valid
+// during the Query.Each callback that it is passed to.
+type QueryResult struct {
+	ents []Entity
+}
+
+// Get returns the entity bound to the given variable.
+func (qr QueryResult) Get(v QueryVar) Entity { return qr.ents[v] }
+
+// Each calls the given function with every binding of the query's variables
+// that satisfies all of its terms. The Cores and Relations being queried must
+// not be changed during evaluation.
+func (q *Query) Each(each func(QueryResult)) {
+	res := QueryResult{make([]Entity, len(q.vars))}
+	q.eval(q.plan(), res.ents, func() { each(res) })
+}
+
+// Count returns how many bindings satisfy the query.
+func (q *Query) Count() (n int) {
+	q.Each(func(QueryResult) { n++ })
+	return n
+}
+
+// Plan describes the evaluation order that the query would currently use;
+// variables are named by their declaration order.
+func (q *Query) Plan() string {
+	var parts []string
+	for _, step := range q.plan() {
+		var term queryTerm
+		if step.kind > queryScan {
+			term = q.terms[step.term]
+		}
+		switch step.kind {
+		case queryBind:
+			parts = append(parts, fmt.Sprintf("bind $%d", step.v))
+		case queryScan:
+			parts = append(parts, fmt.Sprintf("scan $%d", step.v))
+		case queryRelScan:
+			parts = append(parts, fmt.Sprintf("scan $%d($%d, $%d)", term.r, term.a, term.b))
+		case queryRelA:
+			parts = append(parts, fmt.Sprintf("lookup $%d($%d, $%d) by A", term.r, term.a, term.b))
+		case queryRelB:
+			parts = append(parts, fmt.Sprintf("lookup $%d($%d, $%d) by B", term.r, term.a, term.b))
+		case queryRelR:
+			parts = append(parts, fmt.Sprintf("check $%d($%d, $%d)", term.r, term.a, term.b))
+		case queryExpand:
+			parts = append(parts, fmt.Sprintf("expand $%d -> $%d", term.a, term.b))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// plan orders evaluation steps by greedily choosing the cheapest next one,
+// estimating the cost of a scan by how many entities it must visit; ties
+// favor terms over variable scans.
+func (q *Query) plan() []queryStep {
+	bound := make([]bool, len(q.vars))
+	done := make([]bool, len(q.terms))
+	var steps []queryStep
+	for v := range q.vars {
+		if q.vars[v].bound != NilEntity {
+			bound[v] = true
+			steps = append(steps, queryStep{kind: queryBind, v: QueryVar(v)})
+		}
+	}
+	for {
+		best, bestCost := queryStep{}, -1
+		consider := func(step queryStep, cost int) {
+			if bestCost < 0 || cost < bestCost {
+				best, bestCost = step, cost
+			}
+		}
+		for i, term := range q.terms {
+			switch {
+			case done[i]:
+			case term.rel == nil:
+				if bound[term.a] {
+					consider(queryStep{kind: queryExpand, term: i}, 1)
+				}
+			case bound[term.r]:
+				consider(queryStep{kind: queryRelR, term: i}, 0)
+			case bound[term.a] && term.rel.aIndex != nil:
+				consider(queryStep{kind: queryRelA, term: i}, 1)
+			case bound[term.b] && term.rel.bIndex != nil:
+				consider(queryStep{kind: queryRelB, term: i}, 1)
+			default:
+				consider(queryStep{kind: queryRelScan, term: i}, len(term.rel.types))
+			}
+		}
+		for v := range q.vars {
+			if !bound[v] {
+				consider(queryStep{kind: queryScan, v: QueryVar(v)}, len(q.vars[v].co.types))
+			}
+		}
+		if bestCost < 0 {
+			return steps
+		}
+		steps = append(steps, best)
+		if best.kind == queryScan {
+			bound[best.v] = true
+		} else {
+			term := q.terms[best.term]
+			done[best.term] = true
+			bound[term.a], bound[term.b] = true, true
+			if term.rel != nil {
+				bound[term.r] = true
+			}
+		}
+	}
+}
+
+func (vr *queryVar) test(ent Entity) bool {
+	if !vr.co.Valid(ent) {
+		return false
+	}
+	if vr.tcl != nil && !vr.tcl.test(vr.co.types[ent.id-1]) {
+		return false
+	}
+	for _, pred := range vr.where {
+		if !pred(ent) {
+			return false
+		}
+	}
+	return true
+}
+
+func (q *Query) eval(steps []queryStep, ents []Entity, each func()) {
+	if len(steps) == 0 {
+		each()
+		return
+	}
+	step := steps[0]
+	next := func() { q.eval(steps[1:], ents, each) }
+	switch step.kind {
+	case queryBind:
+		q.try(ents, next, step.v, q.vars[step.v].bound)
+
+	case queryScan:
+		vr := &q.vars[step.v]
+		it := vr.it
+		if it == nil {
+			it = vr.co.Iter(TrueClause)
+		} else {
+			it.Reset()
+		}
+		for it.Next() {
+			q.try(ents, next, step.v, it.Entity())
+		}
+
+	case queryExpand:
+		term := q.terms[step.term]
+		// copy, since expanders may re-use their result (e.g. EPS.At)
+		for _, ent := range append([]Entity(nil), term.expand(ents[term.a])...) {
+			q.try(ents, next, term.b, ent)
+		}
+
+	case queryRelR:
+		term := q.terms[step.term]
+		r := ents[term.r]
+		if term.tcl == nil || term.tcl.test(term.rel.types[r.id-1]) {
+			q.tryRel(ents, next, term, r, term.rel.A(r), term.rel.B(r))
+		}
+
+	default:
+		term := q.terms[step.term]
+		var opts []CursorOpt
+		if term.tcl != nil {
+			opts = append(opts, term.tcl)
+		}
+		switch step.kind {
+		case queryRelA:
+			opts = append(opts, InA(ents[term.a].id))
+		case queryRelB:
+			opts = append(opts, InB(ents[term.b].id))
+		}
+		for cur := term.rel.Select(opts...); cur.Scan(); {
+			q.tryRel(ents, next, term, cur.R(), cur.A(), cur.B())
+		}
+	}
+}
+
+func (q *Query) tryRel(ents []Entity, next func(), term queryTerm, r, a, b Entity) {
+	q.try(ents, func() {
+		q.try(ents, func() {
+			q.try(ents, next, term.b, b)
+		}, term.a, a)
+	}, term.r, r)
+}
+
+// try binds the variable to the entity, or checks that it is already bound to
+// it, and if so calls next; any new binding is undone afterwards.
+func (q *Query) try(ents []Entity, next func(), v QueryVar, ent Entity) {
+	if cur := ents[v]; cur != NilEntity {
+		if cur == ent {
+			next()
+		}
+	} else if q.vars[v].test(ent) {
+		ents[v] = ent
+		next()
+		ents[v] = NilEntity
+	}
+}
@@ -0,0 +1,74 @@
+package ecs_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/borkshop/bork/internal/ecs"
+)
+
+func qdata(q *ecs.Query, vs ...ecs.QueryVar) (rows [][]int) {
+	q.Each(func(res ecs.QueryResult) {
+		row := make([]int, len(vs))
+		for i, v := range vs {
+			row[i] = int(res.Get(v).ID())
+		}
+		rows = append(rows, row)
+	})
+	return rows
+}
+
+func TestQuery(t *testing.T) {
+	a, b := newStuff(), newStuff()
+	a1, a2, a3 := a.addData(1), a.addData(2), a.addData(3)
+	b1, b2, b3 := b.addData(10), b.addData(20, 1), b.addData(30, 2)
+	rel := ecs.NewRelation(&a.Core, ecs.RelationIndexed, &b.Core, 0)
+	var r12 ecs.Entity
+	rel.Upsert(nil, func(uc *ecs.UpsertCursor) {
+		uc.Create(srFoo, a1, b1)
+		r12 = uc.Create(srFoo, a1, b2)
+		uc.Create(srFoo, a2, b2)
+		uc.Create(srBar, a2, b3)
+		uc.Create(srFoo, a3, b3)
+	})
+
+	// for each a with a foo relation to a b that has d2
+	q := ecs.NewQuery()
+	x := q.Entity(&a.Core, nil)
+	y := q.Entity(&b.Core, scD2.All())
+	r := q.Related(rel, srFoo.All(), x, y)
+	assert.Panics(t, func() { q.Related(rel, nil, y, x) })
+	assert.Equal(t, "scan $0; lookup $2($0, $1) by A", q.Plan())
+	assert.Equal(t, [][]int{{1, 2, 2}, {2, 2, 3}, {3, 3, 5}}, qdata(q, x, y, r))
+
+	// bound variables come first, and are still checked
+	q.Bind(y, b2)
+	assert.Equal(t, "bind $1; scan $0; lookup $2($0, $1) by A", q.Plan())
+	assert.Equal(t, [][]int{{1, 2}, {2, 2}}, qdata(q, x, y))
+	q.Where(x, func(ent ecs.Entity) bool { return ent != a1 })
+	assert.Equal(t, [][]int{{2, 2}}, qdata(q, x, y))
+	q.Bind(y, b1)
+	assert.Equal(t, 0, q.Count())
+	q.Bind(y, ecs.NilEntity)
+	q.Bind(r, r12)
+	assert.Equal(t, "bind $2; check $2($0, $1)", q.Plan())
+	assert.Equal(t, 0, q.Count())
+	q.Bind(r, ecs.NilEntity)
+	assert.Equal(t, [][]int{{2, 2}, {3, 3}}, qdata(q, x, y))
+
+	// destroyed entities drop out
+	b2.Destroy()
+	assert.Equal(t, [][]int{{3, 3}}, qdata(q, x, y))
+
+	// small relations are scanned before large Cores
+	rel2 := ecs.NewRelation(&a.Core, 0, &a.Core, 0)
+	rel2.Upsert(nil, func(uc *ecs.UpsertCursor) { uc.Create(srFoo, a1, a2) })
+	q2 := ecs.NewQuery()
+	x, y = q2.Entity(&a.Core, nil), q2.Entity(&a.Core, nil)
+	z := q2.Entity(&b.Core, nil)
+	q2.Related(rel2, nil, x, y)
+	q2.Related(rel, nil, y, z)
+	assert.Equal(t, "scan $3($0, $1); lookup $4($1, $2) by A", q2.Plan())
+	assert.Equal(t, [][]int{{1, 2, 3}}, qdata(q2, x, y, z))
+}
@@ -8,6 +8,36 @@ const (
 	// destroy related entities within the flagged dimension.
 	RelationCascadeDestroy RelationFlags = 1 << iota
 
+	// RelationIndexed causes the relation to maintain an index of relations
+	// by the flagged dimension's entity IDs. The index is used by InA and InB
+	// cursors, when destroying related entities, and by Graph Roots and
+	// Leaves, making them proportional to the number of matched relations,
+	// rather than all relations.
+	RelationIndexed
+
+	// RelationUnique allows each entity in the flagged dimension to take part
+	// in at most one relation; see Relation.Constrain.
+	RelationUnique
+
+	// RelationUniquePair allows at most one relation between any pair of A
+	// and B entities; see Relation.Constrain.
+	RelationUniquePair
+
+	// RelationCascadeLast is like RelationCascadeDestroy, except that a
+	// related entity is only destroyed once the last relation involving it is
+	// destroyed.
+	RelationCascadeLast
+
+	// RelationForeign marks the flagged dimension's Core as foreign: the
+	// relation does not hook its lifecycle, so any number of relations (e.g.
+	// one per short-lived Core) may cheaply refer into a long-lived Core.
+	// Since destroying a foreign entity doesn't destroy its relations, they
+	// instead keep a generational reference, which becomes stale. Compacting a
+	// foreign Core also stales every reference to a moved entity, unless the
+	// relation's owner passes the Remap to RemapForeign (e.g. from a remapper
+	// of its own, registered on the foreign Core).
+	RelationForeign
+
 	// RelationRestrictDeletes TODO: cannot abort a destroy at present
 )
 
@@ -20,6 +50,12 @@ type Relation struct {
 	aFlag, bFlag RelationFlags
 	aids         []EntityID
 	bids         []EntityID
+	aIndex       relIndex
+	bIndex       relIndex
+	cons         []relConstraint
+	cols         []relColumn
+	agens        []uint32 // only for a RelationForeign A dimension
+	bgens        []uint32 // only for a RelationForeign B dimension
 }
 
 // NewRelation creates a new relation for the given Core systems.
@@ -39,46 +75,204 @@ func (rel *Relation) Init(
 ) {
 	rel.aCore, rel.aFlag = aCore, aFlags
 	rel.bCore, rel.bFlag = bCore, bFlags
+	if aFlags&RelationIndexed != 0 {
+		rel.aIndex = make(relIndex)
+	}
+	if bFlags&RelationIndexed != 0 {
+		rel.bIndex = make(relIndex)
+	}
+	rel.addConstraint(NoMask, aFlags, bFlags)
 	rel.RegisterAllocator(NoType, rel.allocRel)
+	rel.RegisterRemapper(NoType, rel.remapRel)
 	rel.RegisterDestroyer(NoType, rel.destroyRel)
-	rel.aCore.RegisterDestroyer(NoType, rel.destroyFromA)
-	if rel.aCore != rel.bCore {
+	aForeign := aFlags&RelationForeign != 0
+	bForeign := bFlags&RelationForeign != 0
+	if rel.aCore == rel.bCore {
+		if aForeign || bForeign {
+			panic("a relation's Core cannot be foreign to itself")
+		}
+		rel.aCore.RegisterDestroyer(NoType, rel.destroyFromA)
+		rel.aCore.RegisterRemapper(NoType, rel.remapAB)
+		return
+	}
+	if aForeign {
+		rel.agens = make([]uint32, len(rel.aids))
+	} else {
+		rel.aCore.RegisterDestroyer(NoType, rel.destroyFromA)
+		rel.aCore.RegisterRemapper(NoType, rel.remapA)
+	}
+	if bForeign {
+		rel.bgens = make([]uint32, len(rel.bids))
+	} else {
 		rel.bCore.RegisterDestroyer(NoType, rel.destroyFromB)
+		rel.bCore.RegisterRemapper(NoType, rel.remapB)
 	}
 }
 
+// ACore returns the Core that A-side entities belong to.
+func (rel *Relation) ACore() *Core { return rel.aCore }
+
+// BCore returns the Core that B-side entities belong to.
+func (rel *Relation) BCore() *Core { return rel.bCore }
+
 // A returns a reference to the A-side entity for the given relation entity.
 func (rel *Relation) A(ent Entity) Entity {
-	return rel.aCore.Ref(rel.aids[rel.Deref(ent)-1])
+	return rel.aRef(rel.Deref(ent))
 }
 
 // B returns a reference to the B-side entity for the given relation entity.
 func (rel *Relation) B(ent Entity) Entity {
-	return rel.bCore.Ref(rel.bids[rel.Deref(ent)-1])
+	return rel.bRef(rel.Deref(ent))
+}
+
+// aRef returns a reference to the A-side entity of the given relation.
+func (rel *Relation) aRef(rid EntityID) Entity {
+	aid := rel.aids[rid-1]
+	if rel.agens == nil || aid == 0 {
+		return rel.aCore.Ref(aid)
+	}
+	return Entity{rel.aCore, aid, rel.agens[rid-1]}
+}
+
+// bRef returns a reference to the B-side entity of the given relation.
+func (rel *Relation) bRef(rid EntityID) Entity {
+	bid := rel.bids[rid-1]
+	if rel.bgens == nil || bid == 0 {
+		return rel.bCore.Ref(bid)
+	}
+	return Entity{rel.bCore, bid, rel.bgens[rid-1]}
 }
 
 func (rel *Relation) allocRel(id EntityID, t ComponentType) {
 	rel.aids = append(rel.aids, 0)
 	rel.bids = append(rel.bids, 0)
+	if rel.agens != nil {
+		rel.agens = append(rel.agens, 0)
+	}
+	if rel.bgens != nil {
+		rel.bgens = append(rel.bgens, 0)
+	}
+}
+
+func (rel *Relation) remapRel(rm Remap) {
+	rm.Each(func(old, new EntityID) {
+		rel.aids[new-1] = rel.aids[old-1]
+		rel.bids[new-1] = rel.bids[old-1]
+		if rel.agens != nil {
+			rel.agens[new-1] = rel.agens[old-1]
+		}
+		if rel.bgens != nil {
+			rel.bgens[new-1] = rel.bgens[old-1]
+		}
+	})
+	rel.aids = rel.aids[:rm.Len()]
+	rel.bids = rel.bids[:rm.Len()]
+	if rel.agens != nil {
+		rel.agens = rel.agens[:rm.Len()]
+	}
+	if rel.bgens != nil {
+		rel.bgens = rel.bgens[:rm.Len()]
+	}
+	rel.rebuildIndexes()
+}
+
+func (rel *Relation) remapA(rm Remap) {
+	for i, aid := range rel.aids {
+		rel.aids[i] = rm.ID(aid)
+	}
+	if rel.aIndex != nil {
+		rel.aIndex.rebuild(rel.aids)
+	}
+}
+
+func (rel *Relation) remapB(rm Remap) {
+	for i, bid := range rel.bids {
+		rel.bids[i] = rm.ID(bid)
+	}
+	if rel.bIndex != nil {
+		rel.bIndex.rebuild(rel.bids)
+	}
+}
+
+// RemapForeign translates the relation's references into a foreign dimension
+// whose Core was compacted, as described by the given Remap; references that
+// were already stale stay that way. Does nothing if neither foreign dimension
+// is over the Remap's Core.
+func (rel *Relation) RemapForeign(rm Remap) {
+	if rel.agens != nil && rel.aCore == rm.co {
+		remapForeign(rm, rel.aids, rel.agens)
+	}
+	if rel.bgens != nil && rel.bCore == rm.co {
+		remapForeign(rm, rel.bids, rel.bgens)
+	}
+	rel.rebuildIndexes()
+}
+
+func remapForeign(rm Remap, ids []EntityID, gens []uint32) {
+	for i, id := range ids {
+		if ent := rm.Entity(Entity{rm.co, id, gens[i]}); ent != NilEntity {
+			ids[i], gens[i] = ent.id, ent.gen
+		}
+	}
+}
+
+func (rel *Relation) remapAB(rm Remap) {
+	rel.remapA(rm)
+	rel.remapB(rm)
 }
 
 func (rel *Relation) destroyRel(id EntityID, t ComponentType) {
-	i := int(id) - 1
-	if aid := rel.aids[i]; aid != 0 {
-		if rel.aFlag&RelationCascadeDestroy != 0 {
-			rel.aCore.SetType(aid, NoType)
+	if a := rel.aRef(id); a != NilEntity {
+		rel.setA(id, 0)
+		cascade(rel.aFlag, a, rel.aIndex, rel.aids, rel.agens)
+	}
+	if b := rel.bRef(id); b != NilEntity {
+		rel.setB(id, 0)
+		cascade(rel.bFlag, b, rel.bIndex, rel.bids, rel.bgens)
+	}
+}
+
+// cascade destroys an entity that was just unrelated, if so flagged.
+func cascade(flags RelationFlags, ent Entity, ix relIndex, ids []EntityID, gens []uint32) {
+	switch {
+	case flags&RelationCascadeDestroy != 0:
+	case flags&RelationCascadeLast != 0:
+		if related(ent, ix, ids, gens) {
+			return
+		}
+	default:
+		return
+	}
+	if ent.co.Valid(ent) {
+		ent.Destroy()
+	}
+}
+
+// related returns true if any relation still involves the given entity.
+func related(ent Entity, ix relIndex, ids []EntityID, gens []uint32) bool {
+	if ix != nil {
+		for _, rid := range ix[ent.id] {
+			if gens == nil || gens[rid-1] == ent.gen {
+				return true
+			}
 		}
-		rel.aids[i] = 0
+		return false
 	}
-	if bid := rel.bids[i]; bid != 0 {
-		if rel.bFlag&RelationCascadeDestroy != 0 {
-			rel.bCore.SetType(bid, NoType)
+	for i, id := range ids {
+		if id == ent.id && (gens == nil || gens[i] == ent.gen) {
+			return true
 		}
-		rel.bids[i] = 0
 	}
+	return false
 }
 
 func (rel *Relation) destroyFromA(aid EntityID, t ComponentType) {
+	if rel.aIndex != nil {
+		for _, rid := range rel.aIndex.lookup([]EntityID{aid}) {
+			rel.SetType(rid, NoType)
+		}
+		return
+	}
 	for i := range rel.types {
 		if rel.aids[i] == aid {
 			rel.SetType(EntityID(i+1), NoType)
@@ -87,6 +281,12 @@ func (rel *Relation) destroyFromA(aid EntityID, t ComponentType) {
 }
 
 func (rel *Relation) destroyFromB(bid EntityID, t ComponentType) {
+	if rel.bIndex != nil {
+		for _, rid := range rel.bIndex.lookup([]EntityID{bid}) {
+			rel.SetType(rid, NoType)
+		}
+		return
+	}
 	for i := range rel.types {
 		if rel.bids[i] == bid {
 			rel.SetType(EntityID(i+1), NoType)
@@ -165,10 +365,18 @@ func (uc *UpsertCursor) Scan() bool {
 }
 
 // Emit a record, replacing the current, or inserting a new one if the current
-// record has already been updated.
+// record has already been updated. Panics if either entity is stale.
+//
+// Replacing the current record keeps its RelationColumn values, except for any
+// columns whose type is dropped; an inserted record copies them from the
+// current record instead.
 func (uc *UpsertCursor) Emit(er ComponentType, ea, eb Entity) Entity {
 	if uc.any {
-		return uc.Create(er, ea, eb)
+		ent := uc.Create(er, ea, eb)
+		if cur := uc.R(); ent != NilEntity && ent != cur && uc.rel.Valid(cur) {
+			uc.rel.copyColumns(cur.id, ent.id)
+		}
+		return ent
 	}
 	uc.any = true
 	rel := uc.R()
@@ -184,29 +392,55 @@ func (uc *UpsertCursor) Emit(er ComponentType, ea, eb Entity) Entity {
 	if er != rel.Type() {
 		rel.SetType(ComponentType(er))
 	}
-	i := rel.ID() - 1
 	if ea != uc.A() {
-		uc.rel.aids[i] = ea.ID()
+		uc.rel.setA(rel.ID(), uc.rel.aCore.Deref(ea))
 	}
 	if eb != uc.B() {
-		uc.rel.bids[i] = eb.ID()
+		uc.rel.setB(rel.ID(), uc.rel.bCore.Deref(eb))
+	}
+	if len(uc.rel.cons) > 0 {
+		i := rel.ID() - 1
+		for _, rid := range uc.rel.conflicts(er.Mask(), uc.rel.aids[i], uc.rel.bids[i], rel.ID()) {
+			uc.rel.SetType(rid, NoType)
+			uc.m++
+		}
 	}
 	uc.n++
 	return rel
 }
 
 // Create a new relation, ignoring the current; when bulk loading data (no
-// underlying Cursor), this is the prefered method.
+// underlying Cursor), this is the prefered method. Panics if either entity is
+// stale.
+//
+// If the new relation would conflict with any existing relation, under the
+// relation's constraints, then the first conflicting relation is updated and
+// returned instead, and any others are destroyed.
 func (uc *UpsertCursor) Create(r ComponentType, a, b Entity) Entity {
 	if a == NilEntity || b == NilEntity {
 		return NilEntity
 	}
 	aid := uc.rel.aCore.Deref(a)
 	bid := uc.rel.bCore.Deref(b)
+	if len(uc.rel.cons) > 0 {
+		if rids := uc.rel.conflicts(r.Mask(), aid, bid, 0); len(rids) > 0 {
+			for _, rid := range rids[1:] {
+				uc.rel.SetType(rid, NoType)
+				uc.m++
+			}
+			rel := uc.rel.Ref(rids[0])
+			if r != rel.Type() {
+				rel.SetType(r)
+			}
+			uc.rel.setA(rel.ID(), aid)
+			uc.rel.setB(rel.ID(), bid)
+			uc.n++
+			return rel
+		}
+	}
 	rel := uc.rel.AddEntity(ComponentType(r))
-	i := int(rel.ID()) - 1
-	uc.rel.aids[i] = aid
-	uc.rel.bids[i] = bid
+	uc.rel.setA(rel.ID(), aid)
+	uc.rel.setB(rel.ID(), bid)
 	uc.n++
 	return rel
 }
@@ -0,0 +1,225 @@
+package ecs
+
+// Number is any type that may be aggregated by Sum, Min, and Max.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 |
+		~float32 | ~float64
+}
+
+// GroupBy specifies which entities a relation group shares.
+type GroupBy uint8
+
+// GroupBy values for Groups and Relation.Collapse.
+const (
+	GroupByA    GroupBy = 1 << iota // group relations with the same A entity
+	GroupByB                        // group relations with the same B entity
+	GroupByPair = GroupByA | GroupByB
+)
+
+// Group is a Cursor over relations that share an A entity, B entity, or both;
+// the group's scan is independent from the cursor that it was built from.
+type Group struct {
+	a, b Entity
+	rows []groupRow
+	i    int
+}
+
+type groupRow struct{ r, a, b Entity }
+
+// Groups scans all remaining relations in the given cursor, and groups them by
+// A and/or B entity. Groups, and the relations within each, are in scan order.
+func Groups(cur Cursor, by GroupBy) []*Group {
+	type key struct{ a, b Entity }
+	var (
+		groups []*Group
+		index  = make(map[key]*Group)
+	)
+	for cur.Scan() {
+		var k key
+		if by&GroupByA != 0 {
+			k.a = cur.A()
+		}
+		if by&GroupByB != 0 {
+			k.b = cur.B()
+		}
+		g := index[k]
+		if g == nil {
+			g = &Group{a: k.a, b: k.b, i: -1}
+			index[k] = g
+			groups = append(groups, g)
+		}
+		g.rows = append(g.rows, groupRow{cur.R(), cur.A(), cur.B()})
+	}
+	return groups
+}
+
+// Key returns the shared A and B entities; either is NilEntity if the group
+// wasn't grouped by it.
+func (g *Group) Key() (a, b Entity) { return g.a, g.b }
+
+// Len returns how many relations are in the group.
+func (g *Group) Len() int { return len(g.rows) }
+
+// Reset restarts the group's scan.
+func (g *Group) Reset() { g.i = -1 }
+
+// Scan advances to the next relation in the group, skipping any that have
+// been destroyed since grouping.
+func (g *Group) Scan() bool {
+	for g.i++; g.i < len(g.rows); g.i++ {
+		if r := g.rows[g.i].r; r.co.Valid(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Count returns how many relations remain to be scanned.
+func (g *Group) Count() (n int) {
+	for i := g.i + 1; i < len(g.rows); i++ {
+		if r := g.rows[i].r; r.co.Valid(r) {
+			n++
+		}
+	}
+	return n
+}
+
+// R returns the current relation entity.
+func (g *Group) R() Entity { return g.row().r }
+
+// A returns the current relation's A entity.
+func (g *Group) A() Entity { return g.row().a }
+
+// B returns the current relation's B entity.
+func (g *Group) B() Entity { return g.row().b }
+
+func (g *Group) row() groupRow {
+	if g.i < 0 || g.i >= len(g.rows) {
+		return groupRow{NilEntity, NilEntity, NilEntity}
+	}
+	return g.rows[g.i]
+}
+
+// Collapse reduces each group of relations, scanned from the given cursor, to
+// at most one relation: the each function is called once per group, with the
+// upsert cursor on the group's first relation; any relation that it Emits
+// replaces the first, while every other relation in the group is destroyed.
+// Like Upsert, the number of emitted and destroyed relations is returned.
+//
+// Each is passed a fresh scan of the group, so that it may aggregate over the
+// whole group, e.g. with Sum.
+func (rel *Relation) Collapse(cur Cursor, by GroupBy, each func(*UpsertCursor, *Group)) (n, m int) {
+	gc := &groupsCursor{groups: Groups(cur, by)}
+	if len(gc.groups) == 0 {
+		return 0, 0
+	}
+	return rel.Upsert(gc, func(uc *UpsertCursor) {
+		if gc.first {
+			g := *gc.group()
+			g.Reset()
+			each(uc, &g)
+		}
+	})
+}
+
+// Distinct collapses each group of relations, scanned from the given cursor,
+// to its first relation; e.g. GroupByPair removes duplicate relations.
+func (rel *Relation) Distinct(cur Cursor, by GroupBy) (n, m int) {
+	return rel.Collapse(cur, by, func(uc *UpsertCursor, _ *Group) {
+		uc.Emit(uc.R().Type(), uc.A(), uc.B())
+	})
+}
+
+// groupsCursor scans every relation in a list of groups, one group after
+// another.
+type groupsCursor struct {
+	groups []*Group
+	i      int
+	first  bool // true when scanned onto the first relation of a group
+}
+
+func (gc *groupsCursor) group() *Group {
+	if gc.i < len(gc.groups) {
+		return gc.groups[gc.i]
+	}
+	return nil
+}
+
+func (gc *groupsCursor) Scan() bool {
+	for ; gc.i < len(gc.groups); gc.i++ {
+		g := gc.groups[gc.i]
+		first := g.i < 0
+		if g.Scan() {
+			gc.first = first
+			return true
+		}
+	}
+	gc.first = false
+	return false
+}
+
+func (gc groupsCursor) Count() (n int) {
+	for _, g := range gc.groups[gc.i:] {
+		n += g.Count()
+	}
+	return n
+}
+
+func (gc *groupsCursor) R() Entity { return gc.row().r }
+func (gc *groupsCursor) A() Entity { return gc.row().a }
+func (gc *groupsCursor) B() Entity { return gc.row().b }
+
+func (gc *groupsCursor) row() groupRow {
+	if g := gc.group(); g != nil {
+		return g.row()
+	}
+	return groupRow{NilEntity, NilEntity, NilEntity}
+}
+
+// First scans the cursor once, returning the first relation, or NilEntity if
+// there is none.
+func First(cur Cursor) Entity {
+	if cur.Scan() {
+		return cur.R()
+	}
+	return NilEntity
+}
+
+// Sum scans all remaining relations in the cursor, returning the sum of their
+// values; the value function is usually a RelationColumn's Value method.
+func Sum[T Number](cur Cursor, value func(Entity) T) (sum T) {
+	for cur.Scan() {
+		sum += value(cur.R())
+	}
+	return sum
+}
+
+// Min scans all remaining relations in the cursor, returning the first one
+// having the least value, or NilEntity if there are none.
+func Min[T Number](cur Cursor, value func(Entity) T) (Entity, T) {
+	return extreme(cur, value, func(a, b T) bool { return a < b })
+}
+
+// Max scans all remaining relations in the cursor, returning the first one
+// having the greatest value, or NilEntity if there are none.
+func Max[T Number](cur Cursor, value func(Entity) T) (Entity, T) {
+	return extreme(cur, value, func(a, b T) bool { return a > b })
+}
+
+func extreme[T Number](cur Cursor, value func(Entity) T, better func(a, b T) bool) (Entity, T) {
+	best, bestVal := NilEntity, T(0)
+	for cur.Scan() {
+		if r, val := cur.R(), value(cur.R()); best == NilEntity || better(val, bestVal) {
+			best, bestVal = r, val
+		}
+	}
+	return best, bestVal
+}
+
+// Value returns the relation's value, or the zero value if it doesn't have the
+// column's type; useful as a Sum, Min, or Max value function.
+func (col *RelationColumn[T]) Value(ent Entity) T {
+	val, _ := col.Get(ent)
+	return val
+}
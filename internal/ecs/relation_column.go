@@ -0,0 +1,50 @@
+package ecs
+
+// RelationColumn is a DenseStore of data attached to relations (the entities
+// of a Relation's own Core), having the column's type bits; e.g. an amount of
+// damage, or a collision direction.
+//
+// Besides being allocated, remapped, and zeroed like any other DenseStore,
+// column values are copied by UpsertCursor.Emit when it splits an already
+// updated relation into a new one.
+type RelationColumn[T any] struct {
+	DenseStore[T]
+}
+
+// relColumn is implemented by every RelationColumn, letting a Relation copy
+// values between rows without knowing their type.
+type relColumn interface {
+	copyRow(from, to EntityID)
+}
+
+// NewRelationColumn creates a new column attached to the given Relation, using
+// the given type to indicate "has a value".
+func NewRelationColumn[T any](rel *Relation, t TypeBits) *RelationColumn[T] {
+	col := &RelationColumn[T]{}
+	col.Init(rel, t)
+	return col
+}
+
+// Init attaches the column to the given Relation; useful for embedding.
+// Panics if the type is NoType, since every column needs its own type bits.
+func (col *RelationColumn[T]) Init(rel *Relation, t TypeBits) {
+	if t.Mask().IsZero() {
+		panic("relation column must have type bits")
+	}
+	col.DenseStore.Init(&rel.Core, t)
+	rel.cols = append(rel.cols, col)
+}
+
+func (col *RelationColumn[T]) copyRow(from, to EntityID) {
+	if col.core.Mask(from).HasAll(col.t) && col.core.Mask(to).HasAll(col.t) {
+		col.data[to-1] = col.data[from-1]
+	}
+}
+
+// copyColumns copies every column value, shared by both relations' types,
+// from one relation to another.
+func (rel *Relation) copyColumns(from, to EntityID) {
+	for _, col := range rel.cols {
+		col.copyRow(from, to)
+	}
+}
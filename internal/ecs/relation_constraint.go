@@ -0,0 +1,117 @@
+package ecs
+
+import "sort"
+
+// relConstraint limits how many relations, having all of some type bits, may
+// share the same A entity, B entity, or both.
+type relConstraint struct {
+	t        TypeMask
+	aUniq    bool
+	bUniq    bool
+	uniqPair bool
+}
+
+const constraintFlags = RelationUnique | RelationUniquePair
+
+// Constrain adds cardinality constraints over relations having all of the
+// given type bits; NoType constrains every relation, just like passing the
+// flags to Init. Only RelationUnique and RelationUniquePair flags are
+// accepted, any others panic:
+//   - RelationUnique on the A side makes the relation many-to-one: every A
+//     entity has at most one such relation.
+//   - RelationUnique on both sides makes the relation one-to-one.
+//   - RelationUniquePair on either side allows at most one such relation between
+//     any pair of A and B entities.
+//
+// Constraints are enforced by UpsertCursor Create and Emit, by updating or
+// destroying any conflicting relations: Create updates a conflicting relation,
+// rather than creating a new one, while Emit destroys any other conflicting
+// relations. Existing relations are not checked.
+func (rel *Relation) Constrain(t TypeBits, aFlags, bFlags RelationFlags) {
+	if (aFlags|bFlags)&^constraintFlags != 0 {
+		panic("only uniqueness flags may be used as relation constraints")
+	}
+	rel.addConstraint(t.Mask(), aFlags, bFlags)
+}
+
+func (rel *Relation) addConstraint(t TypeMask, aFlags, bFlags RelationFlags) {
+	con := relConstraint{
+		t:        t,
+		aUniq:    aFlags&RelationUnique != 0,
+		bUniq:    bFlags&RelationUnique != 0,
+		uniqPair: (aFlags|bFlags)&RelationUniquePair != 0,
+	}
+	if con.aUniq || con.bUniq || con.uniqPair {
+		rel.cons = append(rel.cons, con)
+	}
+}
+
+func (con relConstraint) covers(t TypeMask) bool {
+	return con.t.IsZero() || t.HasAll(con.t)
+}
+
+// conflicts returns the IDs of any relations that would conflict with a
+// relation of the given type between the given entities; the skip relation is
+// never returned.
+func (rel *Relation) conflicts(t TypeMask, aid, bid, skip EntityID) []EntityID {
+	var rids []EntityID
+	for _, con := range rel.cons {
+		if !con.covers(t) {
+			continue
+		}
+		if con.aUniq {
+			rids = rel.appendConflicts(rids, con.t, aid, 0, skip)
+		}
+		if con.bUniq {
+			rids = rel.appendConflicts(rids, con.t, 0, bid, skip)
+		}
+		if con.uniqPair && !con.aUniq && !con.bUniq {
+			rids = rel.appendConflicts(rids, con.t, aid, bid, skip)
+		}
+	}
+	if len(rids) > 1 {
+		sort.Slice(rids, func(i, j int) bool { return rids[i] < rids[j] })
+		j := 1
+		for _, rid := range rids[1:] {
+			if rid != rids[j-1] {
+				rids[j] = rid
+				j++
+			}
+		}
+		rids = rids[:j]
+	}
+	return rids
+}
+
+// appendConflicts appends the IDs of all relations having the given type, and
+// the given A and/or B entities (0 matches any).
+func (rel *Relation) appendConflicts(rids []EntityID, t TypeMask, aid, bid, skip EntityID) []EntityID {
+	match := func(rid EntityID) bool {
+		i := rid - 1
+		return rid != skip &&
+			!rel.types[i].IsZero() && (t.IsZero() || rel.types[i].HasAll(t)) &&
+			(aid == 0 || rel.aids[i] == aid) &&
+			(bid == 0 || rel.bids[i] == bid)
+	}
+	switch {
+	case aid != 0 && rel.aIndex != nil:
+		for _, rid := range rel.aIndex[aid] {
+			if match(rid) {
+				rids = append(rids, rid)
+			}
+		}
+	case bid != 0 && rel.bIndex != nil:
+		for _, rid := range rel.bIndex[bid] {
+			if match(rid) {
+				rids = append(rids, rid)
+			}
+		}
+	default:
+		for i := range rel.types {
+			if rid := EntityID(i + 1); match(rid) {
+				rids = append(rids, rid)
+			}
+		}
+	}
+	return rids
+}
@@ -37,7 +37,7 @@ func (tco typeClauseOpt) apply(rel *Relation, cur Cursor) Cursor {
 	return filterCursor{Cursor: cur}.with(tco.filter)
 }
 
-func (tco typeClauseOpt) filter(cur Cursor) bool { return tco.test(cur.R().Type()) }
+func (tco typeClauseOpt) filter(cur Cursor) bool { return tco.test(cur.R().Mask()) }
 
 func (tco typeClauseOpt) justApply(rel *Relation, cur Cursor) Cursor {
 	switch impl := cur.(type) {
@@ -49,6 +49,14 @@ func (tco typeClauseOpt) justApply(rel *Relation, cur Cursor) Cursor {
 		impl.it.tcl = and(impl.it.tcl, tco.TypeClause)
 		return impl
 
+	case *indexCursor:
+		if impl.tcl == nil {
+			impl.tcl = tco.TypeClause
+		} else {
+			impl.tcl = and(impl.tcl, tco.TypeClause)
+		}
+		return impl
+
 	case filterCursor:
 		if nc := tco.justApply(rel, impl.Cursor); nc != nil {
 			impl.Cursor = nc
@@ -85,14 +93,37 @@ func InB(ids ...EntityID) CursorOpt {
 type lookupAOpt []EntityID
 type lookupBOpt []EntityID
 
-// TODO indexing support beyond a filter predicate
 func (lko lookupAOpt) apply(rel *Relation, cur Cursor) Cursor {
+	if rel.aIndex != nil {
+		if tcl, ok := indexableCursor(cur); ok {
+			return rel.indexCursor(rel.aIndex, lko, tcl)
+		}
+	}
 	return Filter(lko.filter).apply(rel, cur)
 }
 func (lko lookupBOpt) apply(rel *Relation, cur Cursor) Cursor {
+	if rel.bIndex != nil {
+		if tcl, ok := indexableCursor(cur); ok {
+			return rel.indexCursor(rel.bIndex, lko, tcl)
+		}
+	}
 	return Filter(lko.filter).apply(rel, cur)
 }
 
+// indexableCursor returns true if the given cursor may be replaced by an index
+// cursor, along with any type clause that it was limited to.
+func indexableCursor(cur Cursor) (TypeClause, bool) {
+	switch impl := cur.(type) {
+	case nil:
+		return nil, true
+	case *coreIterCursor:
+		if impl.it.i < 0 { // not yet scanned
+			return impl.it.tcl, true
+		}
+	}
+	return nil, false
+}
+
 func (lko lookupAOpt) filter(cur Cursor) bool {
 	id := cur.A().ID()
 	for _, qid := range lko {
@@ -126,10 +157,10 @@ func (cur coreIterCursor) Count() int {
 
 func (cur *coreIterCursor) Scan() bool {
 	if cur.it.Next() {
-		i := cur.it.ID() - 1
+		rid := cur.it.ID()
 		cur.r = cur.it.Entity()
-		cur.a = cur.rel.aCore.Ref(cur.rel.aids[i])
-		cur.b = cur.rel.aCore.Ref(cur.rel.bids[i])
+		cur.a = cur.rel.aRef(rid)
+		cur.b = cur.rel.bRef(rid)
 		return true
 	}
 	cur.r = NilEntity
@@ -160,6 +191,9 @@ func (f Filter) apply(rel *Relation, cur Cursor) Cursor {
 	case *iterFilterCursor:
 		return impl.with(f)
 
+	case *indexCursor:
+		return impl.with(f)
+
 	case filterCursor:
 		return impl.with(f)
 
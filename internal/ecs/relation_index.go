@@ -0,0 +1,163 @@
+package ecs
+
+import "sort"
+
+// relIndex maps A-side (or B-side) entity IDs to the sorted IDs of every
+// relation that they take part in.
+type relIndex map[EntityID][]EntityID
+
+func (ix relIndex) add(id, rid EntityID) {
+	if id == 0 {
+		return
+	}
+	rids := ix[id]
+	i := sort.Search(len(rids), func(i int) bool { return rids[i] >= rid })
+	if i < len(rids) && rids[i] == rid {
+		return
+	}
+	rids = append(rids, 0)
+	copy(rids[i+1:], rids[i:])
+	rids[i] = rid
+	ix[id] = rids
+}
+
+func (ix relIndex) remove(id, rid EntityID) {
+	rids := ix[id]
+	i := sort.Search(len(rids), func(i int) bool { return rids[i] >= rid })
+	if i >= len(rids) || rids[i] != rid {
+		return
+	}
+	if len(rids) == 1 {
+		delete(ix, id)
+		return
+	}
+	ix[id] = append(rids[:i], rids[i+1:]...)
+}
+
+// lookup returns the (sorted, de-duplicated) relation IDs involving any of the
+// given entity IDs; the result is a copy, safe to hold while mutating.
+func (ix relIndex) lookup(ids []EntityID) []EntityID {
+	if len(ids) == 1 {
+		return append([]EntityID(nil), ix[ids[0]]...)
+	}
+	var rids []EntityID
+	for _, id := range ids {
+		rids = append(rids, ix[id]...)
+	}
+	sort.Slice(rids, func(i, j int) bool { return rids[i] < rids[j] })
+	j := 0
+	for i, rid := range rids {
+		if i == 0 || rid != rids[j-1] {
+			rids[j] = rid
+			j++
+		}
+	}
+	return rids[:j]
+}
+
+func (ix relIndex) rebuild(ids []EntityID) {
+	for id := range ix {
+		delete(ix, id)
+	}
+	for i, id := range ids {
+		ix.add(id, EntityID(i+1))
+	}
+}
+
+// setA changes the A-side of the given relation, maintaining any index, and
+// any foreign generation.
+func (rel *Relation) setA(rid, aid EntityID) {
+	if rel.aIndex != nil {
+		rel.aIndex.remove(rel.aids[rid-1], rid)
+		rel.aIndex.add(aid, rid)
+	}
+	rel.aids[rid-1] = aid
+	if rel.agens != nil {
+		rel.agens[rid-1] = 0
+		if aid != 0 {
+			rel.agens[rid-1] = rel.aCore.gens[aid-1]
+		}
+	}
+}
+
+// setB changes the B-side of the given relation, maintaining any index, and
+// any foreign generation.
+func (rel *Relation) setB(rid, bid EntityID) {
+	if rel.bIndex != nil {
+		rel.bIndex.remove(rel.bids[rid-1], rid)
+		rel.bIndex.add(bid, rid)
+	}
+	rel.bids[rid-1] = bid
+	if rel.bgens != nil {
+		rel.bgens[rid-1] = 0
+		if bid != 0 {
+			rel.bgens[rid-1] = rel.bCore.gens[bid-1]
+		}
+	}
+}
+
+func (rel *Relation) rebuildIndexes() {
+	if rel.aIndex != nil {
+		rel.aIndex.rebuild(rel.aids)
+	}
+	if rel.bIndex != nil {
+		rel.bIndex.rebuild(rel.bids)
+	}
+}
+
+// indexCursor scans the relations found by an index lookup.
+type indexCursor struct {
+	rel  *Relation
+	tcl  TypeClause
+	rids []EntityID
+	fs   []func(Cursor) bool
+	i    int
+	r    Entity
+	a    Entity
+	b    Entity
+}
+
+func (rel *Relation) indexCursor(ix relIndex, ids []EntityID, tcl TypeClause) *indexCursor {
+	return &indexCursor{rel: rel, tcl: tcl, rids: ix.lookup(ids)}
+}
+
+func (cur indexCursor) with(f func(Cursor) bool) Cursor {
+	cur.fs = append(cur.fs[:len(cur.fs):len(cur.fs)], f)
+	return &cur
+}
+
+func (cur indexCursor) Count() (n int) {
+	for cur.Scan() {
+		n++
+	}
+	return n
+}
+
+func (cur *indexCursor) Scan() bool {
+scan:
+	for cur.i < len(cur.rids) {
+		rid := cur.rids[cur.i]
+		cur.i++
+		t := cur.rel.types[rid-1]
+		if t.IsZero() || (cur.tcl != nil && !cur.tcl.test(t)) {
+			continue
+		}
+		cur.r = cur.rel.Ref(rid)
+		cur.a = cur.rel.aRef(rid)
+		cur.b = cur.rel.bRef(rid)
+		for _, f := range cur.fs {
+			if !f(cur) {
+				continue scan
+			}
+		}
+		return true
+	}
+	cur.r = NilEntity
+	cur.a = NilEntity
+	cur.b = NilEntity
+	return false
+}
+
+func (cur indexCursor) R() Entity { return cur.r }
+func (cur indexCursor) A() Entity { return cur.a }
+func (cur indexCursor) B() Entity { return cur.b }
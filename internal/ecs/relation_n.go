@@ -0,0 +1,450 @@
+package ecs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Dim specifies one entity dimension of an NRelation: the Core that its
+// entities come from, and any RelationCascadeDestroy, RelationCascadeLast, or
+// RelationForeign flags; other flags are not supported.
+type Dim struct {
+	Core  *Core
+	Flags RelationFlags
+}
+
+const nRelationFlags = RelationCascadeDestroy | RelationCascadeLast | RelationForeign
+
+// NRelation is a generalized Relation between any number of entities, each
+// from its own dimension's (maybe shared) Core; e.g. "attacker hit target with
+// part", or "container holds item in slot". Like a Relation, each relation is
+// an entity in the NRelation's own Core.
+//
+// Unlike a Relation, an NRelation has no indexes, so In cursor options, and
+// destroying related entities, are proportional to the number of relations.
+type NRelation struct {
+	Core
+	dims []nDim
+}
+
+type nDim struct {
+	Dim
+	ids  []EntityID
+	gens []uint32 // only for a RelationForeign dimension
+}
+
+// NewNRelation creates a new n-ary relation between the given dimensions.
+func NewNRelation(dims ...Dim) *NRelation {
+	rel := &NRelation{}
+	rel.Init(dims...)
+	return rel
+}
+
+// Init initializes the n-ary relation; useful for embedding. Panics if there
+// are fewer than two dimensions, or if any has unsupported flags.
+func (rel *NRelation) Init(dims ...Dim) {
+	if len(dims) < 2 {
+		panic("an n-ary relation needs at least two dimensions")
+	}
+	rel.dims = make([]nDim, len(dims))
+	hooked := make(map[*Core]bool, len(dims))
+	for i, dim := range dims {
+		if dim.Flags&^nRelationFlags != 0 {
+			panic(fmt.Sprintf("unsupported n-ary relation dimension %v flags", i))
+		}
+		rel.dims[i].Dim = dim
+		if dim.Flags&RelationForeign != 0 {
+			rel.dims[i].gens = []uint32{}
+		} else if !hooked[dim.Core] {
+			hooked[dim.Core] = true
+			co := dim.Core
+			co.RegisterDestroyer(NoType, func(id EntityID, _ ComponentType) { rel.destroyFrom(co, id) })
+			co.RegisterRemapper(NoType, func(rm Remap) { rel.remapFrom(co, rm) })
+		}
+	}
+	rel.RegisterAllocator(NoType, rel.allocRel)
+	rel.RegisterRemapper(NoType, rel.remapRel)
+	rel.RegisterDestroyer(NoType, rel.destroyRel)
+}
+
+// Arity returns how many dimensions the relation has.
+func (rel *NRelation) Arity() int { return len(rel.dims) }
+
+// DimCore returns the Core of the i-th dimension.
+func (rel *NRelation) DimCore(i int) *Core { return rel.dims[i].Core }
+
+// Get returns a reference to the i-th entity of the given relation entity.
+func (rel *NRelation) Get(ent Entity, i int) Entity {
+	return rel.ref(i, rel.Deref(ent))
+}
+
+func (rel *NRelation) ref(i int, rid EntityID) Entity {
+	dim := &rel.dims[i]
+	id := dim.ids[rid-1]
+	if dim.gens == nil || id == 0 {
+		return dim.Core.Ref(id)
+	}
+	return Entity{dim.Core, id, dim.gens[rid-1]}
+}
+
+func (rel *NRelation) set(i int, rid, id EntityID) {
+	dim := &rel.dims[i]
+	dim.ids[rid-1] = id
+	if dim.gens != nil {
+		dim.gens[rid-1] = 0
+		if id != 0 {
+			dim.gens[rid-1] = dim.Core.gens[id-1]
+		}
+	}
+}
+
+func (rel *NRelation) allocRel(id EntityID, t ComponentType) {
+	for i := range rel.dims {
+		dim := &rel.dims[i]
+		dim.ids = append(dim.ids, 0)
+		if dim.gens != nil {
+			dim.gens = append(dim.gens, 0)
+		}
+	}
+}
+
+func (rel *NRelation) remapRel(rm Remap) {
+	for i := range rel.dims {
+		dim := &rel.dims[i]
+		rm.Each(func(old, new EntityID) {
+			dim.ids[new-1] = dim.ids[old-1]
+			if dim.gens != nil {
+				dim.gens[new-1] = dim.gens[old-1]
+			}
+		})
+		dim.ids = dim.ids[:rm.Len()]
+		if dim.gens != nil {
+			dim.gens = dim.gens[:rm.Len()]
+		}
+	}
+}
+
+func (rel *NRelation) remapFrom(co *Core, rm Remap) {
+	for i := range rel.dims {
+		if dim := &rel.dims[i]; dim.Core == co && dim.gens == nil {
+			for j, id := range dim.ids {
+				dim.ids[j] = rm.ID(id)
+			}
+		}
+	}
+}
+
+func (rel *NRelation) destroyRel(id EntityID, t ComponentType) {
+	for i := range rel.dims {
+		if ent := rel.ref(i, id); ent != NilEntity {
+			rel.set(i, id, 0)
+			dim := &rel.dims[i]
+			cascade(dim.Flags, ent, nil, dim.ids, dim.gens)
+		}
+	}
+}
+
+func (rel *NRelation) destroyFrom(co *Core, id EntityID) {
+	for i := range rel.dims {
+		if dim := &rel.dims[i]; dim.Core == co && dim.gens == nil {
+			for j, did := range dim.ids {
+				if did == id {
+					rel.SetType(EntityID(j+1), NoType)
+				}
+			}
+		}
+	}
+}
+
+// NCursor iterates through an NRelation.
+type NCursor interface {
+	Scan() bool
+	Count() int
+	R() Entity
+	At(i int) Entity
+}
+
+// NCursorOpt specifies which relational entities are scanned by an NRelation
+// cursor; TypeClause implements it.
+type NCursorOpt interface {
+	applyN(*nCursor)
+}
+
+func (cc constClause) applyN(cur *nCursor)     { cur.where(cc) }
+func (t allClause) applyN(cur *nCursor)        { cur.where(t) }
+func (t anyClause) applyN(cur *nCursor)        { cur.where(t) }
+func (t notAllClause) applyN(cur *nCursor)     { cur.where(t) }
+func (t notAnyClause) applyN(cur *nCursor)     { cur.where(t) }
+func (tcls andClause) applyN(cur *nCursor)     { cur.where(tcls) }
+func (tcls orClause) applyN(cur *nCursor)      { cur.where(tcls) }
+func (f NFilter) applyN(cur *nCursor)          { cur.fs = append(cur.fs, f) }
+func (lko lookupNOpt) applyN(cur *nCursor)     { cur.fs = append(cur.fs, lko.filter) }
+func (cur *nCursor) where(tcl TypeClause)      { cur.it.tcl = and(cur.it.tcl, tcl) }
+func (lko lookupNOpt) filter(cur NCursor) bool { return lko.has(cur.At(lko.i).ID()) }
+
+// NFilter is an NCursorOpt that applies a filtering predicate function to an
+// NRelation cursor.
+type NFilter func(NCursor) bool
+
+// In returns an NRelation cursor option that limits the cursor to relations
+// involving one or more given entities in the i-th dimension.
+func In(i int, ids ...EntityID) NCursorOpt {
+	return lookupNOpt{i, ids}
+}
+
+type lookupNOpt struct {
+	i   int
+	ids []EntityID
+}
+
+func (lko lookupNOpt) has(id EntityID) bool {
+	for _, qid := range lko.ids {
+		if qid == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Select creates a cursor with the given options applied; with no options,
+// every relation is scanned.
+func (rel *NRelation) Select(opts ...NCursorOpt) NCursor {
+	cur := &nCursor{
+		rel:  rel,
+		it:   *(rel.Iter(TrueClause).(*coreIterator)),
+		ents: make([]Entity, len(rel.dims)),
+	}
+	for _, opt := range opts {
+		opt.applyN(cur)
+	}
+	return cur
+}
+
+type nCursor struct {
+	rel  *NRelation
+	it   coreIterator
+	fs   []func(NCursor) bool
+	r    Entity
+	ents []Entity
+}
+
+func (cur *nCursor) Scan() bool {
+scan:
+	for cur.it.Next() {
+		if cur.it.co.types[cur.it.i].IsZero() {
+			continue
+		}
+		rid := cur.it.ID()
+		cur.r = cur.it.Entity()
+		for i := range cur.ents {
+			cur.ents[i] = cur.rel.ref(i, rid)
+		}
+		for _, f := range cur.fs {
+			if !f(cur) {
+				continue scan
+			}
+		}
+		return true
+	}
+	cur.r = NilEntity
+	for i := range cur.ents {
+		cur.ents[i] = NilEntity
+	}
+	return false
+}
+
+func (cur nCursor) Count() (n int) {
+	cur.ents = make([]Entity, len(cur.ents))
+	for cur.Scan() {
+		n++
+	}
+	return n
+}
+
+func (cur *nCursor) R() Entity       { return cur.r }
+func (cur *nCursor) At(i int) Entity { return cur.ents[i] }
+
+// Upsert updates any relations that the given cursor iterates, and may insert
+// new ones; just like Relation.Upsert.
+func (rel *NRelation) Upsert(cur NCursor, each func(*NUpsertCursor)) (n, m int) {
+	if each == nil {
+		for cur.Scan() {
+			cur.R().Destroy()
+			m++
+		}
+		return n, m
+	}
+
+	uc := NUpsertCursor{rel: rel, NCursor: cur}
+	if cur == nil {
+		each(&uc)
+	} else {
+		any := false
+		for uc.Scan() {
+			any = true
+			each(&uc)
+		}
+		if !any {
+			each(&uc)
+		}
+	}
+	return uc.n, uc.m
+}
+
+// NUpsertCursor allows inserting, updating, and deleting n-ary relations.
+type NUpsertCursor struct {
+	NCursor
+	rel  *NRelation
+	last Entity
+	any  bool
+	n, m int
+}
+
+// Scan advances the underlying cursor; but first, it destroys the last scanned
+// relation if no updated record was emitted.
+func (uc *NUpsertCursor) Scan() bool {
+	if uc.last != NilEntity && !uc.any {
+		uc.last.Destroy()
+		uc.m++
+	}
+	uc.any = false
+	if uc.NCursor.Scan() {
+		uc.last = uc.R()
+		return true
+	}
+	uc.last = NilEntity
+	return false
+}
+
+// R returns the current relation entity, or NilEntity if there's no
+// underlying cursor.
+func (uc *NUpsertCursor) R() Entity {
+	if uc.NCursor == nil {
+		return NilEntity
+	}
+	return uc.NCursor.R()
+}
+
+// Emit a record, replacing the current, or inserting a new one if the current
+// record has already been updated. Panics if given the wrong number of
+// entities, or if any entity is stale.
+func (uc *NUpsertCursor) Emit(er ComponentType, ents ...Entity) Entity {
+	if uc.any {
+		return uc.Create(er, ents...)
+	}
+	uc.any = true
+	rel := uc.R()
+	if rel == NilEntity {
+		return uc.Create(er, ents...)
+	}
+	ids := uc.rel.deref(ents)
+	if er == NoType || ids == nil {
+		rel.Destroy()
+		uc.m++
+		uc.last = NilEntity
+		return NilEntity
+	}
+	if er != rel.Type() {
+		rel.SetType(er)
+	}
+	for i, id := range ids {
+		uc.rel.set(i, rel.id, id)
+	}
+	uc.n++
+	return rel
+}
+
+// Create a new relation, ignoring the current; when bulk loading data (no
+// underlying cursor), this is the prefered method. Panics if given the wrong
+// number of entities, or if any entity is stale.
+func (uc *NUpsertCursor) Create(r ComponentType, ents ...Entity) Entity {
+	ids := uc.rel.deref(ents)
+	if ids == nil {
+		return NilEntity
+	}
+	rel := uc.rel.AddEntity(r)
+	for i, id := range ids {
+		uc.rel.set(i, rel.id, id)
+	}
+	uc.n++
+	return rel
+}
+
+// deref returns the ID of every given entity, or nil if any is NilEntity.
+func (rel *NRelation) deref(ents []Entity) []EntityID {
+	if len(ents) != len(rel.dims) {
+		panic(fmt.Sprintf("n-ary relation needs %v entities, got %v", len(rel.dims), len(ents)))
+	}
+	ids := make([]EntityID, len(ents))
+	for i, ent := range ents {
+		if ent == NilEntity {
+			return nil
+		}
+		ids[i] = rel.dims[i].Core.Deref(ent)
+	}
+	return ids
+}
+
+type nRelationSnapshot struct {
+	Core json.RawMessage `json:"core"`
+	IDs  [][]EntityID    `json:"ids"`
+	Gens [][]uint32      `json:"gens"`
+}
+
+// SaveSnapshot saves the relation's own Core, and the entity IDs of every
+// relation (and their generations, for any foreign dimension); the dimension
+// Cores must be saved separately.
+func (rel *NRelation) SaveSnapshot() ([]byte, error) {
+	rs := nRelationSnapshot{
+		IDs:  make([][]EntityID, len(rel.dims)),
+		Gens: make([][]uint32, len(rel.dims)),
+	}
+	var err error
+	if rs.Core, err = rel.Core.SaveSnapshot(); err != nil {
+		return nil, err
+	}
+	for i, dim := range rel.dims {
+		rs.IDs[i], rs.Gens[i] = dim.ids, dim.gens
+	}
+	return json.Marshal(rs)
+}
+
+// LoadSnapshot restores the relation into an empty NRelation; the dimension
+// Cores must already have been loaded. The snapshot is checked against the
+// relation's dimensions before anything is loaded.
+func (rel *NRelation) LoadSnapshot(data []byte) error {
+	var rs nRelationSnapshot
+	if err := json.Unmarshal(data, &rs); err != nil {
+		return err
+	}
+	var cs coreSnapshot
+	if err := json.Unmarshal(rs.Core, &cs); err != nil {
+		return err
+	}
+	if len(rs.IDs) != len(rel.dims) || len(rs.Gens) != len(rel.dims) {
+		return errors.New("mismatched n-ary relation snapshot arity")
+	}
+	n := len(cs.Types)
+	for i, dim := range rel.dims {
+		if len(rs.IDs[i]) != n {
+			return errors.New("mismatched n-ary relation snapshot size")
+		}
+		if (dim.gens == nil) != (rs.Gens[i] == nil) || (dim.gens != nil && len(rs.Gens[i]) != n) {
+			return errors.New("mismatched n-ary relation snapshot generations")
+		}
+		for j, id := range rs.IDs[i] {
+			if !validRef(dim.Core, id, dim.gens != nil) {
+				return fmt.Errorf("n-ary relation snapshot %v references unknown entities", j+1)
+			}
+		}
+	}
+	if err := rel.Core.LoadSnapshot(rs.Core); err != nil {
+		return err
+	}
+	for i := range rel.dims {
+		copy(rel.dims[i].ids, rs.IDs[i])
+		copy(rel.dims[i].gens, rs.Gens[i])
+	}
+	return nil
+}
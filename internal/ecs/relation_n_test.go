@@ -0,0 +1,136 @@
+package ecs_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/borkshop/bork/internal/ecs"
+)
+
+func ndata(cur ecs.NCursor) (rows [][3]int) {
+	for cur.Scan() {
+		var row [3]int
+		for i := range row {
+			if ent := cur.At(i); ent != ecs.NilEntity {
+				row[i] = int(ent.ID())
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestNRelation(t *testing.T) {
+	// attacker hit target with part
+	world, parts := newStuff(), newStuff()
+	w1, w2, w3 := world.addData(1), world.addData(2), world.addData(3)
+	p1, p2 := parts.addData(1), parts.addData(2)
+	hits := ecs.NewNRelation(
+		ecs.Dim{Core: &world.Core},
+		ecs.Dim{Core: &world.Core},
+		ecs.Dim{Core: &parts.Core, Flags: ecs.RelationCascadeLast},
+	)
+	assert.Equal(t, 3, hits.Arity())
+	assert.Equal(t, &parts.Core, hits.DimCore(2))
+	assert.Panics(t, func() { ecs.NewNRelation(ecs.Dim{Core: &world.Core}) })
+	assert.Panics(t, func() {
+		ecs.NewNRelation(ecs.Dim{Core: &world.Core}, ecs.Dim{Core: &parts.Core, Flags: ecs.RelationIndexed})
+	})
+
+	var h1 ecs.Entity
+	n, _ := hits.Upsert(nil, func(uc *ecs.NUpsertCursor) {
+		h1 = uc.Create(srFoo, w1, w2, p1)
+		uc.Create(srFoo, w2, w1, p2)
+		uc.Create(srBar, w3, w1, p1)
+		assert.Equal(t, ecs.NilEntity, uc.Create(srFoo, w3, ecs.NilEntity, p2))
+		assert.Panics(t, func() { uc.Create(srFoo, w1, w2) })
+	})
+	assert.Equal(t, 3, n)
+	assert.Equal(t, w2, hits.Get(h1, 1))
+
+	assert.Equal(t, 3, hits.Select().Count())
+	assert.Equal(t, [][3]int{{1, 2, 1}, {2, 1, 2}}, ndata(hits.Select(srFoo.All())))
+	assert.Equal(t, [][3]int{{2, 1, 2}, {3, 1, 1}}, ndata(hits.Select(ecs.In(1, w1.ID()))))
+	assert.Equal(t, [][3]int{{3, 1, 1}}, ndata(hits.Select(ecs.In(2, p1.ID()), ecs.In(1, 1, 3))))
+	assert.Equal(t, 1, hits.Select(srBar.All(), ecs.NFilter(func(cur ecs.NCursor) bool {
+		return cur.At(0) == w3
+	})).Count())
+
+	// emit updates, splits, and destroys unemitted relations
+	n, m := hits.Upsert(hits.Select(srFoo.All(), ecs.In(0, w1.ID(), w2.ID())), func(uc *ecs.NUpsertCursor) {
+		if uc.At(0) == w1 {
+			uc.Emit(srBar, w1, w3, uc.At(2))
+			uc.Emit(srBar, w1, w2, p2)
+		}
+	})
+	assert.Equal(t, [2]int{2, 1}, [2]int{n, m})
+	assert.Equal(t, [][3]int{{1, 3, 1}, {3, 1, 1}, {1, 2, 2}}, ndata(hits.Select()))
+
+	// destroying an entity destroys its relations, and the last relation
+	// involving a part cascades
+	w3.Destroy()
+	assert.Equal(t, [][3]int{{1, 2, 2}}, ndata(hits.Select()))
+	assert.False(t, parts.Valid(p1))
+	assert.True(t, parts.Valid(p2))
+	w1.Destroy()
+	assert.True(t, hits.Empty())
+	assert.False(t, parts.Valid(p2))
+}
+
+func TestNRelation_snapshot(t *testing.T) {
+	world, slots := newStuff(), newStuff()
+	box, sword, shield := world.addData(1), world.addData(2), world.addData(3)
+	hand, back := slots.addData(1), slots.addData(2)
+	newHolds := func() *ecs.NRelation {
+		return ecs.NewNRelation(
+			ecs.Dim{Core: &world.Core},
+			ecs.Dim{Core: &world.Core, Flags: ecs.RelationCascadeDestroy},
+			ecs.Dim{Core: &slots.Core, Flags: ecs.RelationForeign},
+		)
+	}
+
+	// container holds item in slot
+	holds := newHolds()
+	holds.Upsert(nil, func(uc *ecs.NUpsertCursor) {
+		uc.Create(srFoo, box, sword, hand)
+		uc.Create(srFoo, box, shield, back)
+	})
+	back.Destroy()
+	assert.Equal(t, 2, holds.Len(), "foreign references go stale")
+	cur := holds.Select(ecs.In(1, shield.ID()))
+	require.True(t, cur.Scan())
+	assert.False(t, slots.Valid(cur.At(2)))
+
+	data, err := holds.SaveSnapshot()
+	require.NoError(t, err)
+	holds2 := newHolds()
+	require.NoError(t, holds2.LoadSnapshot(data))
+	assert.Equal(t, ndata(holds.Select()), ndata(holds2.Select()))
+	cur = holds2.Select(ecs.In(1, shield.ID()))
+	require.True(t, cur.Scan())
+	assert.False(t, slots.Valid(cur.At(2)), "generations are restored")
+	assert.Error(t, ecs.NewNRelation(ecs.Dim{Core: &world.Core}, ecs.Dim{Core: &world.Core}).LoadSnapshot(data))
+	holds3 := ecs.NewNRelation(ecs.Dim{Core: &world.Core}, ecs.Dim{Core: &world.Core}, ecs.Dim{Core: &slots.Core})
+	assert.Error(t, holds3.LoadSnapshot(data))
+	assert.Equal(t, 0, holds3.Len(), "nothing is loaded from a mismatched snapshot")
+
+	// taking an item out of its container destroys it
+	holds.Upsert(holds.Select(ecs.In(1, sword.ID())), nil)
+	assert.False(t, world.Valid(sword))
+	assert.True(t, world.Valid(box))
+
+	// snapshots referencing negative IDs, or dead entities (like the sword, by
+	// now), are rejected
+	var raw map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(data, &raw))
+	raw["ids"] = json.RawMessage(`[[1, 1], [-2, 3], [1, 2]]`)
+	bad, err := json.Marshal(raw)
+	require.NoError(t, err)
+	assert.Error(t, newHolds().LoadSnapshot(bad))
+	holds4 := newHolds()
+	assert.Error(t, holds4.LoadSnapshot(data))
+	assert.Equal(t, 0, holds4.Len())
+}
@@ -0,0 +1,127 @@
+package ecs
+
+import "sort"
+
+// SortByR, SortByA, and SortByB are cursor options that order relations by
+// relation, A, or B entity ID.
+//
+// Consecutive sort options order relations lexicographically: the first is the
+// primary order, with ties broken by the next, and so on; any remaining ties
+// keep the underlying cursor's order.
+var (
+	SortByR CursorOpt = sortOpt(func(x, y *groupRow) bool { return x.r.id < y.r.id })
+	SortByA CursorOpt = sortOpt(func(x, y *groupRow) bool { return x.a.id < y.a.id })
+	SortByB CursorOpt = sortOpt(func(x, y *groupRow) bool { return x.b.id < y.b.id })
+)
+
+// SortFunc returns a cursor option that orders relations by the given less
+// function over relation entities; e.g. by a RelationColumn value, or by the
+// distance between A and B entities. The sort is stable.
+func SortFunc(less func(r1, r2 Entity) bool) CursorOpt {
+	return sortOpt(func(x, y *groupRow) bool { return less(x.r, y.r) })
+}
+
+// Limit returns a cursor option that scans at most n relations; after any
+// sort option, this selects the top-N.
+func Limit(n int) CursorOpt { return limitOpt(n) }
+
+type sortOpt func(x, y *groupRow) bool
+type limitOpt int
+
+func (so sortOpt) apply(rel *Relation, cur Cursor) Cursor {
+	if cur == nil {
+		cur = TrueClause.apply(rel, nil)
+	}
+	if sc, ok := cur.(*sortedCursor); ok && sc.rows == nil && sc.limit < 0 {
+		sc.less = append(sc.less, so)
+		return sc
+	}
+	return &sortedCursor{src: cur, less: []sortOpt{so}, limit: -1}
+}
+
+func (lo limitOpt) apply(rel *Relation, cur Cursor) Cursor {
+	if cur == nil {
+		cur = TrueClause.apply(rel, nil)
+	}
+	if sc, ok := cur.(*sortedCursor); ok && sc.rows == nil {
+		if sc.limit < 0 || int(lo) < sc.limit {
+			sc.limit = int(lo)
+		}
+		return sc
+	}
+	return &sortedCursor{src: cur, limit: int(lo)}
+}
+
+// sortedCursor scans all of its source cursor's relations on the first Scan,
+// and then sorts them; its limit applies as it scans, so that relations
+// destroyed since the first scan don't count against it.
+type sortedCursor struct {
+	src     Cursor
+	less    []sortOpt // in order of precedence
+	limit   int       // < 0 means no limit
+	rows    []groupRow
+	i       int
+	scanned int // how many valid relations have been scanned
+}
+
+func (sc *sortedCursor) load() {
+	if sc.rows != nil {
+		return
+	}
+	sc.rows = []groupRow{}
+	for sc.src.Scan() {
+		sc.rows = append(sc.rows, groupRow{sc.src.R(), sc.src.A(), sc.src.B()})
+	}
+	for i := len(sc.less) - 1; i >= 0; i-- {
+		less := sc.less[i]
+		sort.SliceStable(sc.rows, func(i, j int) bool { return less(&sc.rows[i], &sc.rows[j]) })
+	}
+	sc.i = -1
+}
+
+// Scan advances to the next relation in order, skipping any that have been
+// destroyed since the first scan, until the limit (if any) is reached.
+func (sc *sortedCursor) Scan() bool {
+	sc.load()
+	if sc.limit >= 0 && sc.scanned >= sc.limit {
+		sc.i = len(sc.rows)
+		return false
+	}
+	for sc.i++; sc.i < len(sc.rows); sc.i++ {
+		if r := sc.rows[sc.i].r; r.co.Valid(r) {
+			sc.scanned++
+			return true
+		}
+	}
+	return false
+}
+
+func (sc *sortedCursor) Count() (n int) {
+	if sc.rows == nil {
+		n = sc.src.Count()
+		if sc.limit >= 0 && sc.limit < n {
+			n = sc.limit
+		}
+		return n
+	}
+	for i := sc.i + 1; i < len(sc.rows); i++ {
+		if r := sc.rows[i].r; r.co.Valid(r) {
+			n++
+		}
+	}
+	if sc.limit >= 0 && sc.limit-sc.scanned < n {
+		n = sc.limit - sc.scanned
+	}
+	return n
+}
+
+func (sc *sortedCursor) R() Entity { return sc.row().r }
+func (sc *sortedCursor) A() Entity { return sc.row().a }
+func (sc *sortedCursor) B() Entity { return sc.row().b }
+
+func (sc *sortedCursor) row() groupRow {
+	if sc.rows == nil || sc.i < 0 || sc.i >= len(sc.rows) {
+		return groupRow{NilEntity, NilEntity, NilEntity}
+	}
+	return sc.rows[sc.i]
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/borkshop/bork/internal/ecs"
 )
@@ -12,6 +13,7 @@ import (
 const (
 	srFoo ecs.ComponentType = 1 << iota
 	srBar
+	srOther
 )
 
 func setupRelTest(aFlags, bFlags ecs.RelationFlags) (a, b *stuff, rel *ecs.Relation) {
@@ -123,6 +125,379 @@ func TestRelation_Select(t *testing.T) {
 	}.run(t)
 }
 
+func TestRelation_indexed(t *testing.T) {
+	_, _, plain := setupRelTest(0, 0)
+	a, b, r := setupRelTest(ecs.RelationIndexed, ecs.RelationIndexed)
+
+	same := func(opts ...ecs.CursorOpt) {
+		var want, got [][2]ecs.EntityID
+		for cur := plain.Select(opts...); cur.Scan(); {
+			want = append(want, [2]ecs.EntityID{cur.A().ID(), cur.B().ID()})
+		}
+		cur := r.Select(opts...)
+		assert.Equal(t, len(want), cur.Count())
+		for cur.Scan() {
+			got = append(got, [2]ecs.EntityID{cur.A().ID(), cur.B().ID()})
+		}
+		assert.Equal(t, want, got)
+	}
+	same(ecs.InA(1, 5, 7, 9))
+	same(ecs.InB(6, 7, 8, 9))
+	same(ecs.InA(2, 3), srBar.All())
+	same(srBar.All(), ecs.InA(2, 3))
+	same(srBar.All(), ecs.InA(2, 3), ecs.InB(1))
+	same(ecs.InB(3), ecs.Filter(func(cur ecs.Cursor) bool { return cur.A().ID() > 6 }))
+
+	// updating a relation's A side moves it in the index
+	r.Upsert(r.Select(srBar.All(), ecs.InA(2)), func(uc *ecs.UpsertCursor) {
+		uc.Emit(srBar, a.Ref(8), uc.B())
+	})
+	assert.Equal(t, 0, r.Select(srBar.All(), ecs.InA(2)).Count())
+	assert.Equal(t, []ecs.EntityID{1}, collectBIDs(r.Select(ecs.InA(8))))
+
+	// destroying entities destroys their relations
+	n := r.Len()
+	a.Ref(3).Destroy()
+	b.Ref(2).Destroy()
+	assert.Equal(t, n-6, r.Len())
+	assert.Equal(t, 0, r.Select(ecs.InA(3)).Count())
+	assert.Equal(t, 0, r.Select(ecs.InB(2)).Count())
+	assert.Equal(t, []ecs.EntityID{4, 5}, collectBIDs(r.Select(ecs.InA(2))))
+
+	// compaction rebuilds indexes
+	rm := a.Compact()
+	r.Compact()
+	a8 := rm.ID(8)
+	assert.Equal(t, []ecs.EntityID{1}, collectBIDs(r.Select(ecs.InA(a8))))
+	assert.Equal(t, []ecs.EntityID{1, rm.ID(6), rm.ID(7)}, collectAIDs(r.Select(ecs.InB(3))))
+}
+
+func TestRelation_constraints(t *testing.T) {
+	for _, index := range []ecs.RelationFlags{0, ecs.RelationIndexed} {
+		a, b := newStuff(), newStuff()
+		a1, a2 := a.addData(1), a.addData(2)
+		b1, b2 := b.addData(1), b.addData(2)
+		rel := ecs.NewRelation(&a.Core, index, &b.Core, index)
+		rel.Constrain(srFoo, ecs.RelationUnique, 0)
+		rel.Constrain(srBar, ecs.RelationUnique, ecs.RelationUnique)
+		assert.Panics(t, func() { rel.Constrain(srBar, ecs.RelationCascadeDestroy, 0) })
+
+		pairs := func(tcl ecs.TypeClause) (ps [][2]ecs.EntityID) {
+			for cur := rel.Select(tcl); cur.Scan(); {
+				ps = append(ps, [2]ecs.EntityID{cur.A().ID(), cur.B().ID()})
+			}
+			return ps
+		}
+
+		// many-to-one: creating updates the conflicting relation
+		var r1, r2 ecs.Entity
+		rel.Upsert(nil, func(uc *ecs.UpsertCursor) {
+			r1 = uc.Create(srFoo, a1, b1)
+			r2 = uc.Create(srFoo, a1, b2)
+			uc.Create(srFoo, a2, b2)
+		})
+		assert.Equal(t, r1, r2)
+		assert.Equal(t, [][2]ecs.EntityID{{1, 2}, {2, 2}}, pairs(srFoo.All()))
+
+		// one-to-one: a conflict on each side destroys the extra relation
+		rel.Upsert(nil, func(uc *ecs.UpsertCursor) {
+			uc.Create(srBar, a1, b1)
+			uc.Create(srBar, a2, b2)
+		})
+		n, m := rel.Upsert(nil, func(uc *ecs.UpsertCursor) { uc.Create(srBar, a1, b2) })
+		assert.Equal(t, 1, n)
+		assert.Equal(t, 1, m)
+		assert.Equal(t, [][2]ecs.EntityID{{1, 2}}, pairs(srBar.All()))
+
+		// emit destroys any other conflicting relation
+		rel.Upsert(rel.Select(srFoo.All(), ecs.InA(2)), func(uc *ecs.UpsertCursor) {
+			uc.Emit(srFoo, a1, uc.B())
+		})
+		assert.Equal(t, [][2]ecs.EntityID{{1, 2}}, pairs(srFoo.All()))
+
+		// unconstrained types are unaffected
+		rel.Upsert(nil, func(uc *ecs.UpsertCursor) {
+			uc.Create(srFoo|srBar, a1, b1) // ...but this one is constrained twice
+			uc.Create(srOther, a1, b1)
+			uc.Create(srOther, a1, b1)
+		})
+		assert.Equal(t, [][2]ecs.EntityID{{1, 1}}, pairs(srFoo.All()))
+		assert.Equal(t, [][2]ecs.EntityID{{1, 1}}, pairs(srBar.All()))
+		assert.Equal(t, 2, rel.Select(srOther.All()).Count())
+
+		// unique pairs
+		pr := ecs.NewRelation(&a.Core, ecs.RelationUniquePair|index, &b.Core, 0)
+		pr.Upsert(nil, func(uc *ecs.UpsertCursor) {
+			uc.Create(srFoo, a1, b1)
+			uc.Create(srBar, a1, b1)
+			uc.Create(srFoo, a1, b2)
+			uc.Create(srFoo, a2, b1)
+		})
+		assert.Equal(t, 3, pr.Len())
+		cur := pr.Select(ecs.InA(1), ecs.InB(1))
+		assert.True(t, cur.Scan())
+		assert.Equal(t, srBar, cur.R().Type())
+		assert.False(t, cur.Scan())
+	}
+}
+
+func TestRelation_foreign(t *testing.T) {
+	for _, index := range []ecs.RelationFlags{0, ecs.RelationIndexed} {
+		world := newStuff()
+		spirit := world.addData(1)
+		other := world.addData(2)
+
+		// many short-lived cores may relate into the same world core
+		parts := newStuff()
+		p1, p2, p3 := parts.addData(1), parts.addData(2), parts.addData(3)
+		rel := ecs.NewRelation(&parts.Core, 0,
+			&world.Core, ecs.RelationForeign|ecs.RelationCascadeLast|index)
+		rel.Upsert(nil, func(uc *ecs.UpsertCursor) {
+			uc.Create(srFoo, p1, spirit)
+			uc.Create(srFoo, p2, spirit)
+			uc.Create(srFoo, p3, other)
+		})
+
+		// the last relation cascades
+		p1.Destroy()
+		assert.True(t, world.Valid(spirit))
+		p2.Destroy()
+		assert.False(t, world.Valid(spirit))
+		assert.True(t, world.Valid(other))
+
+		// destroying a foreign entity leaves a stale reference
+		other.Destroy()
+		reused := world.addData(3)
+		assert.Equal(t, other.ID(), reused.ID())
+		cur := rel.Select(srFoo.All())
+		assert.True(t, cur.Scan())
+		assert.Equal(t, p3, cur.A())
+		assert.False(t, world.Valid(cur.B()), "stale")
+		assert.Equal(t, ecs.NoType, cur.B().Type())
+		p3.Destroy()
+		assert.True(t, world.Valid(reused), "stale references don't cascade")
+		assert.True(t, rel.Empty())
+
+		// references survive compacting the foreign core, once remapped
+		gone, kept := world.addData(4), world.addData(5)
+		p4 := parts.addData(4)
+		rel.Upsert(nil, func(uc *ecs.UpsertCursor) { uc.Create(srFoo, p4, kept) })
+		gone.Destroy()
+		rm := world.Compact()
+		require.False(t, world.Valid(kept), "moved")
+		rel.RemapForeign(rm)
+		cur = rel.Select(srFoo.All())
+		require.True(t, cur.Scan())
+		assert.Equal(t, rm.Entity(kept), cur.B())
+		assert.True(t, world.Valid(cur.B()))
+		assert.Equal(t, 5, world.d1[cur.B().ID()])
+	}
+
+	s := newStuff()
+	assert.Panics(t, func() { ecs.NewRelation(&s.Core, ecs.RelationForeign, &s.Core, 0) })
+}
+
+func TestRelation_columns(t *testing.T) {
+	a, b := newStuff(), newStuff()
+	a1, a2 := a.addData(1), a.addData(2)
+	b1, b2 := b.addData(1), b.addData(2)
+	rel := ecs.NewRelation(&a.Core, 0, &b.Core, 0)
+	amount := ecs.NewRelationColumn[int](rel, srBar)
+	assert.Panics(t, func() { ecs.NewRelationColumn[int](rel, ecs.NoType) })
+
+	var r1, r2 ecs.Entity
+	rel.Upsert(nil, func(uc *ecs.UpsertCursor) {
+		r1 = uc.Create(srFoo|srBar, a1, b1)
+		r2 = uc.Create(srFoo, a2, b2)
+	})
+	amount.Set(r1, 5)
+	amount.Set(r2, 7)
+	assert.Equal(t, srFoo|srBar, r2.Type(), "setting adds the column type")
+
+	// emit keeps values when updating, and copies them when splitting
+	rel.Upsert(rel.Select(srFoo.All(), ecs.InA(1)), func(uc *ecs.UpsertCursor) {
+		uc.Emit(uc.R().Type(), uc.A(), b2)
+		split := uc.Emit(srOther|srBar, uc.A(), b1)
+		assert.NotEqual(t, r1, split)
+		*amount.Ptr(split)++
+	})
+	for cur := rel.Select(srBar.All()); cur.Scan(); {
+		n, ok := amount.Get(cur.R())
+		assert.True(t, ok)
+		switch [2]ecs.EntityID{cur.A().ID(), cur.B().ID()} {
+		case [2]ecs.EntityID{1, 2}:
+			assert.Equal(t, 5, n)
+		case [2]ecs.EntityID{1, 1}:
+			assert.Equal(t, 6, n)
+		case [2]ecs.EntityID{2, 2}:
+			assert.Equal(t, 7, n)
+		default:
+			t.Errorf("unexpected relation %v", cur.R())
+		}
+	}
+
+	// dropping the column type zeroes its value
+	rel.Upsert(rel.Select(ecs.InA(2)), func(uc *ecs.UpsertCursor) {
+		uc.Emit(srFoo, uc.A(), uc.B())
+	})
+	_, ok := amount.Get(r2)
+	assert.False(t, ok)
+	rel.Upsert(rel.Select(ecs.InA(2)), func(uc *ecs.UpsertCursor) {
+		uc.Emit(srFoo|srBar, uc.A(), uc.B())
+	})
+	n, _ := amount.Get(r2)
+	assert.Equal(t, 0, n)
+
+	// new relations start out zeroed, even when reusing an ID
+	r1.Destroy()
+	var r3 ecs.Entity
+	rel.Upsert(nil, func(uc *ecs.UpsertCursor) { r3 = uc.Create(srBar, a2, b1) })
+	assert.Equal(t, r1.ID(), r3.ID())
+	n, _ = amount.Get(r3)
+	assert.Equal(t, 0, n)
+}
+
+func TestRelation_aggregate(t *testing.T) {
+	a, b := newStuff(), newStuff()
+	a1, a2 := a.addData(1), a.addData(2)
+	b1, b2 := b.addData(1), b.addData(2)
+	rel := ecs.NewRelation(&a.Core, 0, &b.Core, 0)
+	amount := ecs.NewRelationColumn[int](rel, srBar)
+	rel.Upsert(nil, func(uc *ecs.UpsertCursor) {
+		for _, row := range []struct {
+			a, b ecs.Entity
+			n    int
+		}{
+			{a1, b1, 3},
+			{a1, b2, 1},
+			{a2, b1, 4},
+			{a1, b1, 5},
+			{a2, b1, 2},
+		} {
+			amount.Set(uc.Create(srFoo, row.a, row.b), row.n)
+		}
+	})
+
+	assert.Equal(t, 15, ecs.Sum(rel.Select(srFoo.All()), amount.Value))
+	r, n := ecs.Max(rel.Select(srFoo.All(), ecs.InB(1)), amount.Value)
+	assert.Equal(t, [3]int{5, 1, 1}, [3]int{n, int(rel.A(r).ID()), int(rel.B(r).ID())})
+	r, n = ecs.Min(rel.Select(srFoo.All()), amount.Value)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, b2, rel.B(r))
+	r, n = ecs.Min(rel.Select(srOther.All()), amount.Value)
+	assert.Equal(t, ecs.NilEntity, r)
+	assert.Equal(t, ecs.NilEntity, ecs.First(rel.Select(srOther.All())))
+
+	var sums [][3]int
+	for _, g := range ecs.Groups(rel.Select(srFoo.All()), ecs.GroupByA) {
+		ga, gb := g.Key()
+		assert.Equal(t, ecs.NilEntity, gb)
+		sums = append(sums, [3]int{int(ga.ID()), g.Len(), ecs.Sum(g, amount.Value)})
+	}
+	assert.Equal(t, [][3]int{{1, 3, 9}, {2, 2, 6}}, sums)
+
+	// collapse groups of relations into one, summing their amounts
+	n, m := rel.Collapse(rel.Select(srFoo.All()), ecs.GroupByPair, func(uc *ecs.UpsertCursor, g *ecs.Group) {
+		ga, gb := g.Key()
+		assert.Equal(t, [2]ecs.Entity{ga, gb}, [2]ecs.Entity{uc.A(), uc.B()})
+		sum := ecs.Sum(g, amount.Value)
+		amount.Set(uc.Emit(uc.R().Type(), uc.A(), uc.B()), sum)
+	})
+	assert.Equal(t, 3, n)
+	assert.Equal(t, 2, m)
+	sums = sums[:0]
+	for cur := rel.Select(srFoo.All()); cur.Scan(); {
+		sums = append(sums, [3]int{int(cur.A().ID()), int(cur.B().ID()), amount.Value(cur.R())})
+	}
+	assert.Equal(t, [][3]int{{1, 1, 8}, {1, 2, 1}, {2, 1, 6}}, sums)
+
+	// distinct keeps the first relation of each group
+	n, m = rel.Distinct(rel.Select(srFoo.All()), ecs.GroupByB)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 1, m)
+	assert.Equal(t, 1, rel.Select(srFoo.All(), ecs.InB(1)).Count())
+	n, m = rel.Distinct(rel.Select(srOther.All()), ecs.GroupByB)
+	assert.Equal(t, [2]int{0, 0}, [2]int{n, m})
+}
+
+func TestRelation_sorted(t *testing.T) {
+	a, b := newStuff(), newStuff()
+	a1, a2, a3 := a.addData(1), a.addData(2), a.addData(3)
+	b1, b2 := b.addData(1), b.addData(2)
+	rel := ecs.NewRelation(&a.Core, 0, &b.Core, 0)
+	amount := ecs.NewRelationColumn[int](rel, srBar)
+	rel.Upsert(nil, func(uc *ecs.UpsertCursor) {
+		amount.Set(uc.Create(srFoo, a3, b1), 2)
+		amount.Set(uc.Create(srFoo, a1, b2), 5)
+		amount.Set(uc.Create(srFoo, a2, b1), 2)
+		amount.Set(uc.Create(srFoo, a1, b1), 1)
+	})
+	byAmount := ecs.SortFunc(func(r1, r2 ecs.Entity) bool { return amount.Value(r1) > amount.Value(r2) })
+
+	scan := func(cur ecs.Cursor) (abs [][2]ecs.EntityID) {
+		for cur.Scan() {
+			abs = append(abs, [2]ecs.EntityID{cur.A().ID(), cur.B().ID()})
+		}
+		return abs
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts []ecs.CursorOpt
+		n    int
+		abs  [][2]ecs.EntityID
+	}{
+		{"storage order", []ecs.CursorOpt{srFoo.All()},
+			4, [][2]ecs.EntityID{{3, 1}, {1, 2}, {2, 1}, {1, 1}}},
+		{"by A", []ecs.CursorOpt{srFoo.All(), ecs.SortByA},
+			4, [][2]ecs.EntityID{{1, 2}, {1, 1}, {2, 1}, {3, 1}}},
+		{"by A then B", []ecs.CursorOpt{ecs.SortByA, ecs.SortByB},
+			4, [][2]ecs.EntityID{{1, 1}, {1, 2}, {2, 1}, {3, 1}}},
+		{"by B then R", []ecs.CursorOpt{ecs.SortByB, ecs.SortByR},
+			4, [][2]ecs.EntityID{{3, 1}, {2, 1}, {1, 1}, {1, 2}}},
+		{"by amount, then A", []ecs.CursorOpt{byAmount, ecs.SortByA},
+			4, [][2]ecs.EntityID{{1, 2}, {2, 1}, {3, 1}, {1, 1}}},
+		{"top 2", []ecs.CursorOpt{byAmount, ecs.SortByA, ecs.Limit(2)},
+			2, [][2]ecs.EntityID{{1, 2}, {2, 1}}},
+		{"top 2 in B", []ecs.CursorOpt{ecs.InB(1), byAmount, ecs.Limit(2)},
+			2, [][2]ecs.EntityID{{3, 1}, {2, 1}}},
+		{"limited then sorted", []ecs.CursorOpt{ecs.Limit(2), ecs.SortByA},
+			2, [][2]ecs.EntityID{{1, 2}, {3, 1}}},
+		{"sorted then filtered", []ecs.CursorOpt{ecs.SortByA, ecs.InB(1)},
+			-1, // filtered counts may over-count
+			[][2]ecs.EntityID{{1, 1}, {2, 1}, {3, 1}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cur := rel.Select(tc.opts...)
+			if tc.n >= 0 {
+				assert.Equal(t, tc.n, cur.Count())
+			}
+			assert.Equal(t, tc.abs, scan(cur))
+		})
+	}
+
+	// upserting through a sorted cursor skips destroyed relations
+	var seen []ecs.EntityID
+	rel.Upsert(rel.Select(ecs.SortByA), func(uc *ecs.UpsertCursor) {
+		seen = append(seen, uc.A().ID())
+		if uc.A() == a1 {
+			a2.Destroy()
+		}
+		uc.Emit(uc.R().Type(), uc.A(), uc.B())
+	})
+	assert.Equal(t, []ecs.EntityID{1, 1, 3}, seen)
+
+	// a limit only counts relations that are still there when scanned
+	cur := rel.Select(ecs.SortByA, ecs.SortByB, ecs.Limit(2))
+	require.True(t, cur.Scan())
+	assert.Equal(t, [2]ecs.EntityID{1, 1}, [2]ecs.EntityID{cur.A().ID(), cur.B().ID()})
+	assert.Equal(t, 1, cur.Count())
+	b2.Destroy()
+	assert.Equal(t, 1, cur.Count())
+	assert.Equal(t, [][2]ecs.EntityID{{3, 1}}, scan(cur))
+	assert.Equal(t, 0, cur.Count())
+}
+
 func TestRelation_destruction(t *testing.T) {
 	testCases{
 		{"clear A", func(t *testing.T) {
@@ -0,0 +1,347 @@
+package ecs
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Phase is a coarse stage of a Schedule's processing round; every proc in an
+// earlier phase runs before any proc in a later phase.
+type Phase uint8
+
+// Phases in the order that they run.
+const (
+	PhaseInput Phase = iota
+	PhaseSimulate
+	PhaseResolve
+	PhaseRender
+	numPhases
+)
+
+var phaseNames = [numPhases]string{"input", "simulate", "resolve", "render"}
+
+func (ph Phase) String() string {
+	if ph < numPhases {
+		return phaseNames[ph]
+	}
+	return fmt.Sprintf("Phase(%d)", uint8(ph))
+}
+
+// ProcSpec declares a named Proc within a Schedule.
+type ProcSpec struct {
+	Name  string
+	Phase Phase
+	Proc  Proc
+
+	// Before and After name other procs that this proc must run before or
+	// after; they must be in the same phase, or in a phase that agrees with
+	// the ordering.
+	Before []string
+	After  []string
+
+	// Reads and Writes declare which component types the proc accesses; a proc
+	// that declares neither is assumed to access everything. When a Schedule
+	// runs in Parallel, only procs that merely read may run concurrently: a
+	// proc that writes anything always runs alone, since writing (e.g. adding
+	// a component) changes state shared across a whole Core, like its entity
+	// types, free list, and Views, which any other proc iterating the same
+	// Core reads, whatever types it declares.
+	Reads  TypeMask
+	Writes TypeMask
+}
+
+func (spec ProcSpec) conflicts(other ProcSpec) bool {
+	if spec.undeclared() || other.undeclared() {
+		return true
+	}
+	return !spec.Writes.IsZero() || !other.Writes.IsZero()
+}
+
+func (spec ProcSpec) undeclared() bool {
+	return spec.Reads.IsZero() && spec.Writes.IsZero()
+}
+
+// Schedule is a Proc that runs named procs in phase order, and in dependency
+// order within each phase; procs with no dependency between them run in the
+// order that they were added. Procs may be disabled and re-enabled at runtime.
+type Schedule struct {
+	// Hook, if non-nil, is called after every proc runs with its name and how
+	// long it took; e.g. perf.Perf.RecordProc. Hook is always called from the
+	// goroutine running the Schedule, in schedule order.
+	Hook func(name string, elapsed time.Duration)
+
+	// Parallel causes consecutive procs in the same phase to run concurrently,
+	// so long as their declared component access doesn't conflict, and there's
+	// no dependency between them. Leave it false for a deterministic (e.g.
+	// replayable) run: every proc then runs serially in schedule order.
+	Parallel bool
+
+	procs   []*schedProc
+	byName  map[string]*schedProc
+	order   []*schedProc
+	batches [][]*schedProc
+	dirty   bool
+}
+
+type schedProc struct {
+	ProcSpec
+	i        int
+	disabled bool
+	after    []*schedProc
+	elapsed  time.Duration
+	panicked interface{}
+}
+
+// Add a proc to the schedule; panics if it has no name or Proc, or if its
+// name is already taken. Dependencies are resolved lazily, so they may name
+// procs that are added later.
+func (sch *Schedule) Add(spec ProcSpec) {
+	if spec.Name == "" || spec.Proc == nil {
+		panic("invalid proc spec")
+	}
+	if spec.Phase >= numPhases {
+		panic("invalid proc phase")
+	}
+	if _, def := sch.byName[spec.Name]; def {
+		panic(fmt.Sprintf("duplicate proc %q", spec.Name))
+	}
+	if sch.byName == nil {
+		sch.byName = make(map[string]*schedProc)
+	}
+	sp := &schedProc{ProcSpec: spec, i: len(sch.procs)}
+	sch.procs = append(sch.procs, sp)
+	sch.byName[spec.Name] = sp
+	sch.dirty = true
+}
+
+// AddFunc is a convenience for adding a ProcFunc with no dependencies.
+func (sch *Schedule) AddFunc(name string, phase Phase, fn func()) {
+	sch.Add(ProcSpec{Name: name, Phase: phase, Proc: ProcFunc(fn)})
+}
+
+// Enable or disable the named proc; returns false if there is no such proc.
+func (sch *Schedule) Enable(name string, enabled bool) bool {
+	sp, def := sch.byName[name]
+	if def {
+		sp.disabled = !enabled
+	}
+	return def
+}
+
+// Enabled returns true only if the named proc exists and is enabled.
+func (sch *Schedule) Enabled(name string) bool {
+	sp, def := sch.byName[name]
+	return def && !sp.disabled
+}
+
+// Order returns the names of all procs in the order that they run, including
+// any that are disabled; returns an error for unknown or cyclic dependencies.
+func (sch *Schedule) Order() ([]string, error) {
+	if err := sch.resolve(); err != nil {
+		return nil, err
+	}
+	names := make([]string, len(sch.order))
+	for i, sp := range sch.order {
+		names[i] = sp.Name
+	}
+	return names, nil
+}
+
+// Process runs every enabled proc in order; panics if the schedule's
+// dependencies cannot be resolved.
+func (sch *Schedule) Process() {
+	if err := sch.resolve(); err != nil {
+		panic(err.Error())
+	}
+	if !sch.Parallel {
+		for _, sp := range sch.order {
+			if !sp.disabled {
+				sch.run(sp)
+			}
+		}
+		return
+	}
+	for _, batch := range sch.batches {
+		sch.runBatch(batch)
+	}
+}
+
+func (sch *Schedule) run(sp *schedProc) {
+	if sch.Hook == nil {
+		sp.Proc.Process()
+		return
+	}
+	start := time.Now()
+	sp.Proc.Process()
+	sch.Hook(sp.Name, time.Since(start))
+}
+
+func (sch *Schedule) runBatch(batch []*schedProc) {
+	n := 0
+	for _, sp := range batch {
+		if !sp.disabled {
+			n++
+		}
+	}
+	if n <= 1 {
+		for _, sp := range batch {
+			if !sp.disabled {
+				sch.run(sp)
+			}
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for _, sp := range batch {
+		if sp.disabled {
+			continue
+		}
+		go func(sp *schedProc) {
+			defer wg.Done()
+			defer func() { sp.panicked = recover() }()
+			start := time.Now()
+			sp.Proc.Process()
+			sp.elapsed = time.Since(start)
+		}(sp)
+	}
+	wg.Wait()
+
+	for _, sp := range batch {
+		if sp.disabled {
+			continue
+		}
+		if p := sp.panicked; p != nil {
+			sp.panicked = nil
+			panic(p)
+		}
+		if sch.Hook != nil {
+			sch.Hook(sp.Name, sp.elapsed)
+		}
+	}
+}
+
+func (sch *Schedule) resolve() error {
+	if !sch.dirty {
+		return nil
+	}
+
+	// collect edges, checking that cross-phase ones agree with phase order
+	after := make([][]*schedProc, len(sch.procs)) // after[i] must run before i
+	edge := func(first, then *schedProc) error {
+		if first.Phase > then.Phase {
+			return fmt.Errorf("proc %q (%v) cannot run before %q (%v)",
+				first.Name, first.Phase, then.Name, then.Phase)
+		}
+		if first.Phase == then.Phase {
+			after[then.i] = append(after[then.i], first)
+		}
+		return nil
+	}
+	for _, sp := range sch.procs {
+		for _, name := range sp.After {
+			dep, def := sch.byName[name]
+			if !def {
+				return fmt.Errorf("proc %q runs after unknown proc %q", sp.Name, name)
+			}
+			if err := edge(dep, sp); err != nil {
+				return err
+			}
+		}
+		for _, name := range sp.Before {
+			dep, def := sch.byName[name]
+			if !def {
+				return fmt.Errorf("proc %q runs before unknown proc %q", sp.Name, name)
+			}
+			if err := edge(sp, dep); err != nil {
+				return err
+			}
+		}
+	}
+
+	// stable topological sort: repeatedly take the earliest added proc, in
+	// the earliest phase, whose dependencies have all been taken
+	order := make([]*schedProc, 0, len(sch.procs))
+	done := make([]bool, len(sch.procs))
+	for ph := Phase(0); ph < numPhases; ph++ {
+		for {
+			var next *schedProc
+			pending := false
+		search:
+			for _, sp := range sch.procs {
+				if sp.Phase != ph || done[sp.i] {
+					continue
+				}
+				pending = true
+				for _, dep := range after[sp.i] {
+					if !done[dep.i] {
+						continue search
+					}
+				}
+				next = sp
+				break
+			}
+			if next == nil {
+				if pending {
+					return sch.cycleError(ph, done)
+				}
+				break
+			}
+			done[next.i] = true
+			order = append(order, next)
+		}
+	}
+
+	for _, sp := range sch.procs {
+		sp.after = after[sp.i]
+	}
+	sch.order = order
+	sch.batches = batchProcs(order)
+	sch.dirty = false
+	return nil
+}
+
+// batchProcs groups consecutive procs in the same phase that may run concurrently.
+// Since order is topological, any indirect dependency between two procs in a
+// run passes through a proc between them, so only direct ones need checking.
+func batchProcs(order []*schedProc) (batches [][]*schedProc) {
+	var cur []*schedProc
+	for _, sp := range order {
+		if len(cur) > 0 && !canJoin(cur, sp) {
+			batches = append(batches, cur)
+			cur = nil
+		}
+		cur = append(cur, sp)
+	}
+	if len(cur) > 0 {
+		batches = append(batches, cur)
+	}
+	return batches
+}
+
+func canJoin(batch []*schedProc, sp *schedProc) bool {
+	for _, other := range batch {
+		if other.Phase != sp.Phase || other.conflicts(sp.ProcSpec) {
+			return false
+		}
+		for _, dep := range sp.after {
+			if dep == other {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (sch *Schedule) cycleError(ph Phase, done []bool) error {
+	var names []string
+	for _, sp := range sch.procs {
+		if sp.Phase == ph && !done[sp.i] {
+			names = append(names, sp.Name)
+		}
+	}
+	return fmt.Errorf("proc dependency cycle in %v phase among: %s", ph, strings.Join(names, ", "))
+}
@@ -0,0 +1,161 @@
+package ecs_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/borkshop/bork/internal/ecs"
+)
+
+func TestSchedule(t *testing.T) {
+	var ran []string
+	proc := func(name string) ecs.Proc {
+		return ecs.ProcFunc(func() { ran = append(ran, name) })
+	}
+
+	var sch ecs.Schedule
+	var hooked []string
+	sch.Hook = func(name string, elapsed time.Duration) { hooked = append(hooked, name) }
+	sch.Add(ecs.ProcSpec{Name: "draw", Phase: ecs.PhaseRender, Proc: proc("draw")})
+	sch.Add(ecs.ProcSpec{Name: "combat", Phase: ecs.PhaseResolve, Proc: proc("combat")})
+	sch.Add(ecs.ProcSpec{Name: "rest", Phase: ecs.PhaseResolve, Proc: proc("rest")})
+	sch.Add(ecs.ProcSpec{Name: "items", Phase: ecs.PhaseResolve, Proc: proc("items"),
+		Before: []string{"combat"}})
+	sch.Add(ecs.ProcSpec{Name: "moves", Phase: ecs.PhaseSimulate, Proc: proc("moves"),
+		After: []string{"ai"}, Before: []string{"combat"}})
+	sch.Add(ecs.ProcSpec{Name: "ai", Phase: ecs.PhaseInput, Proc: proc("ai")})
+	assert.Panics(t, func() { sch.AddFunc("ai", ecs.PhaseInput, func() {}) })
+
+	order, err := sch.Order()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ai", "moves", "rest", "items", "combat", "draw"}, order)
+
+	sch.Process()
+	assert.Equal(t, order, ran)
+	assert.Equal(t, order, hooked)
+
+	// disabled procs are skipped
+	ran = ran[:0]
+	assert.True(t, sch.Enable("combat", false))
+	assert.False(t, sch.Enable("nope", false))
+	assert.False(t, sch.Enabled("combat"))
+	sch.Process()
+	assert.Equal(t, []string{"ai", "moves", "rest", "items", "draw"}, ran)
+	sch.Enable("combat", true)
+	assert.True(t, sch.Enabled("combat"))
+
+	// unknown, contradictory, and cyclic dependencies
+	sch.Add(ecs.ProcSpec{Name: "a", Phase: ecs.PhaseResolve, Proc: proc("a"), After: []string{"b"}})
+	_, err = sch.Order()
+	assert.EqualError(t, err, `proc "a" runs after unknown proc "b"`)
+	sch.Add(ecs.ProcSpec{Name: "b", Phase: ecs.PhaseResolve, Proc: proc("b"), After: []string{"a"}})
+	_, err = sch.Order()
+	assert.EqualError(t, err, "proc dependency cycle in resolve phase among: a, b")
+	assert.Panics(t, sch.Process)
+
+	var sch2 ecs.Schedule
+	sch2.AddFunc("late", ecs.PhaseRender, func() {})
+	sch2.Add(ecs.ProcSpec{Name: "early", Phase: ecs.PhaseInput, Proc: proc("early"),
+		After: []string{"late"}})
+	_, err = sch2.Order()
+	assert.EqualError(t, err, `proc "late" (render) cannot run before "early" (input)`)
+}
+
+func TestSchedule_parallel(t *testing.T) {
+	const (
+		pcA ecs.ComponentType = 1 << iota
+		pcB
+		pcC
+	)
+
+	var sch ecs.Schedule
+	sch.Parallel = true
+
+	// two procs that each wait on the other can only finish concurrently
+	ping, pong := make(chan struct{}), make(chan struct{})
+	rendezvous := func(send, recv chan struct{}) ecs.Proc {
+		return ecs.ProcFunc(func() {
+			go func() { send <- struct{}{} }()
+			select {
+			case <-recv:
+			case <-time.After(time.Second):
+				t.Error("procs did not run concurrently")
+			}
+		})
+	}
+	sch.Add(ecs.ProcSpec{Name: "ping", Phase: ecs.PhaseSimulate, Proc: rendezvous(ping, pong),
+		Reads: pcA.Mask()})
+	sch.Add(ecs.ProcSpec{Name: "pong", Phase: ecs.PhaseSimulate, Proc: rendezvous(pong, ping),
+		Reads: (pcA | pcC).Mask()})
+
+	// conflicting, dependent, and undeclared procs never overlap
+	var running, overlaps int32
+	exclusive := ecs.ProcFunc(func() {
+		if atomic.AddInt32(&running, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+	})
+	sch.Add(ecs.ProcSpec{Name: "writeA", Phase: ecs.PhaseResolve, Proc: exclusive,
+		Writes: pcA.Mask()})
+	sch.Add(ecs.ProcSpec{Name: "readA", Phase: ecs.PhaseResolve, Proc: exclusive,
+		Reads: pcA.Mask()})
+	sch.Add(ecs.ProcSpec{Name: "writeB", Phase: ecs.PhaseResolve, Proc: exclusive,
+		Writes: pcB.Mask(), After: []string{"readA"}})
+	sch.Add(ecs.ProcSpec{Name: "anything", Phase: ecs.PhaseResolve, Proc: exclusive})
+	sch.Add(ecs.ProcSpec{Name: "writeC", Phase: ecs.PhaseResolve, Proc: exclusive,
+		Writes: pcC.Mask()})
+
+	var hooked []string
+	sch.Hook = func(name string, elapsed time.Duration) { hooked = append(hooked, name) }
+	sch.Process()
+	assert.Equal(t, int32(0), overlaps)
+	order, _ := sch.Order()
+	assert.Equal(t, order, hooked, "hooks run in schedule order")
+
+	// panics propagate to the caller
+	sch.Add(ecs.ProcSpec{Name: "boom", Phase: ecs.PhaseRender, Proc: ecs.ProcFunc(func() { panic("boom") }),
+		Reads: pcB.Mask()})
+	sch.Add(ecs.ProcSpec{Name: "quiet", Phase: ecs.PhaseRender, Proc: ecs.ProcFunc(func() {}),
+		Reads: pcA.Mask()})
+	assert.PanicsWithValue(t, "boom", sch.Process)
+}
+
+func TestSchedule_parallelWrites(t *testing.T) {
+	const (
+		pcA ecs.ComponentType = 1 << iota
+		pcB
+		pcC
+	)
+
+	var co ecs.Core
+	for i := 0; i < 100; i++ {
+		co.AddEntity(pcC)
+	}
+
+	// writing disjoint types still changes shared Core state that every other
+	// proc iterating the Core reads, so writers must run alone; run with -race
+	// to check
+	var sch ecs.Schedule
+	sch.Parallel = true
+	adder := func(t ecs.ComponentType) ecs.Proc {
+		return ecs.ProcFunc(func() {
+			for i := 1; i <= 100; i++ {
+				co.Ref(ecs.EntityID(i)).Add(t)
+			}
+		})
+	}
+	var counted int
+	sch.Add(ecs.ProcSpec{Name: "addA", Phase: ecs.PhaseSimulate, Proc: adder(pcA), Writes: pcA.Mask()})
+	sch.Add(ecs.ProcSpec{Name: "addB", Phase: ecs.PhaseSimulate, Proc: adder(pcB), Writes: pcB.Mask()})
+	sch.Add(ecs.ProcSpec{Name: "countC", Phase: ecs.PhaseSimulate, Reads: pcC.Mask(),
+		Proc: ecs.ProcFunc(func() { counted = co.Iter(pcC.All()).Count() })})
+	sch.Process()
+	assert.Equal(t, 100, co.Iter((pcA | pcB).All()).Count())
+	assert.Equal(t, 100, counted)
+}
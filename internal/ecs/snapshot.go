@@ -0,0 +1,216 @@
+package ecs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// SnapshotVersion is the version of the Snapshot document format; Snapshots
+// of any other version cannot be loaded.
+const SnapshotVersion = 1
+
+// Snapshot is a versioned document holding the saved state of any number of
+// named sections: e.g. a Core, and each of the stores and relations attached
+// to it. A Snapshot marshals to, and unmarshals from, JSON.
+//
+// Sections must be loaded in dependency order: a Core before anything that's
+// attached to it, and a Relation's A and B Cores before the Relation itself.
+// Each Core must be loaded into a fresh (empty) Core, after all of its
+// allocators have been registered, so that entity IDs and types are restored
+// exactly.
+type Snapshot struct {
+	Version  int                        `json:"version"`
+	Sections map[string]json.RawMessage `json:"sections"`
+}
+
+// Snapshotter is implemented by anything whose state may be saved into, and
+// loaded from, a Snapshot section.
+type Snapshotter interface {
+	SaveSnapshot() ([]byte, error)
+	LoadSnapshot([]byte) error
+}
+
+// NewSnapshot creates a new, empty, current version Snapshot.
+func NewSnapshot() *Snapshot {
+	return &Snapshot{
+		Version:  SnapshotVersion,
+		Sections: make(map[string]json.RawMessage),
+	}
+}
+
+// Save the state of the given Snapshotter as a named section.
+func (snap *Snapshot) Save(name string, s Snapshotter) error {
+	if _, def := snap.Sections[name]; def {
+		return fmt.Errorf("duplicate snapshot section %q", name)
+	}
+	data, err := s.SaveSnapshot()
+	if err != nil {
+		return fmt.Errorf("failed to save snapshot section %q: %v", name, err)
+	}
+	if snap.Sections == nil {
+		snap.Sections = make(map[string]json.RawMessage)
+	}
+	snap.Sections[name] = data
+	return nil
+}
+
+// Load the state of a named section into the given Snapshotter.
+func (snap *Snapshot) Load(name string, s Snapshotter) error {
+	if snap.Version != SnapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %v", snap.Version)
+	}
+	data, def := snap.Sections[name]
+	if !def {
+		return fmt.Errorf("missing snapshot section %q", name)
+	}
+	if err := s.LoadSnapshot(data); err != nil {
+		return fmt.Errorf("failed to load snapshot section %q: %v", name, err)
+	}
+	return nil
+}
+
+type coreSnapshot struct {
+	Types   []TypeMask `json:"types"`
+	Gens    []uint32   `json:"gens"`
+	NextGen uint32     `json:"next_gen,omitempty"`
+}
+
+// SaveSnapshot saves the Core's entity IDs, types, and generations.
+func (co *Core) SaveSnapshot() ([]byte, error) {
+	return json.Marshal(coreSnapshot{
+		Types:   co.types,
+		Gens:    co.gens,
+		NextGen: co.nextGen,
+	})
+}
+
+// LoadSnapshot restores entity IDs, types, and generations into an empty
+// Core. All allocators are called to make room for the restored entities, but
+// no creators are called: anything attached to the Core should load its own
+// state afterwards.
+func (co *Core) LoadSnapshot(data []byte) error {
+	if len(co.types) > 0 {
+		return errors.New("core already has entities")
+	}
+	var cs coreSnapshot
+	if err := json.Unmarshal(data, &cs); err != nil {
+		return err
+	}
+	if len(cs.Gens) != len(cs.Types) {
+		return errors.New("mismatched core snapshot types and generations")
+	}
+	co.types = make([]TypeMask, 0, len(cs.Types))
+	co.gens = make([]uint32, 0, len(cs.Gens))
+	co.freed = make([]bool, len(cs.Types))
+	co.nextGen = cs.NextGen
+	for i := range cs.Types {
+		co.gens = append(co.gens, cs.Gens[i])
+		co.types = append(co.types, cs.Types[i])
+		id := EntityID(i + 1)
+		for _, ef := range co.allocators {
+			ef.f(id, NoType)
+		}
+	}
+	for i := len(co.types) - 1; i >= 0; i-- {
+		if co.types[i].IsZero() {
+			co.free = append(co.free, EntityID(i+1))
+			co.freed[i] = true
+		}
+	}
+	co.rebuildViews()
+	return nil
+}
+
+type relationSnapshot struct {
+	Core  json.RawMessage `json:"core"`
+	A     []EntityID      `json:"a"`
+	B     []EntityID      `json:"b"`
+	AGens []uint32        `json:"a_gens,omitempty"`
+	BGens []uint32        `json:"b_gens,omitempty"`
+}
+
+// SaveSnapshot saves the relation's own Core, and the A and B entity IDs of
+// every relation (and their generations, for any foreign dimension); the A and
+// B Cores must be saved separately.
+func (rel *Relation) SaveSnapshot() ([]byte, error) {
+	core, err := rel.Core.SaveSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(relationSnapshot{core, rel.aids, rel.bids, rel.agens, rel.bgens})
+}
+
+// LoadSnapshot restores the relation into an empty Relation; the A and B Cores
+// must already have been loaded.
+func (rel *Relation) LoadSnapshot(data []byte) error {
+	var rs relationSnapshot
+	if err := json.Unmarshal(data, &rs); err != nil {
+		return err
+	}
+	if err := rel.Core.LoadSnapshot(rs.Core); err != nil {
+		return err
+	}
+	if len(rs.A) != len(rel.types) || len(rs.B) != len(rel.types) {
+		return errors.New("mismatched relation snapshot size")
+	}
+	if !gensMatch(rel.agens, rs.AGens) || !gensMatch(rel.bgens, rs.BGens) {
+		return errors.New("mismatched relation snapshot generations")
+	}
+	for i := range rel.types {
+		aid, bid := rs.A[i], rs.B[i]
+		if !validRef(rel.aCore, aid, rel.agens != nil) || !validRef(rel.bCore, bid, rel.bgens != nil) {
+			return fmt.Errorf("relation snapshot %v references unknown entities", i+1)
+		}
+		rel.aids[i], rel.bids[i] = aid, bid
+	}
+	copy(rel.agens, rs.AGens)
+	copy(rel.bgens, rs.BGens)
+	rel.rebuildIndexes()
+	return nil
+}
+
+// validRef returns true if a loaded id may refer into the given Core: it must
+// be in range, and must be a live entity unless the dimension is foreign (whose
+// stale references are caught by their generations instead).
+func validRef(co *Core, id EntityID, foreign bool) bool {
+	if id < 0 || int(id) > co.Cap() {
+		return false
+	}
+	return id == 0 || foreign || !co.types[id-1].IsZero()
+}
+
+// gensMatch returns true if loaded generations are present exactly when a
+// relation dimension is foreign, and of the right size.
+func gensMatch(gens, loaded []uint32) bool {
+	if gens == nil {
+		return loaded == nil
+	}
+	return len(loaded) == len(gens)
+}
+
+// MarshalText formats the mask as a hex number, just like String.
+func (m TypeMask) MarshalText() ([]byte, error) { return []byte(m.String()), nil }
+
+// UnmarshalText parses a hex number, as formatted by MarshalText.
+func (m *TypeMask) UnmarshalText(text []byte) error {
+	if len(text) > 16*maskWords {
+		return fmt.Errorf("type mask %q too wide", text)
+	}
+	var r TypeMask
+	for i := 0; len(text) > 0; i++ {
+		j := len(text) - 16
+		if j < 0 {
+			j = 0
+		}
+		w, err := strconv.ParseUint(string(text[j:]), 16, 64)
+		if err != nil {
+			return fmt.Errorf("invalid type mask: %v", err)
+		}
+		r[i] = w
+		text = text[:j]
+	}
+	*m = r
+	return nil
+}
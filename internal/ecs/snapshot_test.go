@@ -0,0 +1,99 @@
+package ecs_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/borkshop/bork/internal/ecs"
+)
+
+func TestSnapshot(t *testing.T) {
+	n := newNamed()
+	rel := ecs.NewRelation(&n.Core, 0, &n.Core, 0)
+
+	e1 := n.AddEntity(stName)
+	e2 := n.AddEntity(stName)
+	e3 := n.AddEntity(stName)
+	wide := n.AddEntityMask(ecs.TypeBit(100))
+	n.name.Set(e1, "one")
+	n.name.Set(e2, "two")
+	n.name.Set(e3, "three")
+	n.tag.Set(e3, 3)
+	rel.Upsert(nil, func(uc *ecs.UpsertCursor) {
+		uc.Create(srFoo, e1, e3)
+		uc.Create(srBar, e3, e1)
+	})
+	e2.Destroy()
+
+	snap := ecs.NewSnapshot()
+	require.NoError(t, snap.Save("core", &n.Core))
+	require.NoError(t, snap.Save("name", &n.name))
+	require.NoError(t, snap.Save("tag", &n.tag))
+	require.NoError(t, snap.Save("rel", rel))
+	assert.Error(t, snap.Save("rel", rel), "duplicate section")
+	buf, err := json.Marshal(snap)
+	require.NoError(t, err)
+
+	var snap2 ecs.Snapshot
+	require.NoError(t, json.Unmarshal(buf, &snap2))
+	m := newNamed()
+	rel2 := ecs.NewRelation(&m.Core, 0, &m.Core, 0)
+	assert.Error(t, snap2.Load("nope", &ecs.Core{}), "missing section")
+	require.NoError(t, snap2.Load("core", &m.Core))
+	require.NoError(t, snap2.Load("name", &m.name))
+	require.NoError(t, snap2.Load("tag", &m.tag))
+	require.NoError(t, snap2.Load("rel", rel2))
+	assert.Error(t, snap2.Load("core", &m.Core), "core not empty")
+
+	// identical IDs, types and generations
+	assert.Equal(t, n.Cap(), m.Cap())
+	assert.Equal(t, n.Len(), m.Len())
+	for id := ecs.EntityID(1); int(id) <= n.Cap(); id++ {
+		assert.Equal(t, entKey(n.Ref(id)), entKey(m.Ref(id)))
+	}
+	assert.Equal(t, ecs.TypeBit(100), m.Ref(wide.ID()).Mask())
+
+	name, _ := m.name.Get(m.Ref(e3.ID()))
+	assert.Equal(t, "three", name)
+	tag, _ := m.tag.Get(m.Ref(e3.ID()))
+	assert.Equal(t, 3, tag)
+
+	type ab struct{ a, b ecs.EntityID }
+	var got []ab
+	for cur := rel2.Select((srFoo | srBar).Any()); cur.Scan(); {
+		got = append(got, ab{cur.A().ID(), cur.B().ID()})
+	}
+	assert.Equal(t, []ab{{e1.ID(), e3.ID()}, {e3.ID(), e1.ID()}}, got)
+
+	// the freed slot is reused just as it would have been
+	assert.Equal(t, entKey(n.AddEntity(stTag)), entKey(m.AddEntity(stTag)))
+
+	// references to negative IDs, or to dead entities, are rejected
+	data, err := rel.SaveSnapshot()
+	require.NoError(t, err)
+	var raw map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(data, &raw))
+	raw["a"] = json.RawMessage(`[-1, 3]`)
+	bad, err := json.Marshal(raw)
+	require.NoError(t, err)
+	assert.Error(t, ecs.NewRelation(&m.Core, 0, &m.Core, 0).LoadSnapshot(bad))
+	d := newNamed()
+	d.AddEntity(stName)
+	d.AddEntity(stName)
+	d.AddEntity(stName).Destroy()
+	assert.Error(t, ecs.NewRelation(&d.Core, 0, &d.Core, 0).LoadSnapshot(data))
+
+	snap2.Version++
+	assert.Error(t, snap2.Load("tag", &m.tag), "version mismatch")
+}
+
+// entKey strips the Core pointer from an entity's String, leaving its type, ID
+// and generation.
+func entKey(ent ecs.Entity) string {
+	s := ent.String()
+	return s[strings.Index(s, "<"):]
+}
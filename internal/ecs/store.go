@@ -0,0 +1,239 @@
+package ecs
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// DenseStore is a component store that keeps a value for every entity in a
+// Core, whether it has the component or not; it suits components that most
+// entities have.
+//
+// The store registers an allocator against its type, so no other allocator may
+// overlap it. Values are zeroed when an entity loses the store's type.
+type DenseStore[T any] struct {
+	core *Core
+	t    TypeMask
+	data []T
+}
+
+// SparseStore is a component store that only keeps values for entities that
+// have its component; it suits components that few entities have.
+//
+// Values are deleted when an entity loses the store's type.
+type SparseStore[T any] struct {
+	core *Core
+	t    TypeMask
+	data map[EntityID]T
+}
+
+// NewDenseStore creates a new dense store attached to the given Core, using
+// the given type to indicate "has a value".
+func NewDenseStore[T any](core *Core, t TypeBits) *DenseStore[T] {
+	ds := &DenseStore[T]{}
+	ds.Init(core, t)
+	return ds
+}
+
+// NewSparseStore creates a new sparse store attached to the given Core, using
+// the given type to indicate "has a value".
+func NewSparseStore[T any](core *Core, t TypeBits) *SparseStore[T] {
+	ss := &SparseStore[T]{}
+	ss.Init(core, t)
+	return ss
+}
+
+// Init attaches the store to the given Core; useful for embedding.
+func (ds *DenseStore[T]) Init(core *Core, t TypeBits) {
+	if ds.core != nil {
+		panic("store already initialized")
+	}
+	ds.core = core
+	ds.t = t.Mask()
+	ds.data = make([]T, core.Cap())
+	core.RegisterAllocatorMask(ds.t, ds.alloc)
+	core.RegisterRemapperMask(ds.t, ds.remap)
+	core.RegisterDestroyerMask(ds.t, ds.destroy)
+}
+
+// Init attaches the store to the given Core; useful for embedding.
+func (ss *SparseStore[T]) Init(core *Core, t TypeBits) {
+	if ss.core != nil {
+		panic("store already initialized")
+	}
+	ss.core = core
+	ss.t = t.Mask()
+	ss.data = make(map[EntityID]T)
+	core.RegisterRemapperMask(ss.t, ss.remap)
+	core.RegisterDestroyerMask(ss.t, ss.destroy)
+}
+
+// Type returns the store's component type.
+func (ds *DenseStore[T]) Type() TypeMask { return ds.t }
+
+// Type returns the store's component type.
+func (ss *SparseStore[T]) Type() TypeMask { return ss.t }
+
+// Has returns true only if the entity is live, and has the store's component.
+func (ds *DenseStore[T]) Has(ent Entity) bool {
+	return ds.core.Valid(ent) && ent.Mask().HasAll(ds.t)
+}
+
+// Has returns true only if the entity is live, and has the store's component.
+func (ss *SparseStore[T]) Has(ent Entity) bool {
+	return ss.core.Valid(ent) && ent.Mask().HasAll(ss.t)
+}
+
+// Get returns the entity's value; the bool return is true only if the entity
+// actually has the store's component.
+func (ds *DenseStore[T]) Get(ent Entity) (T, bool) {
+	if !ds.Has(ent) {
+		var zero T
+		return zero, false
+	}
+	return ds.data[ent.id-1], true
+}
+
+// Get returns the entity's value; the bool return is true only if the entity
+// actually has the store's component.
+func (ss *SparseStore[T]) Get(ent Entity) (T, bool) {
+	if !ss.Has(ent) {
+		var zero T
+		return zero, false
+	}
+	return ss.data[ent.id], true
+}
+
+// Ptr returns a pointer to the entity's value, or nil if it doesn't have the
+// store's component. The pointer is only good until the Core next grows.
+func (ds *DenseStore[T]) Ptr(ent Entity) *T {
+	if !ds.Has(ent) {
+		return nil
+	}
+	return &ds.data[ent.id-1]
+}
+
+// Set the entity's value, adding the store's component if necessary (which
+// happens first, so that any creators see the set value overwrite theirs).
+// Panics if the entity does not belong to the store's Core, or is stale.
+func (ds *DenseStore[T]) Set(ent Entity, val T) {
+	id := ds.core.Deref(ent)
+	ent.AddMask(ds.t)
+	ds.data[id-1] = val
+}
+
+// Set the entity's value, adding the store's component if necessary (which
+// happens first, so that any creators see the set value overwrite theirs).
+// Panics if the entity does not belong to the store's Core, or is stale.
+func (ss *SparseStore[T]) Set(ent Entity, val T) {
+	id := ss.core.Deref(ent)
+	ent.AddMask(ss.t)
+	ss.data[id] = val
+}
+
+// Delete removes the store's component from the entity, zeroing its value.
+func (ds *DenseStore[T]) Delete(ent Entity) { ent.DeleteMask(ds.t) }
+
+// Delete removes the store's component from the entity, deleting its value.
+func (ss *SparseStore[T]) Delete(ent Entity) { ent.DeleteMask(ss.t) }
+
+// Iter returns an iterator over all entities that have the store's component.
+func (ds *DenseStore[T]) Iter() Iterator { return ds.core.Iter(ds.t.All()) }
+
+// Iter returns an iterator over all entities that have the store's component.
+func (ss *SparseStore[T]) Iter() Iterator { return ss.core.Iter(ss.t.All()) }
+
+// Len returns how many entities have a value in the store.
+func (ss *SparseStore[T]) Len() int { return len(ss.data) }
+
+type storeEntry[T any] struct {
+	ID  EntityID `json:"id"`
+	Val T        `json:"val"`
+}
+
+// SaveSnapshot saves the value of every entity that has the store's component;
+// the Core must be saved separately.
+func (ds *DenseStore[T]) SaveSnapshot() ([]byte, error) {
+	var data []storeEntry[T]
+	for it := ds.Iter(); it.Next(); {
+		data = append(data, storeEntry[T]{it.ID(), ds.data[it.ID()-1]})
+	}
+	return json.Marshal(data)
+}
+
+// SaveSnapshot saves the value of every entity that has the store's component;
+// the Core must be saved separately.
+func (ss *SparseStore[T]) SaveSnapshot() ([]byte, error) {
+	var data []storeEntry[T]
+	for it := ss.Iter(); it.Next(); {
+		data = append(data, storeEntry[T]{it.ID(), ss.data[it.ID()]})
+	}
+	return json.Marshal(data)
+}
+
+// LoadSnapshot restores values into the store; the Core must already have been
+// loaded, giving each restored entity the store's component.
+func (ds *DenseStore[T]) LoadSnapshot(d []byte) error {
+	var data []storeEntry[T]
+	if err := json.Unmarshal(d, &data); err != nil {
+		return err
+	}
+	for _, dat := range data {
+		if dat.ID <= 0 || int(dat.ID) > ds.core.Cap() || !ds.core.Mask(dat.ID).HasAll(ds.t) {
+			return fmt.Errorf("store snapshot entity %v lacks component", dat.ID)
+		}
+	}
+	for _, dat := range data {
+		ds.data[dat.ID-1] = dat.Val
+	}
+	return nil
+}
+
+// LoadSnapshot restores values into the store; the Core must already have been
+// loaded, giving each restored entity the store's component.
+func (ss *SparseStore[T]) LoadSnapshot(d []byte) error {
+	var data []storeEntry[T]
+	if err := json.Unmarshal(d, &data); err != nil {
+		return err
+	}
+	for _, dat := range data {
+		if dat.ID <= 0 || int(dat.ID) > ss.core.Cap() || !ss.core.Mask(dat.ID).HasAll(ss.t) {
+			return fmt.Errorf("store snapshot entity %v lacks component", dat.ID)
+		}
+	}
+	for _, dat := range data {
+		ss.data[dat.ID] = dat.Val
+	}
+	return nil
+}
+
+func (ds *DenseStore[T]) alloc(id EntityID, t ComponentType) {
+	var zero T
+	ds.data = append(ds.data, zero)
+}
+
+func (ds *DenseStore[T]) remap(rm Remap) {
+	rm.Each(func(old, new EntityID) { ds.data[new-1] = ds.data[old-1] })
+	var zero T
+	for i := rm.Len(); i < len(ds.data); i++ {
+		ds.data[i] = zero
+	}
+	ds.data = ds.data[:rm.Len()]
+}
+
+func (ds *DenseStore[T]) destroy(id EntityID, t ComponentType) {
+	var zero T
+	ds.data[id-1] = zero
+}
+
+func (ss *SparseStore[T]) remap(rm Remap) {
+	data := make(map[EntityID]T, len(ss.data))
+	for id, val := range ss.data {
+		if id = rm.ID(id); id != 0 {
+			data[id] = val
+		}
+	}
+	ss.data = data
+}
+
+func (ss *SparseStore[T]) destroy(id EntityID, t ComponentType) { delete(ss.data, id) }
@@ -0,0 +1,89 @@
+package ecs_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/borkshop/bork/internal/ecs"
+)
+
+const (
+	stName ecs.ComponentType = 1 << iota
+	stTag
+)
+
+type named struct {
+	ecs.Core
+	name ecs.DenseStore[string]
+	tag  ecs.SparseStore[int]
+}
+
+func newNamed() *named {
+	n := &named{}
+	n.name.Init(&n.Core, stName)
+	n.tag.Init(&n.Core, stTag)
+	return n
+}
+
+func TestStores(t *testing.T) {
+	n := newNamed()
+
+	e1 := n.AddEntity(stName)
+	e2 := n.AddEntity(stName)
+	e3 := n.AddEntity(ecs.NoType)
+
+	n.name.Set(e1, "one")
+	n.name.Set(e3, "three")
+	n.tag.Set(e2, 42)
+	assert.Equal(t, stName|stTag, e2.Type())
+	assert.Equal(t, stName, e3.Type(), "Set adds the store's type")
+
+	name, ok := n.name.Get(e1)
+	assert.True(t, ok)
+	assert.Equal(t, "one", name)
+	name, ok = n.name.Get(e2)
+	assert.True(t, ok)
+	assert.Equal(t, "", name)
+	*n.name.Ptr(e2) = "two"
+	name, _ = n.name.Get(e2)
+	assert.Equal(t, "two", name)
+
+	tag, ok := n.tag.Get(e2)
+	assert.True(t, ok)
+	assert.Equal(t, 42, tag)
+	_, ok = n.tag.Get(e1)
+	assert.False(t, ok)
+	assert.Equal(t, 1, n.tag.Len())
+
+	var names []string
+	for it := n.name.Iter(); it.Next(); {
+		name, _ := n.name.Get(it.Entity())
+		names = append(names, name)
+	}
+	assert.Equal(t, []string{"one", "two", "three"}, names)
+
+	// destruction zeros and deletes
+	e1.Destroy()
+	n.tag.Delete(e2)
+	assert.False(t, n.name.Has(e1))
+	assert.Equal(t, 0, n.tag.Len())
+	assert.Nil(t, n.name.Ptr(e1))
+	e4 := n.AddEntity(stName)
+	assert.Equal(t, e1.ID(), e4.ID())
+	name, _ = n.name.Get(e4)
+	assert.Equal(t, "", name)
+	assert.Panics(t, func() { n.name.Set(e1, "stale") })
+
+	// stores follow compaction
+	n.tag.Set(e3, 3)
+	e4.Destroy()
+	rm := n.Compact()
+	e2, e3 = rm.Entity(e2), rm.Entity(e3)
+	name, _ = n.name.Get(e2)
+	assert.Equal(t, "two", name)
+	name, _ = n.name.Get(e3)
+	assert.Equal(t, "three", name)
+	tag, _ = n.tag.Get(e3)
+	assert.Equal(t, 3, tag)
+}
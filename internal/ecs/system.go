@@ -7,9 +7,13 @@ type Proc interface {
 
 // System is a Core with an attached set of Proc-s; it is itself a
 // Proc.
+//
+// Procs may defer mutations by recording them in Commands, which are applied
+// after every Proc has run.
 type System struct {
 	Core
-	Procs []Proc
+	Procs    []Proc
+	Commands CommandBuffer
 }
 
 // AddProc adds processor(s) to the system.
@@ -26,11 +30,12 @@ func (sys *System) AddProcFunc(fns ...func()) {
 	sys.Procs = append(sys.Procs, procs...)
 }
 
-// Process calls each Proc.
+// Process calls each Proc, and then applies any deferred Commands.
 func (sys *System) Process() {
 	for i := range sys.Procs {
 		sys.Procs[i].Process()
 	}
+	sys.Commands.Apply()
 }
 
 // ProcFunc is a convenience for implementing Proc around an arbitrary void
@@ -9,5 +9,9 @@ toplevel ecs.System, there's nothing to stop you from having multiple levels of
 time. Such a setup might make sense if there's a non-trivial relationship
 between toplevel Process()ing and an inner system's Process()ing.
 
+Besides timers, a Scheduler provides energy based turns for actors, as in a
+roguelike: rather than advancing with every Process(), its time only advances
+as actors take their turns, and may drive a Facility through its Tick hook.
+
 */
 package time
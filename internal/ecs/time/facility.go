@@ -1,24 +1,37 @@
 package time
 
 import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
 	"math"
 
 	"github.com/borkshop/bork/internal/ecs"
 )
 
 // Facility implements a timer facility attached to an ecs.Core.
+//
+// Each entity may have any number of timers, distinguished by name; After,
+// Every, and friends manage the unnamed ("") timer, while their Named
+// variants manage any other. Pending timers are kept in a heap ordered by
+// when they are due, so that Process only visits expired timers, and
+// scheduling costs O(log n).
+//
+// Every entity belongs to a timer group (by default, the unnamed group);
+// each group keeps its own time, which may be paused, or scaled relative to
+// Process()ing time. See SetGroup, Pause, and SetScale.
 type Facility struct {
-	// NOTE: dense storage strategy, may want to explicate that
-	// eventually and provide alternate
 	core *ecs.Core
 	t    ecs.ComponentType
 
 	now Time
+	seq uint64
 
-	// TODO: shift to a heap rather than iterating and decrementing every time;
-	// maybe introspectively after len(timers) passes a certain point?
-	timers []timer
-	tocall []cb
+	ents      [][]*timer    // each entity's timers, in creation order
+	grps      []*timerGroup // each entity's group; nil for the unnamed group
+	groups    []*timerGroup // in creation order, starting with the unnamed group
+	callbacks map[string]func(ecs.Entity)
+	tocall    []cb
 }
 
 type cb struct {
@@ -27,10 +40,16 @@ type cb struct {
 }
 
 type timer struct {
-	t        ecs.ComponentType
-	remain   Duration
+	id       ecs.EntityID
+	name     string
+	grp      *timerGroup
+	due      Time // in group time
 	period   Duration
 	callback func(ecs.Entity)
+	cbName   string // non-empty only for a registered callback
+
+	seq uint64 // breaks ties between timers due at the same time
+	i   int    // index within the group's heap
 }
 
 // Init sets up the timer facility, attached to the given ecs.Core, and using
@@ -42,51 +61,122 @@ func (fac *Facility) Init(core *ecs.Core, t ecs.ComponentType) {
 	}
 	fac.core = core
 	fac.t = t
-	fac.timers = []timer{{}}
+	fac.ents = [][]*timer{nil}
+	fac.grps = []*timerGroup{nil}
+	fac.groups = []*timerGroup{{scale: 1}}
+	fac.callbacks = make(map[string]func(ecs.Entity))
 	fac.core.RegisterAllocator(fac.t, fac.alloc)
+	fac.core.RegisterRemapper(fac.t, fac.remap)
 	fac.core.RegisterDestroyer(fac.t, fac.destroyTimer)
+	fac.core.RegisterDestroyer(ecs.NoType, fac.destroyEntity)
 }
 
 // Now returns the current time, which increments at
 // the start of Process()ing.
 func (fac Facility) Now() Time { return fac.now }
 
+// RegisterCallback registers a callback function under the given name, so
+// that timers may refer to it by name: see AfterCallback and EveryCallback.
+// Unlike raw callback functions, named callbacks are saved by SaveSnapshot,
+// and re-attached by LoadSnapshot. Panics if the name is already registered.
+func (fac *Facility) RegisterCallback(name string, callback func(ecs.Entity)) {
+	if _, def := fac.callbacks[name]; def {
+		panic(fmt.Sprintf("timer callback %q already registered", name))
+	}
+	fac.callbacks[name] = callback
+}
+
 // After attaches a one-shot timer to the given entity that expires after d
 // processing time has elapsed calling the given function with the attached
 // entity.
 //
-// Any prior timer (one-shot or periodic) attached to the entity is overwritten.
+// Any prior unnamed timer (one-shot or periodic) attached to the entity is
+// overwritten.
 //
 // Panics if the entity does not belong to the Facility's core, or the duration
 // is not positive.
+//
+// NOTE: a raw callback function is not saved by SaveSnapshot; the timer is
+// restored without it, and silently does nothing when it expires. Use
+// AfterCallback to have snapshots keep the callback.
 func (fac *Facility) After(ent ecs.Entity, d Duration, callback func(ecs.Entity)) {
-	if d <= 0 {
-		panic("invalid timer duration")
-	}
-	id := fac.core.Deref(ent)
-	ent.Add(fac.t)
-	fac.timers[id] = timer{remain: d, callback: callback}
+	fac.AfterNamed(ent, "", d, callback)
 }
 
 // Every attaches a periodic timer to the given entity that fires every d
 // processing time has elapsed, calling the given function with the attached
 // entity every time.
 //
-// Any prior timer (one-shot or periodic) attached to the entity is overwritten.
+// Any prior unnamed timer (one-shot or periodic) attached to the entity is
+// overwritten.
 //
 // Panics if the entity does not belong to the Facility's core, or the duration
 // is not positive.
+//
+// NOTE: like After, a raw callback function is lost by snapshots; use
+// EveryCallback to keep it.
 func (fac *Facility) Every(ent ecs.Entity, d Duration, callback func(ecs.Entity)) {
+	fac.EveryNamed(ent, "", d, callback)
+}
+
+// AfterNamed is like After, but for the named timer; other timers attached to
+// the entity are left alone.
+func (fac *Facility) AfterNamed(ent ecs.Entity, name string, d Duration, callback func(ecs.Entity)) {
+	fac.set(ent, name, d, 0, callback, "")
+}
+
+// EveryNamed is like Every, but for the named timer; other timers attached to
+// the entity are left alone.
+func (fac *Facility) EveryNamed(ent ecs.Entity, name string, d Duration, callback func(ecs.Entity)) {
+	fac.set(ent, name, d, d, callback, "")
+}
+
+// AfterCallback is like AfterNamed, but calls the callback registered under
+// the given name. Panics if no such callback has been registered.
+func (fac *Facility) AfterCallback(ent ecs.Entity, name string, d Duration, callback string) {
+	fac.set(ent, name, d, 0, fac.callback(callback), callback)
+}
+
+// EveryCallback is like EveryNamed, but calls the callback registered under
+// the given name. Panics if no such callback has been registered.
+func (fac *Facility) EveryCallback(ent ecs.Entity, name string, d Duration, callback string) {
+	fac.set(ent, name, d, d, fac.callback(callback), callback)
+}
+
+func (fac *Facility) callback(name string) func(ecs.Entity) {
+	callback, def := fac.callbacks[name]
+	if !def {
+		panic(fmt.Sprintf("no timer callback %q registered", name))
+	}
+	return callback
+}
+
+func (fac *Facility) set(
+	ent ecs.Entity, name string,
+	d, period Duration,
+	callback func(ecs.Entity), cbName string,
+) {
 	if d <= 0 {
 		panic("invalid timer duration")
 	}
 	id := fac.core.Deref(ent)
 	ent.Add(fac.t)
-	fac.timers[id] = timer{remain: d, period: d, callback: callback}
+	t := fac.timer(id, name)
+	if t == nil {
+		t = &timer{id: id, name: name, grp: fac.entGroup(id)}
+		fac.ents[id] = append(fac.ents[id], t)
+		fac.schedule(t, t.grp.now.Add(d))
+	} else {
+		fac.reschedule(t, t.grp.now.Add(d))
+	}
+	t.period = period
+	t.callback, t.cbName = callback, cbName
 }
 
-// Cancel deletes any timer (one-shot or periodic )attached to the given
-// entity, returning true only if there was such a timer to delete.
+// Cancel deletes every timer (one-shot or periodic) attached to the given
+// entity, returning true only if there was any timer to delete.
+//
+// Panics if the entity is stale, or does not belong to the Facility's core.
 func (fac *Facility) Cancel(ent ecs.Entity) bool {
 	_ = fac.core.Deref(ent)
 	if ent.Type().HasAll(fac.t) {
@@ -96,48 +186,357 @@ func (fac *Facility) Cancel(ent ecs.Entity) bool {
 	return false
 }
 
+// CancelNamed deletes the named timer attached to the given entity, returning
+// true only if there was such a timer to delete. Panics just like Cancel.
+func (fac *Facility) CancelNamed(ent ecs.Entity, name string) bool {
+	_ = fac.core.Deref(ent)
+	t := fac.lookup(ent, name)
+	if t == nil {
+		return false
+	}
+	fac.remove(t)
+	if len(fac.ents[t.id]) == 0 {
+		ent.Delete(fac.t)
+	}
+	return true
+}
+
+// Timer returns the remaining time, and period (0 for a one-shot), of any
+// unnamed timer attached to the given entity; the bool is true only if there
+// is one. Times are counted in the entity's group time.
+func (fac *Facility) Timer(ent ecs.Entity) (remain, period Duration, ok bool) {
+	return fac.TimerNamed(ent, "")
+}
+
+// TimerNamed is like Timer, but for the named timer.
+func (fac *Facility) TimerNamed(ent ecs.Entity, name string) (remain, period Duration, ok bool) {
+	t := fac.lookup(ent, name)
+	if t == nil {
+		return 0, 0, false
+	}
+	return t.due.Sub(t.grp.now), t.period, true
+}
+
+// TimerNames returns the names of every timer attached to the given entity,
+// in the order that they were first set.
+func (fac *Facility) TimerNames(ent ecs.Entity) []string {
+	if !fac.core.Valid(ent) || !ent.Type().HasAll(fac.t) {
+		return nil
+	}
+	names := make([]string, len(fac.ents[ent.ID()]))
+	for i, t := range fac.ents[ent.ID()] {
+		names[i] = t.name
+	}
+	return names
+}
+
+// TimerInfo describes a timer, e.g. for display.
+type TimerInfo struct {
+	Name     string
+	Callback string // registered callback name; empty for a raw function
+	Group    string
+	Remain   Duration // in group time
+	Period   Duration // 0 for a one-shot
+	Scale    float64  // the group's time scale
+	Paused   bool     // true if the group is paused
+}
+
+// Wall estimates how much Process()ing time remains until the timer next
+// fires, given its group's current scale; returns -1 if it will not fire
+// until its group is resumed or re-scaled.
+func (ti TimerInfo) Wall() Duration {
+	if ti.Paused || ti.Scale <= 0 {
+		return -1
+	}
+	return Duration(math.Ceil(float64(ti.Remain) / ti.Scale))
+}
+
+// Timers describes every timer attached to the given entity, in the order
+// that they were first set.
+func (fac *Facility) Timers(ent ecs.Entity) []TimerInfo {
+	if !fac.core.Valid(ent) || !ent.Type().HasAll(fac.t) {
+		return nil
+	}
+	infos := make([]TimerInfo, len(fac.ents[ent.ID()]))
+	for i, t := range fac.ents[ent.ID()] {
+		infos[i] = TimerInfo{
+			Name:     t.name,
+			Callback: t.cbName,
+			Group:    t.grp.name,
+			Remain:   t.due.Sub(t.grp.now),
+			Period:   t.period,
+			Scale:    t.grp.scale,
+			Paused:   t.grp.paused,
+		}
+	}
+	return infos
+}
+
+// SetCallback replaces the callback of any unnamed timer attached to the given
+// entity, without changing when it fires; returns true only if there was such
+// a timer. Useful for re-attaching unregistered callbacks after LoadSnapshot.
+func (fac *Facility) SetCallback(ent ecs.Entity, callback func(ecs.Entity)) bool {
+	return fac.SetCallbackNamed(ent, "", callback)
+}
+
+// SetCallbackNamed is like SetCallback, but for the named timer.
+func (fac *Facility) SetCallbackNamed(ent ecs.Entity, name string, callback func(ecs.Entity)) bool {
+	t := fac.lookup(ent, name)
+	if t == nil {
+		return false
+	}
+	t.callback, t.cbName = callback, ""
+	return true
+}
+
+type facilitySnapshot struct {
+	Now    Time             `json:"now"`
+	Groups []groupSnapshot  `json:"groups,omitempty"`
+	Member []memberSnapshot `json:"members,omitempty"`
+	Timers []timerSnapshot  `json:"timers"`
+}
+
+type groupSnapshot struct {
+	Name   string  `json:"name"`
+	Now    Time    `json:"now"`
+	Scale  float64 `json:"scale"`
+	Acc    float64 `json:"acc,omitempty"`
+	Paused bool    `json:"paused,omitempty"`
+}
+
+type memberSnapshot struct {
+	ID    ecs.EntityID `json:"id"`
+	Group string       `json:"group"`
+}
+
+type timerSnapshot struct {
+	ID       ecs.EntityID `json:"id"`
+	Name     string       `json:"name,omitempty"`
+	Remain   Duration     `json:"remain"`
+	Period   Duration     `json:"period,omitempty"`
+	Callback string       `json:"callback,omitempty"`
+}
+
+// SaveSnapshot saves the current time, every timer group, and the schedule
+// of every timer, along with the names of any registered callbacks; it should
+// be saved alongside the Core, which must be saved separately.
+//
+// Raw callback functions cannot be saved: timers using them are saved without
+// any callback, and no error is returned; see LoadSnapshot and SetCallback.
+func (fac *Facility) SaveSnapshot() ([]byte, error) {
+	fs := facilitySnapshot{Now: fac.now}
+	for _, g := range fac.groups {
+		fs.Groups = append(fs.Groups, groupSnapshot{g.name, g.now, g.scale, g.acc, g.paused})
+	}
+	for id, g := range fac.grps {
+		if g != nil && fac.core.Valid(fac.core.Ref(ecs.EntityID(id))) {
+			fs.Member = append(fs.Member, memberSnapshot{ecs.EntityID(id), g.name})
+		}
+	}
+	for it := fac.core.Iter(fac.t.All()); it.Next(); {
+		for _, t := range fac.ents[it.ID()] {
+			fs.Timers = append(fs.Timers, timerSnapshot{
+				it.ID(), t.name, t.due.Sub(t.grp.now), t.period, t.cbName,
+			})
+		}
+	}
+	return json.Marshal(fs)
+}
+
+// LoadSnapshot restores the current time, timer groups, and timer schedules,
+// replacing any existing ones; the Core must already have been loaded, and any
+// named callbacks registered. Restored timers without a named callback have
+// no callback until one is set by SetCallback; until then they expire
+// silently.
+func (fac *Facility) LoadSnapshot(data []byte) error {
+	var fs facilitySnapshot
+	if err := json.Unmarshal(data, &fs); err != nil {
+		return err
+	}
+	for _, ms := range fs.Member {
+		if ms.ID <= 0 || int(ms.ID) >= len(fac.ents) {
+			return fmt.Errorf("invalid timer group snapshot entity %v", ms.ID)
+		}
+	}
+	for _, ts := range fs.Timers {
+		if ts.ID <= 0 || int(ts.ID) >= len(fac.ents) {
+			return fmt.Errorf("invalid timer snapshot entity %v", ts.ID)
+		}
+		if _, def := fac.callbacks[ts.Callback]; ts.Callback != "" && !def {
+			return fmt.Errorf("unknown timer callback %q", ts.Callback)
+		}
+	}
+
+	fac.now = fs.Now
+	fac.groups = []*timerGroup{{scale: 1, now: fs.Now}}
+	for _, gs := range fs.Groups {
+		g := fac.group(gs.Name)
+		g.now, g.scale, g.acc, g.paused = gs.Now, gs.Scale, gs.Acc, gs.Paused
+	}
+	for i := range fac.ents {
+		fac.ents[i], fac.grps[i] = nil, nil
+	}
+	for _, ms := range fs.Member {
+		if g := fac.group(ms.Group); g != fac.groups[0] {
+			fac.grps[ms.ID] = g
+		}
+	}
+	for _, ts := range fs.Timers {
+		t := &timer{
+			id: ts.ID, name: ts.Name, grp: fac.entGroup(ts.ID),
+			period: ts.Period, cbName: ts.Callback,
+		}
+		if t.cbName != "" {
+			t.callback = fac.callbacks[t.cbName]
+		}
+		fac.ents[ts.ID] = append(fac.ents[ts.ID], t)
+		fac.schedule(t, t.grp.now.Add(ts.Remain))
+	}
+	return nil
+}
+
 // Process calls any timers whose time has come.
 //
 // Panics if The End Time has come (2^64 Process()ing ticks integer overflow).
 //
-// Callback functions are called (in an ARBITRARY order) in one batch AFTER all
-// expired timers have been processed. Therefore callbacks may re-set a
-// one-shot, or cancel a periodic (their own timer, or another).
+// Each unpaused group's time advances by its scale; a group whose time
+// advances by more than one tick fires periodic timers once for every period
+// that has elapsed.
+//
+// Callback functions are called in one batch AFTER all expired timers have
+// been processed: group by group, in the order that groups were created, and
+// in the order that they came due within each group; timers due at the same
+// time are called in the order that they were set. Therefore callbacks may
+// re-set a one-shot, or cancel a periodic (their own timer, or another).
+//
+// Callbacks for any entity destroyed by an earlier callback in the batch are
+// skipped, rather than passed a stale reference; the destroyed entity's ID may
+// already have been re-used by then.
 func (fac *Facility) Process() {
 	fac.now = fac.now.Add(1)
 	if fac.now == math.MaxUint64 {
 		panic("The End is Now!")
 	}
 	fac.tocall = fac.tocall[:0]
-	for it := fac.core.Iter(fac.t.All()); it.Next(); {
-		t := &fac.timers[it.ID()]
-		if t.remain <= 0 {
-			it.Entity().Delete(fac.t)
-			continue
+	for _, g := range fac.groups {
+		if g.advance() {
+			fac.expire(g)
 		}
-		t.remain--
-		if t.remain > 0 {
+	}
+	for _, cb := range fac.tocall {
+		if cb.f != nil && fac.core.Valid(cb.e) {
+			cb.f(cb.e)
+		}
+	}
+}
+
+func (fac *Facility) expire(g *timerGroup) {
+	for len(g.due) > 0 && g.due[0].due <= g.now {
+		t := g.due[0]
+		ent := fac.core.Ref(t.id)
+		fac.tocall = append(fac.tocall, cb{t.callback, ent})
+		if t.period != 0 {
+			fac.reschedule(t, t.due.Add(t.period)) // interval refresh
 			continue
 		}
-		ent := it.Entity()
-		fac.tocall = append(fac.tocall, cb{t.process(ent), ent})
+		fac.remove(t) // one shot
+		if len(fac.ents[t.id]) == 0 {
+			ent.Delete(fac.t)
+		}
 	}
-	for _, cb := range fac.tocall {
-		cb.f(cb.e)
+}
+
+// lookup returns the named timer attached to the given entity, if any.
+func (fac *Facility) lookup(ent ecs.Entity, name string) *timer {
+	if !fac.core.Valid(ent) || !ent.Type().HasAll(fac.t) {
+		return nil
 	}
+	return fac.timer(ent.ID(), name)
 }
 
-func (t *timer) process(ent ecs.Entity) func(ecs.Entity) {
-	callback := t.callback
-	if t.period != 0 {
-		t.remain = t.period // interval refresh
-	} else {
-		ent.Delete(t.t) // one shot
+func (fac *Facility) timer(id ecs.EntityID, name string) *timer {
+	for _, t := range fac.ents[id] {
+		if t.name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+func (fac *Facility) schedule(t *timer, due Time) {
+	fac.seq++
+	t.due, t.seq = due, fac.seq
+	heap.Push(&t.grp.due, t)
+}
+
+func (fac *Facility) reschedule(t *timer, due Time) {
+	fac.seq++
+	t.due, t.seq = due, fac.seq
+	heap.Fix(&t.grp.due, t.i)
+}
+
+// remove unschedules the timer, and detaches it from its entity.
+func (fac *Facility) remove(t *timer) {
+	heap.Remove(&t.grp.due, t.i)
+	ts := fac.ents[t.id]
+	for i := range ts {
+		if ts[i] == t {
+			copy(ts[i:], ts[i+1:])
+			ts[len(ts)-1] = nil
+			fac.ents[t.id] = ts[:len(ts)-1]
+			break
+		}
 	}
-	return callback
 }
 
 func (fac *Facility) alloc(id ecs.EntityID, t ecs.ComponentType) {
-	fac.timers = append(fac.timers, timer{})
+	fac.ents = append(fac.ents, nil)
+	fac.grps = append(fac.grps, nil)
+}
+func (fac *Facility) remap(rm ecs.Remap) {
+	rm.Each(func(old, new ecs.EntityID) {
+		fac.ents[new] = fac.ents[old]
+		fac.grps[new] = fac.grps[old]
+		for _, t := range fac.ents[new] {
+			t.id = new
+		}
+	})
+	fac.ents = fac.ents[:rm.Len()+1]
+	fac.grps = fac.grps[:rm.Len()+1]
+}
+
+func (fac *Facility) destroyTimer(id ecs.EntityID, t ecs.ComponentType) {
+	for _, t := range fac.ents[id] {
+		heap.Remove(&t.grp.due, t.i)
+	}
+	fac.ents[id] = nil
+}
+
+func (fac *Facility) destroyEntity(id ecs.EntityID, t ecs.ComponentType) { fac.grps[id] = nil }
+
+// timerHeap implements heap.Interface, ordering timers by when they are due.
+type timerHeap []*timer
+
+func (th timerHeap) Len() int { return len(th) }
+func (th timerHeap) Less(i, j int) bool {
+	if th[i].due != th[j].due {
+		return th[i].due < th[j].due
+	}
+	return th[i].seq < th[j].seq
+}
+func (th timerHeap) Swap(i, j int) {
+	th[i], th[j] = th[j], th[i]
+	th[i].i, th[j].i = i, j
+}
+func (th *timerHeap) Push(x interface{}) {
+	t := x.(*timer)
+	t.i = len(*th)
+	*th = append(*th, t)
+}
+func (th *timerHeap) Pop() interface{} {
+	old := *th
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	*th = old[:len(old)-1]
+	return t
 }
-func (fac *Facility) destroyTimer(id ecs.EntityID, t ecs.ComponentType) { fac.timers[id] = timer{} }
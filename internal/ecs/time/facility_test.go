@@ -0,0 +1,131 @@
+package time_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/borkshop/bork/internal/ecs"
+	"github.com/borkshop/bork/internal/ecs/time"
+)
+
+func TestFacility_named(t *testing.T) {
+	var (
+		co  ecs.Core
+		fac time.Facility
+		log []string
+	)
+	fac.Init(&co, wcTime)
+	logger := func(s string) func(ecs.Entity) {
+		return func(ent ecs.Entity) { log = append(log, s) }
+	}
+
+	e1, e2 := co.AddEntity(wcFoo), co.AddEntity(wcFoo)
+	fac.After(e1, 3, logger("e1"))
+	fac.AfterNamed(e1, "poison", 1, logger("e1 poison"))
+	fac.EveryNamed(e1, "regen", 2, logger("e1 regen"))
+	fac.After(e2, 1, logger("e2"))
+	fac.After(e2, 2, logger("e2 again")) // overwrites
+	assert.Equal(t, []string{"", "poison", "regen"}, fac.TimerNames(e1))
+	remain, period, ok := fac.TimerNamed(e1, "regen")
+	assert.Equal(t, []interface{}{time.Duration(2), time.Duration(2), true}, []interface{}{remain, period, ok})
+
+	fac.Process()
+	assert.Equal(t, []string{"e1 poison"}, log)
+	assert.Equal(t, []string{"", "regen"}, fac.TimerNames(e1))
+	fac.Process()
+	assert.Equal(t, []string{"e1 poison", "e1 regen", "e2 again"}, log)
+	assert.False(t, e2.Type().HasAll(wcTime), "no timers left")
+
+	assert.True(t, fac.CancelNamed(e1, ""))
+	assert.False(t, fac.CancelNamed(e1, ""))
+	log = nil
+	fac.Process()
+	fac.Process()
+	assert.Equal(t, []string{"e1 regen"}, log)
+
+	// snapshots keep names; callbacks are re-attached by name
+	fac.AfterNamed(e1, "poison", 5, nil)
+	data, err := fac.SaveSnapshot()
+	require.NoError(t, err)
+	assert.True(t, fac.Cancel(e1))
+	assert.Nil(t, fac.TimerNames(e1))
+	e1.Add(wcTime)
+	require.NoError(t, fac.LoadSnapshot(data))
+	assert.Equal(t, []string{"regen", "poison"}, fac.TimerNames(e1))
+	remain, _, _ = fac.TimerNamed(e1, "poison")
+	assert.Equal(t, time.Duration(5), remain)
+	assert.True(t, fac.SetCallbackNamed(e1, "regen", logger("e1 regen")))
+
+	// destroying an entity drops all of its timers
+	log = nil
+	fac.Process()
+	fac.Process()
+	assert.Equal(t, []string{"e1 regen"}, log)
+	e1.Destroy()
+	fac.Process()
+	fac.Process()
+	assert.Equal(t, []string{"e1 regen"}, log)
+	assert.Panics(t, func() { fac.Cancel(e1) }, "stale entity")
+	assert.Panics(t, func() { fac.CancelNamed(e1, "regen") }, "stale entity")
+}
+
+func TestFacility_groups(t *testing.T) {
+	var (
+		co  ecs.Core
+		fac time.Facility
+		log []string
+	)
+	fac.Init(&co, wcTime)
+	fac.RegisterCallback("tick", func(ent ecs.Entity) { log = append(log, fmt.Sprintf("tick %v", ent.ID())) })
+	assert.Panics(t, func() { fac.RegisterCallback("tick", nil) })
+
+	e1, e2, e3 := co.AddEntity(wcFoo), co.AddEntity(wcFoo), co.AddEntity(wcFoo)
+	assert.Panics(t, func() { fac.AfterCallback(e1, "", 1, "tock") })
+	fac.SetGroup(e2, "slow")
+	fac.SetScale("slow", 0.5)
+	assert.Panics(t, func() { fac.SetScale("slow", -1) })
+	fac.SetGroup(e3, "frozen")
+	fac.Pause("frozen")
+	for _, ent := range []ecs.Entity{e1, e2, e3} {
+		fac.EveryCallback(ent, "", 2, "tick")
+	}
+	assert.Equal(t, "slow", fac.Group(e2))
+	assert.Equal(t, []time.TimerInfo{{
+		Callback: "tick", Group: "slow", Remain: 2, Period: 2, Scale: 0.5,
+	}}, fac.Timers(e2))
+	assert.Equal(t, time.Duration(4), fac.Timers(e2)[0].Wall())
+	assert.Equal(t, time.Duration(-1), fac.Timers(e3)[0].Wall())
+
+	for i := 0; i < 4; i++ {
+		fac.Process()
+	}
+	assert.Equal(t, []string{"tick 1", "tick 1", "tick 2"}, log)
+	assert.Equal(t, time.Time(2), fac.GroupNow("slow"))
+	assert.True(t, fac.Paused("frozen"))
+
+	// timers, their groups, and named callbacks survive snapshots
+	data, err := fac.SaveSnapshot()
+	require.NoError(t, err)
+	var fac2 time.Facility
+	co2 := ecs.Core{}
+	co2Data, err := co.SaveSnapshot()
+	require.NoError(t, err)
+	fac2.Init(&co2, wcTime)
+	require.NoError(t, co2.LoadSnapshot(co2Data))
+	assert.Error(t, fac2.LoadSnapshot(data), "tick is not registered")
+	log = nil
+	fac2.RegisterCallback("tick", func(ent ecs.Entity) { log = append(log, fmt.Sprintf("tick %v", ent.ID())) })
+	require.NoError(t, fac2.LoadSnapshot(data))
+	assert.Equal(t, fac.Timers(e3), fac2.Timers(co2.Ref(e3.ID())))
+	assert.Equal(t, "slow", fac2.Group(co2.Ref(e2.ID())))
+
+	// moving between groups keeps remaining time; resuming restarts time
+	fac2.SetGroup(co2.Ref(e2.ID()), "")
+	fac2.Resume("frozen")
+	fac2.Process()
+	fac2.Process()
+	assert.Equal(t, []string{"tick 1", "tick 2", "tick 3"}, log)
+}
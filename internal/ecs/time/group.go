@@ -0,0 +1,135 @@
+package time
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/borkshop/bork/internal/ecs"
+)
+
+// timerGroup keeps the time for a group of entities, and the heap of their
+// pending timers.
+type timerGroup struct {
+	name   string
+	now    Time
+	scale  float64
+	acc    float64 // fractional ticks, carried between advances
+	paused bool
+	due    timerHeap
+}
+
+// advance moves the group's time forward by its scale, returning true if it
+// moved by at least one tick.
+func (g *timerGroup) advance() bool {
+	if g.paused {
+		return false
+	}
+	g.acc += g.scale
+	// tolerate rounding error, e.g. from ten steps of 0.1
+	n := math.Floor(g.acc + 1e-9)
+	if n < 1 {
+		return false
+	}
+	g.acc = math.Max(0, g.acc-n)
+	g.now = g.now.Add(Duration(n))
+	return true
+}
+
+// findGroup returns the named timer group, or nil if there is none.
+func (fac *Facility) findGroup(name string) *timerGroup {
+	for _, g := range fac.groups {
+		if g.name == name {
+			return g
+		}
+	}
+	return nil
+}
+
+// group returns the named timer group, creating it if necessary.
+func (fac *Facility) group(name string) *timerGroup {
+	if g := fac.findGroup(name); g != nil {
+		return g
+	}
+	g := &timerGroup{name: name, scale: 1}
+	fac.groups = append(fac.groups, g)
+	return g
+}
+
+func (fac *Facility) entGroup(id ecs.EntityID) *timerGroup {
+	if g := fac.grps[id]; g != nil {
+		return g
+	}
+	return fac.groups[0]
+}
+
+// SetGroup moves the given entity into the named timer group, along with all
+// of its timers; their remaining time carries over into the new group's time.
+// The empty name is the default group. Panics if the entity does not belong to
+// the Facility's core.
+func (fac *Facility) SetGroup(ent ecs.Entity, group string) {
+	id := fac.core.Deref(ent)
+	old, g := fac.entGroup(id), fac.group(group)
+	if g == old {
+		return
+	}
+	if g == fac.groups[0] {
+		fac.grps[id] = nil
+	} else {
+		fac.grps[id] = g
+	}
+	for _, t := range fac.ents[id] {
+		remain := t.due.Sub(old.now)
+		heap.Remove(&old.due, t.i)
+		t.grp = g
+		fac.schedule(t, g.now.Add(remain))
+	}
+}
+
+// Group returns the name of the timer group that the given entity belongs to.
+func (fac *Facility) Group(ent ecs.Entity) string {
+	if !fac.core.Valid(ent) {
+		return ""
+	}
+	return fac.entGroup(ent.ID()).name
+}
+
+// Pause stops the named group's time, so that none of its timers advance
+// until it is resumed.
+func (fac *Facility) Pause(group string) { fac.group(group).paused = true }
+
+// Resume restarts the named group's time after Pause.
+func (fac *Facility) Resume(group string) { fac.group(group).paused = false }
+
+// Paused returns true only if the named group is paused.
+func (fac *Facility) Paused(group string) bool {
+	g := fac.findGroup(group)
+	return g != nil && g.paused
+}
+
+// SetScale sets how many ticks of the named group's time pass for every
+// Process()ing tick; e.g. 0.5 for half speed, or 2 for double. Fractional
+// ticks accumulate until they make up a whole one. Panics if the scale is
+// negative or infinite.
+func (fac *Facility) SetScale(group string, scale float64) {
+	if scale < 0 || math.IsNaN(scale) || math.IsInf(scale, 0) {
+		panic("invalid timer group scale")
+	}
+	fac.group(group).scale = scale
+}
+
+// Scale returns the named group's time scale.
+func (fac *Facility) Scale(group string) float64 {
+	if g := fac.findGroup(group); g != nil {
+		return g.scale
+	}
+	return 1
+}
+
+// GroupNow returns the named group's current time; a group that has never
+// been used has no time yet.
+func (fac *Facility) GroupNow(group string) Time {
+	if g := fac.findGroup(group); g != nil {
+		return g.now
+	}
+	return 0
+}
@@ -0,0 +1,338 @@
+package time
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/borkshop/bork/internal/ecs"
+)
+
+// NormalSpeed is the speed of an actor that gains one tick's worth of action
+// energy for every tick of time; see Scheduler.
+const NormalSpeed = 100
+
+// Scheduler implements an energy based turn scheduler for (roguelike) actors,
+// attached to an ecs.Core.
+//
+// Every actor has a speed, and gains that much energy for every tick of time
+// that passes. Taking an action costs NormalSpeed energy for every tick of its
+// Duration, and an actor may act whenever its energy is not negative; so an
+// actor at twice NormalSpeed acts twice as often as one at NormalSpeed, given
+// actions of the same cost. Any energy left over after an action carries into
+// the next turn.
+//
+// Rather than counting energy every tick, actors are kept in a heap ordered by
+// when they will next be ready, and time skips ahead to the next ready actor;
+// actors ready at the same time take turns in the order that they were queued.
+type Scheduler struct {
+	// Tick, if set, is called for every tick of time that passes, after Now has
+	// advanced; e.g. to Process a Facility in step with actor turns.
+	Tick func(now Time)
+
+	core *ecs.Core
+	t    ecs.ComponentType
+
+	now    Time
+	seq    uint64
+	actors []*actor
+	ready  actorHeap
+	cur    *actor
+}
+
+type actor struct {
+	id     ecs.EntityID
+	speed  int
+	energy int  // as of time at
+	at     Time // when energy was last settled
+	ready  Time // when energy will next be non-negative
+
+	seq uint64 // breaks ties between actors ready at the same time
+	i   int    // index within the heap; < 0 when not queued
+}
+
+// Init sets up the scheduler, attached to the given ecs.Core, and using the
+// supplied ComponentType to indicate "is an actor"; adding the type makes an
+// entity an actor, at NormalSpeed, and ready to act immediately. The given
+// ComponentType MUST NOT be registered by another allocator.
+func (s *Scheduler) Init(core *ecs.Core, t ecs.ComponentType) {
+	if s.core != nil {
+		panic("Scheduler already initialized")
+	}
+	s.core = core
+	s.t = t
+	s.actors = []*actor{nil}
+	s.core.RegisterAllocator(s.t, s.alloc)
+	s.core.RegisterCreator(s.t, s.create)
+	s.core.RegisterRemapper(s.t, s.remap)
+	s.core.RegisterDestroyer(s.t, s.destroy)
+}
+
+// Now returns the current time, which advances as Next skips ahead to the
+// next ready actor.
+func (s *Scheduler) Now() Time { return s.now }
+
+// Next returns the actor whose turn it is, advancing time until some actor is
+// ready. The turn lasts until the actor Acts: until then, Next keeps
+// returning the same actor; e.g. a player's turn blocks while waiting for
+// input, after every actor ahead of it has acted. Returns false if there are
+// no actors ready to ever act.
+func (s *Scheduler) Next() (ecs.Entity, bool) {
+	for s.cur == nil {
+		if len(s.ready) == 0 {
+			return ecs.NilEntity, false
+		}
+		if ready := s.ready[0].ready; ready > s.now {
+			if s.Tick == nil {
+				s.now = ready
+			} else {
+				s.advance()
+			}
+			continue
+		}
+		s.cur = heap.Pop(&s.ready).(*actor)
+	}
+	return s.core.Ref(s.cur.id), true
+}
+
+func (s *Scheduler) advance() {
+	s.now = s.now.Add(1)
+	if s.now == math.MaxUint64 {
+		panic("The End is Now!")
+	}
+	s.Tick(s.now)
+}
+
+// Current returns the actor whose turn it is, or NilEntity if Next has yet to
+// be called since the last turn ended.
+func (s *Scheduler) Current() ecs.Entity {
+	if s.cur == nil {
+		return ecs.NilEntity
+	}
+	return s.core.Ref(s.cur.id)
+}
+
+// Act spends the energy for an action of the given cost by the given actor,
+// ending its turn if it is the current actor. Actors may act out of turn,
+// e.g. to react, at the expense of their next turn; zero cost actions are
+// free. Panics if the entity is not an actor, or the cost is negative.
+func (s *Scheduler) Act(ent ecs.Entity, cost Duration) {
+	if cost < 0 {
+		panic("invalid action cost")
+	}
+	a := s.actor(ent)
+	s.settle(a)
+	a.energy -= int(cost) * NormalSpeed
+	if a == s.cur {
+		s.cur = nil
+	}
+	s.requeue(a)
+}
+
+// SetSpeed sets how much energy the given actor gains every tick, making the
+// entity an actor if it isn't already; a speed of 0 means that it will never
+// regain any spent energy. Panics if the speed is negative.
+func (s *Scheduler) SetSpeed(ent ecs.Entity, speed int) {
+	if speed < 0 {
+		panic("invalid actor speed")
+	}
+	s.core.Deref(ent)
+	ent.Add(s.t)
+	a := s.actor(ent)
+	s.settle(a)
+	a.speed = speed
+	if a != s.cur {
+		s.requeue(a)
+	}
+}
+
+// Speed returns the given actor's speed, or 0 if the entity is not an actor.
+func (s *Scheduler) Speed(ent ecs.Entity) int {
+	if a := s.lookup(ent); a != nil {
+		return a.speed
+	}
+	return 0
+}
+
+// Energy returns the given actor's current energy; it is negative while the
+// actor is recovering from its last action.
+func (s *Scheduler) Energy(ent ecs.Entity) int {
+	if a := s.lookup(ent); a != nil {
+		return a.energy + a.speed*int(s.now.Sub(a.at))
+	}
+	return 0
+}
+
+// Turn returns when the given actor will next be ready to act; the bool is
+// false if it is not an actor, or will never be ready at its current speed.
+func (s *Scheduler) Turn(ent ecs.Entity) (Time, bool) {
+	a := s.lookup(ent)
+	switch {
+	case a == nil:
+		return 0, false
+	case a == s.cur:
+		return s.now, true
+	case a.i < 0:
+		return 0, false
+	}
+	return a.ready, true
+}
+
+type schedulerSnapshot struct {
+	Now     Time            `json:"now"`
+	Current ecs.EntityID    `json:"current,omitempty"`
+	Actors  []actorSnapshot `json:"actors"`
+}
+
+type actorSnapshot struct {
+	ID     ecs.EntityID `json:"id"`
+	Speed  int          `json:"speed"`
+	Energy int          `json:"energy"`
+}
+
+// SaveSnapshot saves the current time, and the speed and energy of every
+// actor; the Core must be saved separately.
+func (s *Scheduler) SaveSnapshot() ([]byte, error) {
+	ss := schedulerSnapshot{Now: s.now}
+	if s.cur != nil {
+		ss.Current = s.cur.id
+	}
+	for it := s.core.Iter(s.t.All()); it.Next(); {
+		ss.Actors = append(ss.Actors, actorSnapshot{it.ID(), s.actors[it.ID()].speed, s.Energy(it.Entity())})
+	}
+	return json.Marshal(ss)
+}
+
+// LoadSnapshot restores the current time, and every actor's speed and energy,
+// replacing any existing actors; the Core must already have been loaded.
+// Actors ready at the same time take turns in ID order after loading.
+func (s *Scheduler) LoadSnapshot(data []byte) error {
+	var ss schedulerSnapshot
+	if err := json.Unmarshal(data, &ss); err != nil {
+		return err
+	}
+	for _, as := range ss.Actors {
+		if as.ID <= 0 || int(as.ID) >= len(s.actors) {
+			return fmt.Errorf("invalid actor snapshot entity %v", as.ID)
+		}
+	}
+	s.now, s.cur = ss.Now, nil
+	s.ready = s.ready[:0]
+	for id := range s.actors {
+		s.actors[id] = nil
+	}
+	for _, as := range ss.Actors {
+		a := &actor{id: as.ID, speed: as.Speed, energy: as.Energy, at: s.now, i: -1}
+		s.actors[as.ID] = a
+		if as.ID == ss.Current {
+			s.cur = a
+		} else {
+			s.requeue(a)
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) lookup(ent ecs.Entity) *actor {
+	if !s.core.Valid(ent) || !ent.Type().HasAll(s.t) {
+		return nil
+	}
+	return s.actors[ent.ID()]
+}
+
+func (s *Scheduler) actor(ent ecs.Entity) *actor {
+	a := s.lookup(ent)
+	if a == nil {
+		panic(fmt.Sprintf("entity %v is not an actor", ent))
+	}
+	return a
+}
+
+// settle brings the actor's energy up to date.
+func (s *Scheduler) settle(a *actor) {
+	a.energy += a.speed * int(s.now.Sub(a.at))
+	a.at = s.now
+}
+
+// requeue (re)places the actor in the heap, according to when its energy
+// will next be non-negative; the actor must have been settled.
+func (s *Scheduler) requeue(a *actor) {
+	if a.i >= 0 {
+		heap.Remove(&s.ready, a.i)
+	}
+	switch {
+	case a.energy >= 0:
+		a.ready = s.now
+	case a.speed == 0:
+		return // never
+	default:
+		need := -a.energy
+		a.ready = s.now.Add(Duration((need + a.speed - 1) / a.speed))
+	}
+	s.seq++
+	a.seq = s.seq
+	heap.Push(&s.ready, a)
+}
+
+func (s *Scheduler) alloc(id ecs.EntityID, t ecs.ComponentType) {
+	s.actors = append(s.actors, nil)
+}
+
+func (s *Scheduler) create(id ecs.EntityID, t ecs.ComponentType) {
+	a := &actor{id: id, speed: NormalSpeed, at: s.now, i: -1}
+	s.actors[id] = a
+	s.requeue(a)
+}
+
+func (s *Scheduler) remap(rm ecs.Remap) {
+	rm.Each(func(old, new ecs.EntityID) {
+		s.actors[new] = s.actors[old]
+		if a := s.actors[new]; a != nil {
+			a.id = new
+		}
+	})
+	s.actors = s.actors[:rm.Len()+1]
+}
+
+func (s *Scheduler) destroy(id ecs.EntityID, t ecs.ComponentType) {
+	a := s.actors[id]
+	if a == nil {
+		return
+	}
+	if a.i >= 0 {
+		heap.Remove(&s.ready, a.i)
+	}
+	if a == s.cur {
+		s.cur = nil
+	}
+	s.actors[id] = nil
+}
+
+// actorHeap implements heap.Interface, ordering actors by when they are ready.
+type actorHeap []*actor
+
+func (ah actorHeap) Len() int { return len(ah) }
+func (ah actorHeap) Less(i, j int) bool {
+	if ah[i].ready != ah[j].ready {
+		return ah[i].ready < ah[j].ready
+	}
+	return ah[i].seq < ah[j].seq
+}
+func (ah actorHeap) Swap(i, j int) {
+	ah[i], ah[j] = ah[j], ah[i]
+	ah[i].i, ah[j].i = i, j
+}
+func (ah *actorHeap) Push(x interface{}) {
+	a := x.(*actor)
+	a.i = len(*ah)
+	*ah = append(*ah, a)
+}
+func (ah *actorHeap) Pop() interface{} {
+	old := *ah
+	a := old[len(old)-1]
+	old[len(old)-1] = nil
+	a.i = -1
+	*ah = old[:len(old)-1]
+	return a
+}
@@ -0,0 +1,85 @@
+package time_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/borkshop/bork/internal/ecs"
+	"github.com/borkshop/bork/internal/ecs/time"
+)
+
+func TestScheduler(t *testing.T) {
+	var (
+		co    ecs.Core
+		sched time.Scheduler
+		ticks int
+	)
+	sched.Init(&co, wcTime)
+	sched.Tick = func(now time.Time) { ticks++ }
+
+	normal, fast, slow := co.AddEntity(wcTime), co.AddEntity(wcFoo), co.AddEntity(wcFoo)
+	sched.SetSpeed(fast, 2*time.NormalSpeed)
+	sched.SetSpeed(slow, time.NormalSpeed/2)
+	assert.Equal(t, time.NormalSpeed, sched.Speed(normal))
+	assert.Panics(t, func() { sched.Act(co.AddEntity(wcFoo), 1) })
+
+	names := map[ecs.Entity]string{normal: "normal", fast: "fast", slow: "slow"}
+	var turns []string
+	for len(turns) < 10 {
+		ent, ok := sched.Next()
+		require.True(t, ok)
+		turns = append(turns, sched.Now().String()+" "+names[ent])
+		sched.Act(ent, 1)
+	}
+	assert.Equal(t, []string{
+		"t0 normal", "t0 fast", "t0 slow",
+		"t1 normal", "t1 fast", "t1 fast",
+		"t2 slow", "t2 normal", "t2 fast", "t2 fast",
+	}, turns)
+	assert.Equal(t, 2, ticks)
+
+	// the current actor keeps its turn until it acts
+	player, ok := sched.Next()
+	require.True(t, ok)
+	assert.Equal(t, "normal", names[player])
+	again, _ := sched.Next()
+	assert.Equal(t, player, again)
+	assert.Equal(t, player, sched.Current())
+	sched.Act(player, 3)
+	assert.Equal(t, ecs.NilEntity, sched.Current())
+	assert.Equal(t, -300, sched.Energy(player))
+	turn, _ := sched.Turn(player)
+	assert.Equal(t, time.Time(6), turn)
+
+	// snapshots keep energy and the current turn
+	ent, _ := sched.Next()
+	assert.Equal(t, "fast", names[ent])
+	data, err := sched.SaveSnapshot()
+	require.NoError(t, err)
+	coData, err := co.SaveSnapshot()
+	require.NoError(t, err)
+	var (
+		co2    ecs.Core
+		sched2 time.Scheduler
+	)
+	sched2.Init(&co2, wcTime)
+	require.NoError(t, co2.LoadSnapshot(coData))
+	require.NoError(t, sched2.LoadSnapshot(data))
+	assert.Equal(t, ent.ID(), sched2.Current().ID())
+	assert.Equal(t, sched.Energy(player), sched2.Energy(co2.Ref(player.ID())))
+	turn2, _ := sched2.Turn(co2.Ref(player.ID()))
+	assert.Equal(t, turn, turn2)
+
+	// stopped and destroyed actors never get another turn
+	sched.SetSpeed(fast, 0)
+	sched.Act(fast, 2)
+	_, ok = sched.Turn(fast)
+	assert.False(t, ok)
+	slow.Destroy()
+	player.Destroy()
+	ent, ok = sched.Next()
+	assert.False(t, ok)
+	assert.Equal(t, ecs.NilEntity, ent)
+}
@@ -0,0 +1,208 @@
+package ecs
+
+import "sort"
+
+// View is a persistent query: a set of entities that satisfy a TypeClause,
+// which the Core keeps up to date as entity types change. Iterating a View
+// only costs as much as its matching entities, and its Len is O(1).
+//
+// Unlike Core.Iter, a View only ever contains live entities, even if its
+// clause matches NoType.
+type View struct {
+	co  *Core
+	tcl TypeClause
+	ids []EntityID // sorted
+	in  []bool     // by id-1
+}
+
+// View registers and returns a new View of all entities which satisfy all of
+// the given TypeClause(s). Views should be created once, and kept for the life
+// of the Core (or until Closed), since every type change must update them.
+func (co *Core) View(tcls ...TypeClause) *View {
+	v := &View{co: co}
+	switch len(tcls) {
+	case 0:
+		v.tcl = TrueClause
+	case 1:
+		v.tcl = tcls[0]
+	default:
+		v.tcl = And(tcls...)
+	}
+	v.rebuild()
+	co.views = append(co.views, v)
+	return v
+}
+
+// Close unregisters the view from its Core; it stops being kept up to date.
+func (v *View) Close() {
+	for i, ov := range v.co.views {
+		if ov == v {
+			copy(v.co.views[i:], v.co.views[i+1:])
+			v.co.views[len(v.co.views)-1] = nil
+			v.co.views = v.co.views[:len(v.co.views)-1]
+			return
+		}
+	}
+}
+
+// Clause returns the view's TypeClause.
+func (v *View) Clause() TypeClause { return v.tcl }
+
+// Len returns how many entities are in the view.
+func (v *View) Len() int { return len(v.ids) }
+
+// Has returns true only if the given entity is live, and in the view.
+func (v *View) Has(ent Entity) bool {
+	return ent.co == v.co && ent.live() && v.has(ent.id)
+}
+
+// Iter returns an iterator over the view's entities, in ID order (just like
+// Core.Iter). Entities may safely enter or leave the view during iteration;
+// any that enter behind the iterator are not visited.
+func (v *View) Iter() Iterator { return &viewIterator{v: v, i: -1} }
+
+func (v *View) has(id EntityID) bool {
+	return int(id) <= len(v.in) && v.in[id-1]
+}
+
+// update the view after an entity's type changed.
+func (v *View) update(id EntityID, t TypeMask) {
+	want := !t.IsZero() && v.tcl.test(t)
+	if want == v.has(id) {
+		return
+	}
+	i := sort.Search(len(v.ids), func(i int) bool { return v.ids[i] >= id })
+	if want {
+		for len(v.in) < int(id) {
+			v.in = append(v.in, false)
+		}
+		v.in[id-1] = true
+		v.ids = append(v.ids, 0)
+		copy(v.ids[i+1:], v.ids[i:])
+		v.ids[i] = id
+	} else {
+		v.in[id-1] = false
+		copy(v.ids[i:], v.ids[i+1:])
+		v.ids = v.ids[:len(v.ids)-1]
+	}
+}
+
+// rebuild the view from scratch, e.g. after Compact.
+func (v *View) rebuild() {
+	v.ids = v.ids[:0]
+	v.in = v.in[:0]
+	for i, t := range v.co.types {
+		in := !t.IsZero() && v.tcl.test(t)
+		v.in = append(v.in, in)
+		if in {
+			v.ids = append(v.ids, EntityID(i+1))
+		}
+	}
+}
+
+func (co *Core) updateViews(id EntityID) {
+	t := co.types[id-1]
+	for _, v := range co.views {
+		v.update(id, t)
+	}
+}
+
+func (co *Core) rebuildViews() {
+	for _, v := range co.views {
+		v.rebuild()
+	}
+}
+
+// viewIterator tracks its position by ID, so that it may survive the view
+// changing under it.
+type viewIterator struct {
+	v  *View
+	i  int
+	id EntityID
+}
+
+func (it *viewIterator) Next() bool {
+	ids := it.v.ids
+	if it.i >= 0 && it.i < len(ids) && ids[it.i] == it.id {
+		it.i++
+	} else {
+		it.i = sort.Search(len(ids), func(i int) bool { return ids[i] > it.id })
+	}
+	if it.i < len(ids) {
+		it.id = ids[it.i]
+		return true
+	}
+	it.id = 0
+	return false
+}
+
+func (it *viewIterator) Reset() { it.i, it.id = -1, 0 }
+
+// Count returns how many entities remain to be iterated; it is O(1) unless the
+// view has changed since the last call to Next.
+func (it viewIterator) Count() int {
+	ids := it.v.ids
+	i := it.i + 1
+	if it.i < 0 || it.i >= len(ids) || ids[it.i] != it.id {
+		i = sort.Search(len(ids), func(i int) bool { return ids[i] > it.id })
+	}
+	return len(ids) - i
+}
+
+func (it viewIterator) Type() ComponentType { return it.Mask().Type() }
+
+func (it viewIterator) Mask() TypeMask {
+	if it.id == 0 {
+		return NoMask
+	}
+	return it.v.co.types[it.id-1]
+}
+
+func (it viewIterator) ID() EntityID { return it.id }
+
+func (it viewIterator) Entity() Entity {
+	if it.id == 0 {
+		return NilEntity
+	}
+	return it.v.co.Ref(it.id)
+}
+
+// apply makes a View a CursorOpt, limiting a relation cursor to the view's
+// relation entities; panics if the view doesn't belong to the Relation's Core.
+func (v *View) apply(rel *Relation, cur Cursor) Cursor {
+	if v.co != &rel.Core {
+		panic("foreign view")
+	}
+	if cur == nil {
+		return &viewCursor{rel: rel, it: viewIterator{v: v, i: -1}}
+	}
+	return Filter(func(cur Cursor) bool { return v.has(cur.R().ID()) }).apply(rel, cur)
+}
+
+type viewCursor struct {
+	rel *Relation
+	it  viewIterator
+	r   Entity
+	a   Entity
+	b   Entity
+}
+
+func (cur viewCursor) Count() int { return cur.it.Count() }
+
+func (cur *viewCursor) Scan() bool {
+	if cur.it.Next() {
+		rid := cur.it.ID()
+		cur.r = cur.it.Entity()
+		cur.a = cur.rel.aRef(rid)
+		cur.b = cur.rel.bRef(rid)
+		return true
+	}
+	cur.r = NilEntity
+	cur.a = NilEntity
+	cur.b = NilEntity
+	return false
+}
+
+func (cur viewCursor) R() Entity { return cur.r }
+func (cur viewCursor) A() Entity { return cur.a }
+func (cur viewCursor) B() Entity { return cur.b }
@@ -0,0 +1,80 @@
+package ecs_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/borkshop/bork/internal/ecs"
+)
+
+func TestView(t *testing.T) {
+	s := newStuff()
+	v := s.View(scD2.All())
+	all := s.View()
+
+	e1 := s.addData(1, 1)
+	e2 := s.addData(2)
+	e3 := s.addData(3, 3)
+	s.AddEntity(ecs.NoType) // an unused slot
+	assert.Equal(t, 2, v.Len())
+	assert.Equal(t, 3, all.Len(), "views only contain live entities")
+	assert.True(t, v.Has(e1))
+	assert.False(t, v.Has(e2))
+
+	ids := func(it ecs.Iterator) (ids []ecs.EntityID) {
+		for it.Next() {
+			ids = append(ids, it.ID())
+		}
+		return ids
+	}
+	assert.Equal(t, []ecs.EntityID{e1.ID(), e3.ID()}, ids(v.Iter()))
+
+	// changes during iteration
+	it := v.Iter()
+	assert.Equal(t, 2, it.Count())
+	assert.True(t, it.Next())
+	assert.Equal(t, e1, it.Entity())
+	assert.Equal(t, 1, it.Count())
+	e2.Add(scD2)
+	e1.Destroy()
+	assert.Equal(t, 2, it.Count())
+	assert.True(t, it.Next())
+	assert.Equal(t, e2, it.Entity())
+	assert.True(t, it.Next())
+	assert.Equal(t, e3, it.Entity())
+	assert.Equal(t, scData|scD2, it.Type())
+	assert.False(t, it.Next())
+	assert.Equal(t, ecs.NilEntity, it.Entity())
+	it.Reset()
+	assert.Equal(t, []ecs.EntityID{e2.ID(), e3.ID()}, ids(it))
+
+	// compaction rebuilds views
+	rm := s.Compact()
+	e2, e3 = rm.Entity(e2), rm.Entity(e3)
+	assert.Equal(t, []ecs.EntityID{e2.ID(), e3.ID()}, ids(v.Iter()))
+	assert.True(t, v.Has(e2))
+
+	// closed views are no longer maintained
+	all.Close()
+	s.addData(4)
+	assert.Equal(t, 2, all.Len())
+
+	// views over a relation may be selected
+	rel := ecs.NewRelation(&s.Core, 0, &s.Core, 0)
+	bars := rel.View(srBar.All())
+	rel.Upsert(nil, func(uc *ecs.UpsertCursor) {
+		uc.Create(srFoo, e2, e3)
+		uc.Create(srBar, e3, e2)
+		uc.Create(srFoo|srBar, e2, e2)
+	})
+	cur := rel.Select(bars)
+	assert.Equal(t, 2, cur.Count())
+	var got [][2]ecs.EntityID
+	for cur.Scan() {
+		got = append(got, [2]ecs.EntityID{cur.A().ID(), cur.B().ID()})
+	}
+	assert.Equal(t, [][2]ecs.EntityID{{e3.ID(), e2.ID()}, {e2.ID(), e2.ID()}}, got)
+	assert.Equal(t, 1, rel.Select(srFoo.All(), bars).Count())
+	assert.Panics(t, func() { rel.Select(v) })
+}
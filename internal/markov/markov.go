@@ -3,6 +3,7 @@ package markov
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"math/rand"
 	"sort"
 
@@ -37,6 +38,7 @@ func (tab *Table) Init(core *ecs.Core) {
 	tab.weights = [][]int{nil}
 	tab.next = [][]ecs.EntityID{nil}
 	core.RegisterAllocator(componentTransition, tab.allocTransition)
+	core.RegisterRemapper(componentTransition, tab.remapTransition)
 	core.RegisterDestroyer(componentTransition, tab.destroyTransition)
 }
 
@@ -45,6 +47,28 @@ func (tab *Table) allocTransition(id ecs.EntityID, t ecs.ComponentType) {
 	tab.next = append(tab.next, nil)
 }
 
+func (tab *Table) remapTransition(rm ecs.Remap) {
+	rm.Each(func(old, new ecs.EntityID) {
+		tab.weights[new], tab.weights[old] = tab.weights[old], nil
+		tab.next[new], tab.next[old] = tab.next[old], nil
+	})
+	tab.weights = tab.weights[:rm.Len()+1]
+	tab.next = tab.next[:rm.Len()+1]
+
+	// compaction preserves order, so next stays sorted; just drop any
+	// transitions to since-destroyed entities
+	for id, next := range tab.next {
+		weights, j := tab.weights[id], 0
+		for i, nid := range next {
+			if nid = rm.ID(nid); nid != 0 {
+				next[j], weights[j] = nid, weights[i]
+				j++
+			}
+		}
+		tab.next[id], tab.weights[id] = next[:j], weights[:j]
+	}
+}
+
 func (tab *Table) destroyTransition(id ecs.EntityID, t ecs.ComponentType) {
 	tab.weights[id] = tab.weights[id][:0]
 	tab.next[id] = tab.next[id][:0]
@@ -108,43 +132,56 @@ type serd struct {
 	Weights []int          `json:"weights"`
 }
 
-// MarhsalJSON marshal's the markov transition data into a json array.
-func (tab *Table) MarhsalJSON() ([]byte, error) {
-	it := tab.Iter(componentTransition.All())
-	data := make([]serd, 0, it.Count())
-	for it.Next() {
-		id := it.ID()
-		data = append(data, serd{
-			ID:      id,
-			Next:    tab.next[id],
-			Weights: tab.weights[id],
-		})
+// MarshalJSON marshal's the markov transition data into a json array.
+func (tab *Table) MarshalJSON() ([]byte, error) {
+	var data []serd
+	for id, next := range tab.next {
+		if len(next) > 0 {
+			data = append(data, serd{
+				ID:      ecs.EntityID(id),
+				Next:    next,
+				Weights: tab.weights[id],
+			})
+		}
 	}
 	return json.Marshal(data)
 }
 
 // UnmarshalJSON unmarshal's markov transition data into this table; table must
-// be empty.
+// not have any transitions, and its Core must already have every referenced
+// entity.
 func (tab *Table) UnmarshalJSON(d []byte) error {
-	if tab.Len() > 0 {
-		return errors.New("markov table already has data")
+	for _, next := range tab.next {
+		if len(next) > 0 {
+			return errors.New("markov table already has data")
+		}
 	}
 	var data []serd
 	if err := json.Unmarshal(d, &data); err != nil {
 		return err
 	}
-
-	n := ecs.EntityID(0)
+	n := ecs.EntityID(tab.Cap())
 	for _, dat := range data {
-		if dat.ID >= n {
-			n = dat.ID
+		if dat.ID <= 0 || dat.ID > n || len(dat.Next) != len(dat.Weights) {
+			return fmt.Errorf("invalid markov transition data for %v", dat.ID)
+		}
+		for _, id := range dat.Next {
+			if id <= 0 || id > n {
+				return fmt.Errorf("invalid markov transition %v -> %v", dat.ID, id)
+			}
 		}
 	}
-	tab.next = make([][]ecs.EntityID, n)
-	tab.weights = make([][]int, n)
 	for _, dat := range data {
 		tab.next[dat.ID] = dat.Next
 		tab.weights[dat.ID] = dat.Weights
 	}
 	return nil
 }
+
+// SaveSnapshot saves the markov transition data; the Core must be saved
+// separately.
+func (tab *Table) SaveSnapshot() ([]byte, error) { return tab.MarshalJSON() }
+
+// LoadSnapshot loads markov transition data; the Core must already have been
+// loaded.
+func (tab *Table) LoadSnapshot(data []byte) error { return tab.UnmarshalJSON(data) }
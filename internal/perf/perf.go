@@ -32,6 +32,23 @@ type Perf struct {
 	i        int
 	time     [numSamples]struct{ start, end time.Time }
 	memStats [numSamples]runtime.MemStats
+
+	procNames []string
+	procTimes map[string]*procSamples
+}
+
+// ProcTime summarizes recent timings of a named proc.
+type ProcTime struct {
+	Name string
+	Last time.Duration
+	Avg  time.Duration
+	Max  time.Duration
+}
+
+type procSamples struct {
+	n       int
+	i       int
+	elapsed [numSamples]time.Duration
 }
 
 // Init sets up the perf system, writing results into a timestamped directory
@@ -74,6 +91,52 @@ func (perf *Perf) Process() {
 	perf.i = (perf.i + 1) % numSamples
 }
 
+// RecordProc records how long a named proc took to run; it may be used as an
+// ecs.Schedule Hook.
+func (perf *Perf) RecordProc(name string, elapsed time.Duration) {
+	ps, def := perf.procTimes[name]
+	if !def {
+		if perf.procTimes == nil {
+			perf.procTimes = make(map[string]*procSamples)
+		}
+		ps = &procSamples{}
+		perf.procTimes[name] = ps
+		perf.procNames = append(perf.procNames, name)
+	}
+	ps.elapsed[ps.i] = elapsed
+	ps.i = (ps.i + 1) % numSamples
+	if ps.n < numSamples {
+		ps.n++
+	}
+}
+
+// ProcTimes returns a summary of recent timings for every proc recorded by
+// RecordProc, in the order that they were first recorded.
+func (perf *Perf) ProcTimes() []ProcTime {
+	pts := make([]ProcTime, len(perf.procNames))
+	for i, name := range perf.procNames {
+		ps := perf.procTimes[name]
+		pt := ProcTime{Name: name}
+		if ps.n > 0 {
+			j := ps.i - 1
+			if j < 0 {
+				j += numSamples
+			}
+			pt.Last = ps.elapsed[j]
+			var sum time.Duration
+			for _, d := range ps.elapsed[:ps.n] {
+				sum += d
+				if d > pt.Max {
+					pt.Max = d
+				}
+			}
+			pt.Avg = sum / time.Duration(ps.n)
+		}
+		pts[i] = pt
+	}
+	return pts
+}
+
 // Start requests profiling to start, this happens during the next Process
 // round.
 func (perf *Perf) Start() { perf.shouldProfile = true }
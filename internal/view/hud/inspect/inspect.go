@@ -0,0 +1,311 @@
+package inspect
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	termbox "github.com/nsf/termbox-go"
+
+	"github.com/borkshop/bork/internal/ecs"
+	"github.com/borkshop/bork/internal/ecs/eps"
+	"github.com/borkshop/bork/internal/ecs/time"
+	"github.com/borkshop/bork/internal/moremath"
+	"github.com/borkshop/bork/internal/point"
+	"github.com/borkshop/bork/internal/view"
+	"github.com/borkshop/bork/internal/view/hud/prompt"
+)
+
+// Inspector is a debugging overlay that shows what an entity is: its type bits
+// by name, its position and timer (if any), and every relation that it takes
+// part in. It lists all entities matching a clause, and can navigate between
+// them, and to related entities.
+//
+// Only Core is required; any other field may be left zero.
+type Inspector struct {
+	Core   *ecs.Core
+	Names  *ecs.TypeNames // defaults to ecs.DefaultTypeNames
+	Pos    *eps.EPS
+	Timers *time.Facility
+
+	rels    []relation
+	clause  ecs.TypeClause
+	matches []ecs.Entity
+	i       int
+	cur     ecs.Entity
+	back    []ecs.Entity
+	lines   []string
+	related []ecs.Entity
+}
+
+// maxBack limits how many prior selections Back may return to.
+const maxBack = 32
+
+type relation struct {
+	name  string
+	rel   *ecs.Relation
+	of    func(ecs.Entity) *ecs.Relation
+	names *ecs.TypeNames
+}
+
+// Relation adds a relation to show rows from; names, if non-nil, is used to
+// name the relation's own type bits.
+func (ins *Inspector) Relation(name string, rel *ecs.Relation, names *ecs.TypeNames) {
+	ins.rels = append(ins.rels, relation{name, rel, nil, names})
+}
+
+// RelationOf adds a relation to show every row from, as found for each
+// selected entity by the given function; e.g. one held by the entity's own
+// component data. The function returns nil if the entity has no such relation.
+func (ins *Inspector) RelationOf(name string, of func(ecs.Entity) *ecs.Relation, names *ecs.TypeNames) {
+	ins.rels = append(ins.rels, relation{name, nil, of, names})
+}
+
+// Filter sets the clause that lists entities, and selects the first match.
+func (ins *Inspector) Filter(tcl ecs.TypeClause) {
+	ins.clause = tcl
+	ins.back = ins.back[:0]
+	ins.Refresh()
+	ins.i = 0
+	ins.cur = ecs.NilEntity
+	if len(ins.matches) > 0 {
+		ins.cur = ins.matches[0]
+	}
+	ins.build()
+}
+
+// Refresh re-lists matching entities, and rebuilds details about the selected
+// entity; it should be called after each round of processing.
+func (ins *Inspector) Refresh() {
+	ins.matches = ins.matches[:0]
+	if ins.clause != nil {
+		for it := ins.Core.Iter(ins.clause); it.Next(); {
+			ins.matches = append(ins.matches, it.Entity())
+		}
+	}
+	ins.i = -1
+	for i, ent := range ins.matches {
+		if ent == ins.cur {
+			ins.i = i
+		}
+	}
+	ins.build()
+}
+
+// Entity returns the selected entity.
+func (ins *Inspector) Entity() ecs.Entity { return ins.cur }
+
+// Select an entity, remembering the prior one so that Back may return to it;
+// only the most recent selections are remembered.
+func (ins *Inspector) Select(ent ecs.Entity) {
+	if ins.cur != ecs.NilEntity && ins.cur != ent {
+		if len(ins.back) == maxBack {
+			copy(ins.back, ins.back[1:])
+			ins.back = ins.back[:maxBack-1]
+		}
+		ins.back = append(ins.back, ins.cur)
+	}
+	ins.cur = ent
+	ins.Refresh()
+}
+
+// Back returns to the previously selected entity, returning false if there
+// was none.
+func (ins *Inspector) Back() bool {
+	if len(ins.back) == 0 {
+		return false
+	}
+	ins.cur = ins.back[len(ins.back)-1]
+	ins.back = ins.back[:len(ins.back)-1]
+	ins.Refresh()
+	return true
+}
+
+// Next selects the next (or with d < 0, prior) matching entity, wrapping around.
+func (ins *Inspector) Next(d int) {
+	if n := len(ins.matches); n > 0 {
+		i := ins.i + d
+		if ins.i < 0 {
+			i = 0
+		}
+		i %= n
+		if i < 0 {
+			i += n
+		}
+		ins.Select(ins.matches[i])
+	}
+}
+
+// HandleKey handles "[" and "]" to select the prior and next matching entity,
+// and backspace to go Back.
+func (ins *Inspector) HandleKey(k view.KeyEvent) bool {
+	switch {
+	case k.Ch == '[':
+		ins.Next(-1)
+	case k.Ch == ']':
+		ins.Next(1)
+	case k.Key == termbox.KeyBackspace || k.Key == termbox.KeyBackspace2:
+		ins.Back()
+	default:
+		return false
+	}
+	return true
+}
+
+// Prompt returns a sub-prompt of the given one that navigates to any entity
+// related to the selected one.
+func (ins *Inspector) Prompt(pr prompt.Prompt) prompt.Prompt {
+	pr = pr.Sub("Related")
+	for i, ent := range ins.related {
+		if i >= len(promptRunes) {
+			break
+		}
+		pr.AddAction(promptRunes[i], related{ins, ent}, "#%v %v",
+			ent.ID(), ins.names().FormatMask(ent.Mask()))
+	}
+	return pr
+}
+
+var promptRunes = []rune("123456789abcdefghijklmnopqrstuvwxyz")
+
+type related struct {
+	ins *Inspector
+	ent ecs.Entity
+}
+
+func (rel related) RunPrompt(pr prompt.Prompt) (prompt.Prompt, bool) {
+	rel.ins.Select(rel.ent)
+	return rel.ins.Prompt(pr.Pop()), true
+}
+
+// RenderSize returns the size needed to render every detail line.
+func (ins *Inspector) RenderSize() (wanted, needed point.Point) {
+	for _, line := range ins.lines {
+		needed.X = moremath.MaxInt(needed.X, utf8.RuneCountInString(line))
+	}
+	needed.Y = len(ins.lines)
+	return needed, needed
+}
+
+// Render the detail lines.
+func (ins *Inspector) Render(g view.Grid) {
+	for y, line := range ins.lines {
+		if y >= g.Size.Y {
+			break
+		}
+		g.WriteString(0, y, "%s", line)
+	}
+}
+
+func (ins *Inspector) names() *ecs.TypeNames {
+	if ins.Names != nil {
+		return ins.Names
+	}
+	return &ecs.DefaultTypeNames
+}
+
+func (ins *Inspector) build() {
+	ins.lines = ins.lines[:0]
+	ins.related = ins.related[:0]
+	names := ins.names()
+
+	header := "Inspect"
+	if ins.clause != nil {
+		header = fmt.Sprintf("Inspect %v", names.FormatClause(ins.clause))
+	}
+	if ins.i >= 0 {
+		header += fmt.Sprintf(" [%v/%v]", ins.i+1, len(ins.matches))
+	} else {
+		header += fmt.Sprintf(" [-/%v]", len(ins.matches))
+	}
+	ins.addLine("%s", header)
+
+	ent := ins.cur
+	if !ins.Core.Valid(ent) {
+		if ent != ecs.NilEntity {
+			ins.addLine("#%v destroyed", ent.ID())
+		}
+		return
+	}
+	ins.addLine("#%v %v", ent.ID(), names.FormatMask(ent.Mask()))
+	if ins.Pos != nil {
+		if pt, ok := ins.Pos.Get(ent); ok {
+			ins.addLine("  at %v", pt)
+		}
+	}
+	if ins.Timers != nil {
+		for _, ti := range ins.Timers.Timers(ent) {
+			line := "  timer"
+			if ti.Name != "" {
+				line += " " + ti.Name
+			}
+			line += fmt.Sprintf(" %v", ti.Remain)
+			if ti.Period != 0 {
+				line += fmt.Sprintf(" every %v", ti.Period)
+			}
+			switch {
+			case ti.Paused:
+				line += " (paused)"
+			case ti.Scale != 1:
+				line += fmt.Sprintf(" (x%v)", ti.Scale)
+			}
+			ins.addLine("%s", line)
+		}
+	}
+
+	for _, rel := range ins.rels {
+		var opts []ecs.CursorOpt
+		rr := rel.rel
+		if rel.of != nil {
+			if rr = rel.of(ent); rr == nil {
+				continue
+			}
+		}
+		inA, inB := rr.ACore() == ins.Core, rr.BCore() == ins.Core
+		switch {
+		case rel.of != nil:
+			// every row
+		case inA && inB:
+			opts = append(opts, ecs.Filter(func(cur ecs.Cursor) bool {
+				return cur.A() == ent || cur.B() == ent
+			}))
+		case inA:
+			opts = append(opts, ecs.InA(ent.ID()))
+		case inB:
+			opts = append(opts, ecs.InB(ent.ID()))
+		default:
+			continue
+		}
+		rnames := rel.names
+		if rnames == nil {
+			rnames = names
+		}
+		for cur := rr.Select(opts...); cur.Scan(); {
+			a, b := cur.A(), cur.B()
+			ins.addLine("  %v#%v %v: %v -> %v", rel.name, cur.R().ID(),
+				rnames.FormatMask(cur.R().Mask()),
+				ins.side(a, inA), ins.side(b, inB))
+		}
+	}
+}
+
+// side formats one side of a relation row, noting the selected entity as "*",
+// and adding any other entity in the inspected Core to the related list.
+func (ins *Inspector) side(ent ecs.Entity, local bool) string {
+	if !local {
+		return fmt.Sprintf("^%v", ent.ID())
+	}
+	if ent == ins.cur {
+		return "*"
+	}
+	for _, rel := range ins.related {
+		if rel == ent {
+			return fmt.Sprintf("#%v", ent.ID())
+		}
+	}
+	ins.related = append(ins.related, ent)
+	return fmt.Sprintf("#%v", ent.ID())
+}
+
+func (ins *Inspector) addLine(mess string, args ...interface{}) {
+	ins.lines = append(ins.lines, fmt.Sprintf(mess, args...))
+}
@@ -0,0 +1,165 @@
+package inspect_test
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/borkshop/bork/internal/ecs"
+	"github.com/borkshop/bork/internal/ecs/eps"
+	"github.com/borkshop/bork/internal/ecs/time"
+	"github.com/borkshop/bork/internal/view"
+	. "github.com/borkshop/bork/internal/view/hud/inspect"
+	"github.com/borkshop/bork/internal/view/hud/prompt"
+)
+
+const (
+	tPos ecs.ComponentType = 1 << iota
+	tTimer
+	tWall
+	tActor
+
+	rFollow ecs.ComponentType = 1 << iota
+)
+
+func render(ins *Inspector) []string {
+	_, sz := ins.RenderSize()
+	g := view.MakeGrid(sz)
+	ins.Render(g)
+	return g.Lines(' ')
+}
+
+func TestInspector(t *testing.T) {
+	var (
+		co     ecs.Core
+		pos    eps.EPS
+		timers time.Facility
+		names  ecs.TypeNames
+	)
+	pos.Init(&co, tPos)
+	timers.Init(&co, tTimer)
+	names.Register("pos", tPos)
+	names.Register("timer", tTimer)
+	names.Register("wall", tWall)
+	names.Register("actor", tActor)
+	rel := ecs.NewRelation(&co, 0, &co, 0)
+
+	wall := co.AddEntity(tPos | tWall)
+	pos.Set(wall, image.Pt(3, 4))
+	a1 := co.AddEntity(tPos | tActor)
+	pos.Set(a1, image.Pt(1, 2))
+	a2 := co.AddEntity(tPos | tActor | tTimer)
+	pos.Set(a2, image.Pt(2, 2))
+	timers.Every(a2, 5, nil)
+	rel.Upsert(nil, func(uc *ecs.UpsertCursor) { uc.Create(rFollow, a2, a1) })
+
+	ins := Inspector{Core: &co, Names: &names, Pos: &pos, Timers: &timers}
+	ins.Relation("rel", rel, nil)
+	ins.Filter(tActor.All())
+	assert.Equal(t, a1, ins.Entity())
+	assert.Equal(t, []string{
+		"Inspect actor [1/2]  ",
+		"#2 pos|actor         ",
+		"  at (1,2)           ",
+		"  rel#1 0x10: #3 -> *",
+	}, render(&ins))
+
+	// next and prior wrap around
+	assert.True(t, ins.HandleKey(view.KeyEvent{Ch: ']'}))
+	assert.Equal(t, a2, ins.Entity())
+	assert.Equal(t, []string{
+		"Inspect actor [2/2]          ",
+		"#3 pos|timer|actor           ",
+		"  at (2,2)                   ",
+		"  timer 5 ticks every 5 ticks",
+		"  rel#1 0x10: * -> #2        ",
+	}, render(&ins))
+	ins.Next(1)
+	assert.Equal(t, a1, ins.Entity())
+	ins.Next(-1)
+	assert.Equal(t, a2, ins.Entity())
+
+	// named timers, and their group's scale or pause, are shown
+	timers.SetGroup(a2, "slow")
+	timers.SetScale("slow", 0.5)
+	timers.AfterNamed(a2, "burn", 3, nil)
+	ins.Refresh()
+	assert.Equal(t, []string{
+		"  timer 5 ticks every 5 ticks (x0.5)",
+		"  timer burn 3 ticks (x0.5)         ",
+	}, render(&ins)[3:5])
+	timers.Pause("slow")
+	ins.Refresh()
+	assert.Equal(t, "  timer burn 3 ticks (paused)         ", render(&ins)[4])
+
+	// navigate to non-matching entities, and back
+	ins.Select(wall)
+	assert.Equal(t, "Inspect actor [-/2]", render(&ins)[0])
+	assert.True(t, ins.Back())
+	assert.Equal(t, a2, ins.Entity())
+
+	// related entities are available through a prompt
+	pr := ins.Prompt(prompt.Prompt{})
+	require.Equal(t, 1, pr.Len())
+	pr, _, _ = pr.Run(0)
+	assert.Equal(t, a1, ins.Entity())
+	assert.Equal(t, 1, pr.Len(), "now prompting a1's relations")
+
+	a2.Destroy()
+	ins.Back()
+	assert.Equal(t, []string{
+		"Inspect actor [-/1]",
+		"#3 destroyed       ",
+	}, render(&ins))
+	assert.False(t, ins.HandleKey(view.KeyEvent{Ch: 'x'}))
+}
+
+func TestInspector_relationOf(t *testing.T) {
+	var co, parts ecs.Core
+	ent := co.AddEntity(tActor)
+	other := co.AddEntity(tActor)
+
+	// an entity may own relations among its own parts, and into the world
+	p1, p2 := parts.AddEntity(tWall), parts.AddEntity(tWall)
+	tree := ecs.NewRelation(&parts, 0, &parts, 0)
+	tree.Upsert(nil, func(uc *ecs.UpsertCursor) { uc.Create(rFollow, p1, p2) })
+	derived := ecs.NewRelation(&parts, 0, &co, ecs.RelationForeign)
+	derived.Upsert(nil, func(uc *ecs.UpsertCursor) { uc.Create(rFollow, p2, other) })
+	owned := func(rel *ecs.Relation) func(ecs.Entity) *ecs.Relation {
+		return func(e ecs.Entity) *ecs.Relation {
+			if e == ent {
+				return rel
+			}
+			return nil
+		}
+	}
+
+	ins := Inspector{Core: &co}
+	ins.RelationOf("tree", owned(tree), nil)
+	ins.RelationOf("derived", owned(derived), nil)
+	ins.Select(ent)
+	assert.Equal(t, []string{
+		"Inspect [-/0]             ",
+		"#1 0x8                    ",
+		"  tree#1 0x10: ^1 -> ^2   ",
+		"  derived#1 0x10: ^2 -> #2",
+	}, render(&ins))
+	ins.Select(other)
+	assert.Equal(t, []string{
+		"Inspect [-/0]",
+		"#2 0x8       ",
+	}, render(&ins))
+
+	// only the most recent selections are remembered
+	for i := 0; i < 50; i++ {
+		ins.Select(ent)
+		ins.Select(other)
+	}
+	n := 0
+	for ins.Back() {
+		n++
+	}
+	assert.Equal(t, 32, n)
+}
@@ -12,12 +12,29 @@ const (
 	aiMoveMask = wcPosition | wcInput | wcAI
 )
 
+// aiAgroQuery joins each AI with an agro relation to a solid body that has a
+// position.
+type aiAgroQuery struct {
+	ecs.Query
+	ai, targ, agro ecs.QueryVar
+}
+
+func (aq *aiAgroQuery) init(w *world) {
+	aq.ai = aq.Entity(&w.Core, aiMoveMask.All())
+	aq.targ = aq.Entity(&w.Core, (wcBody | wcSolid | wcPosition).All())
+	aq.agro = aq.Related(&w.moves.Relation, mrAgro.All(), aq.ai, aq.targ)
+	aq.Where(aq.agro, func(agro ecs.Entity) bool {
+		return w.moves.A(agro) != w.moves.B(agro) && w.moves.Mag(agro) > 0
+	})
+}
+
 func (w *world) generateAIMoves() {
-	for it := w.Iter(aiMoveMask.All()); it.Next(); {
+	targets := w.aiAgroTargets()
+	for it := w.aiMoves.Iter(); it.Next(); {
 		ai := it.Entity()
 		// TODO: if too damaged, rest
 		var move image.Point
-		if target, found := w.aiTarget(ai); found {
+		if target, found := w.aiTarget(ai, targets[ai.ID()]); found {
 			pos, _ := w.pos.Get(ai)
 			move = point.Sign(target.Sub(pos))
 		}
@@ -25,22 +42,32 @@ func (w *world) generateAIMoves() {
 	}
 }
 
-func (w *world) aiTarget(ai ecs.Entity) (image.Point, bool) {
-	// chase the thing we hate the most
-	opp, hate := ecs.NilEntity, 0
-	for cur := w.moves.Select(mrAgro.All(), ecs.InA(ai.ID())); cur.Scan(); {
-		if cur.B() == ai {
-			continue
-		}
-		// TODO: take other factors like distance into account
-		if n := w.moves.Mag(cur.R()); n > hate {
-			if b := cur.B(); b.Type().HasAll(wcBody | wcSolid) {
-				opp, hate = b, n
-			}
-		}
+// aiAgroTargets returns the thing that each AI hates the most; ties go to the
+// least entity ID.
+func (w *world) aiAgroTargets() map[ecs.EntityID]ecs.Entity {
+	// TODO: take other factors like distance into account
+	agros := make(map[ecs.Entity]struct{})
+	w.aiAgro.Each(func(res ecs.QueryResult) {
+		agros[res.Get(w.aiAgro.agro)] = struct{}{}
+	})
+	targets := make(map[ecs.EntityID]ecs.Entity)
+	for _, g := range ecs.Groups(w.moves.Select(mrAgro.All(), ecs.SortByB,
+		ecs.Filter(func(cur ecs.Cursor) bool {
+			_, def := agros[cur.R()]
+			return def
+		}),
+	), ecs.GroupByA) {
+		agro, _ := ecs.Max(g, w.moves.Mag)
+		ai, _ := g.Key()
+		targets[ai.ID()] = w.moves.B(agro)
 	}
-	if opp != ecs.NilEntity {
-		return w.pos.Get(opp)
+	return targets
+}
+
+func (w *world) aiTarget(ai, agroTarget ecs.Entity) (image.Point, bool) {
+	// chase the thing we hate the most
+	if agroTarget != ecs.NilEntity {
+		return w.pos.Get(agroTarget)
 	}
 
 	// revert to our goal...
@@ -72,7 +99,7 @@ func (w *world) aiTarget(ai ecs.Entity) (image.Point, bool) {
 		} else {
 			n := w.moves.Mag(move) + 1
 			if n >= 3 {
-				w.moves.timers.Every(w.addAgro(ai, ai, 32), 1, w.moves.decayN)
+				w.moves.timers.EveryCallback(w.addAgro(ai, ai, 32), "", 1, "decay")
 				// stuck trying to get that one, give up
 				return
 			}
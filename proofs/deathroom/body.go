@@ -14,7 +14,6 @@ import (
 const (
 	bcHP ecs.ComponentType = 1 << iota
 	bcPart
-	bcDerived
 	// TODO damage and armor components
 	bcName
 
@@ -46,6 +45,7 @@ const (
 
 const (
 	brControl ecs.ComponentType = 1 << iota
+	brDerived
 )
 
 type body struct {
@@ -58,11 +58,7 @@ type body struct {
 	dmg   []int
 	armor []int
 
-	derived []ecs.Entity // TODO: replace this with a Relation;
-	// TODO: Relation would need foreign key support (i.e. everything in the B
-	//       side may come from a different Core (body)).
-	// TODO: Relation would need a new flag "last cascades" so that destroy
-	//       only happens after the last relation is destroyed.
+	derived ecs.Relation // parts -> world entities (e.g. spirits) derived from them
 
 	coGT ecs.GraphTraverser
 }
@@ -86,19 +82,19 @@ type bodyPart struct {
 	bodyStats
 }
 
-func newBody() *body {
+func newBody(world *ecs.Core) *body {
 	bo := &body{
 		// TODO: consider eliminating the padding for EntityID(0)
-		fmt:     []string{""},
-		maxHP:   []int{0},
-		hp:      []int{0},
-		dmg:     []int{0},
-		armor:   []int{0},
-		derived: []ecs.Entity{ecs.NilEntity},
+		fmt:   []string{""},
+		maxHP: []int{0},
+		hp:    []int{0},
+		dmg:   []int{0},
+		armor: []int{0},
 	}
 	bo.rel.Init(&bo.Core, 0)
+	bo.derived.Init(&bo.Core, 0, world, ecs.RelationForeign|ecs.RelationCascadeLast)
 	bo.RegisterAllocator(bcPart, bo.allocPart)
-	bo.RegisterDestroyer(bcDerived, bo.destroyDerived)
+	bo.RegisterRemapper(bcPart, bo.remapPart)
 	bo.coGT = bo.rel.Traverse(brControl.All(), ecs.TraverseCoDFS)
 	return bo
 }
@@ -114,23 +110,30 @@ func (bo *body) allocPart(id ecs.EntityID, t ecs.ComponentType) {
 	bo.hp = append(bo.hp, 0)
 	bo.dmg = append(bo.dmg, 0)
 	bo.armor = append(bo.armor, 0)
-	bo.derived = append(bo.derived, ecs.NilEntity)
 }
 
-func (bo *body) destroyDerived(id ecs.EntityID, t ecs.ComponentType) {
-	if ent := bo.derived[id]; ent != ecs.NilEntity {
-		bo.derived[id] = ecs.NilEntity
-		any := false
-		for it := bo.Iter(bcDerived.All()); it.Next(); {
-			if bo.derived[it.ID()] == ent {
-				any = true
-				break
-			}
-		}
-		if !any {
-			ent.Destroy()
-		}
-	}
+func (bo *body) remapPart(rm ecs.Remap) {
+	rm.Each(func(old, new ecs.EntityID) {
+		bo.fmt[new], bo.fmt[old] = bo.fmt[old], ""
+		bo.maxHP[new], bo.maxHP[old] = bo.maxHP[old], 0
+		bo.hp[new], bo.hp[old] = bo.hp[old], 0
+		bo.dmg[new], bo.dmg[old] = bo.dmg[old], 0
+		bo.armor[new], bo.armor[old] = bo.armor[old], 0
+	})
+	n := rm.Len() + 1
+	bo.fmt = bo.fmt[:n]
+	bo.maxHP = bo.maxHP[:n]
+	bo.hp = bo.hp[:n]
+	bo.dmg = bo.dmg[:n]
+	bo.armor = bo.armor[:n]
+}
+
+// derive makes a world entity derived from the given part; the entity is
+// destroyed once no part that it derives from remains.
+func (bo *body) derive(part, ent ecs.Entity) {
+	bo.derived.Upsert(nil, func(uc *ecs.UpsertCursor) {
+		uc.Create(brDerived, part, ent)
+	})
 }
 
 func (bo *body) build(rng *rand.Rand) {
@@ -347,99 +350,58 @@ func (bo *body) sever(
 	log func(string, ...interface{}),
 	ents ...ecs.Entity,
 ) *body {
-	// TODO: consider using a DFS traversal
-
-	type rel struct {
-		r, a, b ecs.Entity
-	}
-
-	var (
-		cont  = newBody()
-		xlate = make(map[ecs.EntityID]ecs.EntityID)
-		q     = make([]ecs.EntityID, len(ents))
-		n     = bo.rel.Len()
-		rels  = make([]rel, 0, n)
-		relis = make(map[ecs.EntityID]struct{}, n)
-		entis = make(map[ecs.EntityID]struct{}, n)
-	)
+	ids := make([]ecs.EntityID, len(ents))
 	for i := range ents {
-		q[i] = bo.Deref(ents[i])
+		ids[i] = bo.Deref(ents[i])
 	}
+	parts := bo.rel.Subtree(brControl.All(), ids...)
 
-	for len(q) > 0 {
-		id := q[0]
-		copy(q, q[1:])
-		q = q[:len(q)-1]
-		if _, seen := entis[id]; seen {
-			continue
-		}
-		entis[id] = struct{}{}
-
-		ent := bo.Ref(id)
-		if !ent.Type().HasAll(bcPart) {
-			continue
-		}
-
-		if bo.hp[id] > 0 {
-			eid := cont.AddEntity(ent.Type()).ID()
-			xlate[id] = eid
-			cont.fmt[eid] = bo.fmt[id]
-			cont.maxHP[eid] = bo.maxHP[id]
-			cont.hp[eid] = bo.hp[id]
-			cont.dmg[eid] = bo.dmg[id]
-			cont.armor[eid] = bo.armor[id]
-		}
-
-		// collect affected relations for final processing
-		for cur := bo.rel.Select(brControl.All(), ecs.InA(ent.ID())); cur.Scan(); {
-			id := cur.R().ID()
-			if _, seen := relis[id]; !seen {
-				relis[id] = struct{}{}
-				rels = append(rels, rel{cur.R(), cur.A(), cur.B()})
-				q = append(q, cur.B().ID())
+	// without any head or torso left, the whole body is severed
+	gone := make(map[ecs.EntityID]struct{}, len(parts))
+	for _, part := range parts {
+		gone[part.ID()] = struct{}{}
+	}
+	nh, nt, it := 0, 0, bo.Iter(bcPart.All())
+	for it.Next() {
+		if _, gone := gone[it.ID()]; !gone {
+			if it.Type().HasAll(bcHead) {
+				nh++
+			} else if it.Type().HasAll(bcTorso) {
+				nt++
 			}
 		}
+	}
+	if nh == 0 || nt == 0 {
+		ids = ids[:0]
+		for it.Reset(); it.Next(); {
+			ids = append(ids, it.ID())
+		}
+		parts = bo.rel.Subtree(brControl.All(), ids...)
+	}
 
-		defer ent.Destroy()
-
-		if len(q) == 0 {
-			nh, nt, it := 0, 0, bo.Iter(bcPart.All())
-			for it.Next() {
-				if _, gone := entis[it.ID()]; !gone {
-					if it.Type().HasAll(bcHead) {
-						nh++
-					} else if it.Type().HasAll(bcTorso) {
-						nt++
-					}
-				}
-			}
-			if nh == 0 || nt == 0 {
-				it.Reset()
-				for it.Next() {
-					q = append(q, it.ID())
-				}
-			}
+	cont := newBody(bo.derived.BCore())
+	bo.rel.Clone(brControl.All(), &cont.rel, func(part ecs.Entity) ecs.Entity {
+		id := part.ID()
+		if !part.Type().HasAll(bcPart) || bo.hp[id] <= 0 {
+			return ecs.NilEntity
 		}
+		cp := cont.AddEntity(part.Type())
+		eid := cp.ID()
+		cont.fmt[eid] = bo.fmt[id]
+		cont.maxHP[eid] = bo.maxHP[id]
+		cont.hp[eid] = bo.hp[id]
+		cont.dmg[eid] = bo.dmg[id]
+		cont.armor[eid] = bo.armor[id]
+		return cp
+	}, ids...)
+	bo.rel.Detach(brControl.All(), ids...)
+	for _, part := range parts {
+		part.Destroy()
 	}
 
 	if cont.Len() == 0 {
 		return nil
 	}
-
-	// finish relation processing
-	cont.rel.Upsert(nil, func(uc *ecs.UpsertCursor) {
-		for _, rel := range rels {
-			if xa, def := xlate[rel.a.ID()]; def {
-				a := cont.Ref(xa)
-				if xb, def := xlate[rel.b.ID()]; def {
-					b := cont.Ref(xb)
-					uc.Create(brControl, a, b)
-				}
-			}
-			defer rel.r.Destroy()
-		}
-	})
-
 	return cont
 }
 
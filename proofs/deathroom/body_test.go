@@ -64,7 +64,7 @@ func TestBody_sever_vital(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			rng := rand.New(rand.NewSource(rand.Int63()))
 
-			bo := newBody()
+			bo := newBody(&ecs.Core{})
 			bo.build(rng)
 
 			it := bo.Iter((tc.part | bcPart).All())
@@ -98,3 +98,31 @@ func TestBody_sever_vital(t *testing.T) {
 		})
 	}
 }
+
+func TestBody_compact(t *testing.T) {
+	bo := newBody(&ecs.Core{})
+	bo.build(rand.New(rand.NewSource(rand.Int63())))
+
+	it := bo.Iter((bcLeft | bcUpperArm | bcPart).All())
+	require.True(t, it.Next())
+	require.NotNil(t, bo.sever(t.Logf, it.Entity()))
+
+	describe := func() (parts []string) {
+		for it := bo.Iter(bcPart.All()); it.Next(); {
+			parts = append(parts, bo.DescribePart(it.Entity()))
+		}
+		return parts
+	}
+	prior, stats := describe(), bo.Stats()
+
+	bo.Compact()
+	assert.Equal(t, prior, describe())
+	assert.Equal(t, stats, bo.Stats())
+	it = bo.Iter((bcLeft | bcThigh | bcPart).All())
+	require.True(t, it.Next())
+	var below []string
+	for _, ent := range bo.rel.Descendants(brControl.All(), nil, it.ID()) {
+		below = append(below, bo.DescribePart(ent))
+	}
+	assert.Equal(t, []string{"left calf", "left foot"}, below)
+}
@@ -45,6 +45,7 @@ func newColorTable() *colorTable {
 	}
 	ct.Table = markov.NewTable(&ct.Core)
 	ct.RegisterAllocator(componentTableColor, ct.allocTableColor)
+	ct.RegisterRemapper(componentTableColor, ct.remapTableColor)
 	ct.RegisterDestroyer(componentTableColor, ct.destroyTableColor)
 	return ct
 }
@@ -53,6 +54,16 @@ func (ct *colorTable) allocTableColor(id ecs.EntityID, t ecs.ComponentType) {
 	ct.color = append(ct.color, 0)
 }
 
+func (ct *colorTable) remapTableColor(rm ecs.Remap) {
+	rm.Each(func(old, new ecs.EntityID) {
+		ct.color[new], ct.color[old] = ct.color[old], 0
+		if c := ct.color[new]; ct.lookup[c] == old {
+			ct.lookup[c] = new
+		}
+	})
+	ct.color = ct.color[:rm.Len()+1]
+}
+
 func (ct *colorTable) destroyTableColor(id ecs.EntityID, t ecs.ComponentType) {
 	delete(ct.lookup, ct.color[id])
 	ct.color[id] = 0
@@ -1,6 +1,10 @@
 package main
 
 import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"image"
 	"log"
@@ -17,6 +21,7 @@ import (
 	"github.com/borkshop/bork/internal/perf"
 	"github.com/borkshop/bork/internal/point"
 	"github.com/borkshop/bork/internal/view"
+	"github.com/borkshop/bork/internal/view/hud/inspect"
 	"github.com/borkshop/bork/internal/view/hud/prompt"
 )
 
@@ -75,6 +80,7 @@ type world struct {
 	enemyCounter int
 
 	ecs.System
+	sched  ecs.Schedule
 	pos    eps.EPS
 	timers time.Facility
 
@@ -86,12 +92,24 @@ type world struct {
 	items  []worldItem
 
 	moves   moves // TODO: maybe subsume into pos?
+	aiAgro  aiAgroQuery
 	waiting ecs.Iterator
+	aiMoves *ecs.View
+	souls   *ecs.View
+	ais     *ecs.View
+
+	prefabs    ecs.Prefabs
+	typeNames  ecs.TypeNames
+	moveNames  ecs.TypeNames
+	bodyNames  ecs.TypeNames
+	inspect    inspect.Inspector
+	inspecting bool
 }
 
 type moves struct {
 	eps.Moves
 	timers time.Facility
+	byMag  ecs.CursorOpt // orders moves by descending magnitude
 }
 
 const (
@@ -104,7 +122,12 @@ const (
 
 func (mov *moves) init(eps *eps.EPS) {
 	mov.Moves.Init(eps, wcSolid)
+	mov.byMag = ecs.SortFunc(func(r1, r2 ecs.Entity) bool { return mov.Mag(r1) > mov.Mag(r2) })
+	mov.Constrain(mrGoal, ecs.RelationUnique, 0)
+	mov.Constrain(mrMoveRange, ecs.RelationUnique, 0)
+	mov.Constrain(mrAgro, ecs.RelationUniquePair, 0)
 	mov.timers.Init(&mov.Core, movT)
+	mov.timers.RegisterCallback("decay", mov.decayN)
 }
 
 func newWorld(v *view.View) (*world, error) {
@@ -118,9 +141,54 @@ func newWorld(v *view.View) (*world, error) {
 	}
 	w.init(v)
 	// w.log("logging to %q", f.Name())
+	if err := w.loadPrefabs(*prefabsFile); err != nil {
+		return nil, err
+	}
 	return w, nil
 }
 
+//go:embed prefabs.json
+var defaultPrefabs []byte
+
+var prefabsFile = flag.String("prefabs", "", "load additional prefabs from a JSON file")
+
+func (w *world) loadPrefabs(path string) error {
+	if err := w.prefabs.Load(defaultPrefabs); err != nil {
+		return err
+	}
+	if path != "" {
+		if err := w.prefabs.LoadFile(path); err != nil {
+			return err
+		}
+	}
+	return w.prefabs.Check()
+}
+
+func (w *world) initPrefabs() {
+	w.prefabs.Init(&w.Core)
+	w.prefabs.Names = &w.typeNames
+	w.prefabs.RegisterData("name", ecs.PrefabFunc(wcName, func(ent ecs.Entity, data json.RawMessage) error {
+		return json.Unmarshal(data, &w.Names[ent.ID()])
+	}))
+	w.prefabs.RegisterData("glyph", ecs.PrefabFunc(wcGlyph, func(ent ecs.Entity, data json.RawMessage) error {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if rs := []rune(s); len(rs) == 1 {
+			w.Glyphs[ent.ID()] = rs[0]
+			return nil
+		}
+		return errors.New("glyph must be a single character")
+	}))
+	w.prefabs.RegisterData("bg", ecs.PrefabFunc(wcBG, func(ent ecs.Entity, data json.RawMessage) error {
+		return json.Unmarshal(data, &w.BG[ent.ID()])
+	}))
+	w.prefabs.RegisterData("fg", ecs.PrefabFunc(wcFG, func(ent ecs.Entity, data json.RawMessage) error {
+		return json.Unmarshal(data, &w.FG[ent.ID()])
+	}))
+}
+
 func (w *world) Process() {
 	w.perf.Process()
 }
@@ -130,18 +198,29 @@ func (w *world) init(v *view.View) {
 
 	w.ui.init(v, &w.perf)
 	w.timers.Init(&w.Core, wcTimer)
-
-	w.Procs = append(w.Procs,
-		&w.timers,
-		&w.moves.timers,
-		ecs.ProcFunc(w.generateAIMoves), // give AI a chance!
-		&w.moves,                        // pending moves -> collisions
-		ecs.ProcFunc(w.processAIItems),  // nom nom
-		ecs.ProcFunc(w.processCombat),   // e.g. deal damage
-		ecs.ProcFunc(w.processRest),     // healing etc
-		ecs.ProcFunc(w.checkOver),       // no souls => done
-		ecs.ProcFunc(w.maybeSpawn),      // spawn more demons
-	)
+	w.timers.RegisterCallback("decayRemains", w.decayRemains)
+
+	w.sched.Hook = w.perf.RecordProc
+	w.sched.Add(ecs.ProcSpec{Name: "timers", Phase: ecs.PhaseInput, Proc: &w.timers})
+	w.sched.Add(ecs.ProcSpec{Name: "moveTimers", Phase: ecs.PhaseInput, Proc: &w.moves.timers,
+		After: []string{"timers"}})
+	w.sched.Add(ecs.ProcSpec{Name: "aiMoves", Phase: ecs.PhaseInput, // give AI a chance!
+		Proc: ecs.ProcFunc(w.generateAIMoves), After: []string{"moveTimers"}})
+	w.sched.Add(ecs.ProcSpec{Name: "moves", Phase: ecs.PhaseSimulate, // pending moves -> collisions
+		Proc: &w.moves})
+	w.sched.Add(ecs.ProcSpec{Name: "aiItems", Phase: ecs.PhaseResolve, // nom nom
+		Proc: ecs.ProcFunc(w.processAIItems), Before: []string{"combat"}})
+	w.sched.Add(ecs.ProcSpec{Name: "combat", Phase: ecs.PhaseResolve, // e.g. deal damage
+		Proc: ecs.ProcFunc(w.processCombat)})
+	w.sched.Add(ecs.ProcSpec{Name: "rest", Phase: ecs.PhaseResolve, // healing etc
+		Proc: ecs.ProcFunc(w.processRest), After: []string{"combat"}})
+	w.sched.Add(ecs.ProcSpec{Name: "checkOver", Phase: ecs.PhaseResolve, // no souls => done
+		Proc: ecs.ProcFunc(w.checkOver), After: []string{"combat", "rest"}})
+	w.sched.Add(ecs.ProcSpec{Name: "spawn", Phase: ecs.PhaseResolve, // spawn more demons
+		Proc: ecs.ProcFunc(w.maybeSpawn), After: []string{"checkOver"}})
+	w.sched.Add(ecs.ProcSpec{Name: "inspect", Phase: ecs.PhaseRender, // debug overlay
+		Proc: ecs.ProcFunc(w.refreshInspector)})
+	w.AddProc(&w.sched)
 
 	// TODO: consider eliminating the padding for EntityID(0)
 	w.Names = []string{""}
@@ -152,6 +231,7 @@ func (w *world) init(v *view.View) {
 	w.items = []worldItem{nil}
 
 	w.RegisterAllocator(wcName|wcGlyph|wcBG|wcFG|wcBody|wcItem, w.allocWorld)
+	w.RegisterRemapper(wcName|wcGlyph|wcBG|wcFG|wcBody|wcItem, w.remapWorld)
 	w.RegisterCreator(wcInput, w.createInput)
 	w.RegisterCreator(wcBody, w.createBody)
 	w.RegisterDestroyer(wcBody, w.destroyBody)
@@ -161,7 +241,53 @@ func (w *world) init(v *view.View) {
 	w.pos.Init(&w.Core, wcPosition)
 	w.moves.init(&w.pos) // TODO: maybe subsume into pos?
 	w.moves.Moves.PreCheck = w.checkMove
-	w.waiting = w.Iter((charMask | wcWaiting).All())
+	w.aiAgro.init(w)
+	w.waiting = w.Core.View((charMask | wcWaiting).All()).Iter()
+	w.aiMoves = w.Core.View(aiMoveMask.All())
+	w.souls = w.Core.View(wcSoul.All())
+	w.ais = w.Core.View(wcAI.All())
+
+	w.initInspect()
+	w.initPrefabs()
+}
+
+func (w *world) initInspect() {
+	for _, tn := range []struct {
+		name string
+		t    ecs.ComponentType
+	}{
+		{"name", wcName}, {"timer", wcTimer}, {"position", wcPosition},
+		{"solid", wcSolid}, {"glyph", wcGlyph}, {"bg", wcBG}, {"fg", wcFG},
+		{"input", wcInput}, {"waiting", wcWaiting}, {"body", wcBody},
+		{"soul", wcSoul}, {"item", wcItem}, {"ai", wcAI}, {"floor", wcFloor},
+		{"wall", wcWall}, {"spawn", wcSpawn}, {"ant", wcAnt},
+	} {
+		w.typeNames.Register(tn.name, tn.t)
+	}
+	w.moveNames.Register("timer", movT)
+	w.moveNames.Register("goal", mrGoal)
+	w.moveNames.Register("agro", mrAgro)
+	w.moveNames.Register("range", mrMoveRange)
+	w.bodyNames.Register("control", brControl)
+	w.bodyNames.Register("derived", brDerived)
+
+	w.inspect.Core = &w.Core
+	w.inspect.Names = &w.typeNames
+	w.inspect.Pos = &w.pos
+	w.inspect.Timers = &w.timers
+	w.inspect.Relation("move", &w.moves.Relation, &w.moveNames)
+	w.inspect.RelationOf("body", func(ent ecs.Entity) *ecs.Relation {
+		if bo := w.entBody(ent); bo != nil {
+			return &bo.rel.Relation
+		}
+		return nil
+	}, &w.bodyNames)
+	w.inspect.RelationOf("derived", func(ent ecs.Entity) *ecs.Relation {
+		if bo := w.entBody(ent); bo != nil {
+			return &bo.derived
+		}
+		return nil
+	}, &w.bodyNames)
 }
 
 var movementRangeLabels = []string{"Walk", "Lunge"}
@@ -216,12 +342,42 @@ func (w *world) allocWorld(id ecs.EntityID, t ecs.ComponentType) {
 	w.items = append(w.items, nil)
 }
 
+func (w *world) remapWorld(rm ecs.Remap) {
+	rm.Each(func(old, new ecs.EntityID) {
+		w.Names[new], w.Names[old] = w.Names[old], ""
+		w.Glyphs[new], w.Glyphs[old] = w.Glyphs[old], 0
+		w.BG[new], w.BG[old] = w.BG[old], 0
+		w.FG[new], w.FG[old] = w.FG[old], 0
+		w.bodies[new], w.bodies[old] = w.bodies[old], nil
+		w.items[new], w.items[old] = w.items[old], nil
+	})
+	n := rm.Len() + 1
+	w.Names = w.Names[:n]
+	w.Glyphs = w.Glyphs[:n]
+	w.BG = w.BG[:n]
+	w.FG = w.FG[:n]
+	w.bodies = w.bodies[:n]
+	w.items = w.items[:n]
+
+	// bodies (and remains) refer to derived world entities as foreign ones
+	for _, bo := range w.bodies {
+		if bo != nil {
+			bo.derived.RemapForeign(rm)
+		}
+	}
+	for _, item := range w.items {
+		if bo, ok := item.(*body); ok {
+			bo.derived.RemapForeign(rm)
+		}
+	}
+}
+
 func (w *world) createInput(id ecs.EntityID, t ecs.ComponentType) {
 	w.setMovementRange(w.Ref(id), 1)
 }
 
 func (w *world) createBody(id ecs.EntityID, t ecs.ComponentType) {
-	w.bodies[id] = newBody()
+	w.bodies[id] = newBody(&w.Core)
 }
 
 func (w *world) destroyBody(id ecs.EntityID, t ecs.ComponentType) {
@@ -263,25 +419,17 @@ const (
 )
 
 func (w *world) setMovementRange(ent ecs.Entity, n int) {
-	id := w.Deref(ent)
 	if n > maxMovementRange {
 		n = maxMovementRange
 	}
-	// TODO better support upsert reduction
-	found := false
-	cur := w.moves.Select(mrMoveRange.All(), ecs.InA(id))
-	w.moves.Upsert(cur, func(uc *ecs.UpsertCursor) {
-		if !found {
-			w.moves.SetMag(uc.Emit(mrMoveRange, ent, ent), n)
-			found = true
-		}
+	w.moves.Upsert(nil, func(uc *ecs.UpsertCursor) {
+		w.moves.SetMag(uc.Create(mrMoveRange, ent, ent), n)
 	})
 }
 
 func (w *world) getMovementRange(ent ecs.Entity) int {
-	id := w.Deref(ent)
-	for cur := w.moves.Select(mrMoveRange.All(), ecs.InA(id)); cur.Scan(); {
-		if n := w.moves.Mag(cur.R()); n <= maxMovementRange {
+	if move := ecs.First(w.moves.Select(mrMoveRange.All(), ecs.InA(w.Deref(ent)))); move != ecs.NilEntity {
+		if n := w.moves.Mag(move); n <= maxMovementRange {
 			return n
 		}
 	}
@@ -373,7 +521,8 @@ func (bo *body) movementRating() float64 {
 
 func (w *world) processCombat() {
 	// TODO: make this an upsert that transmutes hits into damage/kill relations
-	for cur := w.moves.Collisions(); cur.Scan(); {
+	// the hardest hits land first, independent of entity allocation order
+	for cur := w.moves.Collisions(w.moves.byMag, ecs.SortByA, ecs.SortByB); cur.Scan(); {
 		src, targ := cur.A(), cur.B()
 		if !src.Type().HasAll(wcBody) || !targ.Type().HasAll(wcBody) {
 			continue
@@ -423,9 +572,30 @@ func (w *world) firstSoulBody() ecs.Entity {
 	return ecs.NilEntity
 }
 
+// refreshInspector updates the inspector overlay, if shown, once per round.
+func (w *world) refreshInspector() {
+	if w.inspecting {
+		w.inspect.Refresh()
+	}
+}
+
+// entBody returns the body of a body entity, or of remains; nil otherwise.
+func (w *world) entBody(ent ecs.Entity) *body {
+	if !w.Valid(ent) {
+		return nil
+	}
+	if ent.Type().HasAll(wcBody) {
+		return w.bodies[ent.ID()]
+	}
+	if bo, ok := w.items[ent.ID()].(*body); ok {
+		return bo
+	}
+	return nil
+}
+
 func (w *world) checkOver() {
 	// count remaining souls
-	if w.Iter(wcSoul.All()).Count() == 0 {
+	if w.souls.Len() == 0 {
 		w.log("game over")
 		w.over = true
 	}
@@ -437,10 +607,7 @@ func (w *world) maybeSpawn() {
 		return
 	}
 
-	totalAgro := 0
-	for cur := w.moves.Select(mrAgro.All()); cur.Scan(); {
-		totalAgro += w.moves.Mag(cur.R())
-	}
+	totalAgro := ecs.Sum(w.moves.Select(mrAgro.All()), w.moves.Mag)
 
 	totalHP, totalDmg, combatCount := 0, 0, 0
 	for it := w.Iter((wcSolid | wcBody | wcInput).All(), wcWaiting.NotAll()); it.Next(); {
@@ -480,7 +647,7 @@ eachSpawnPoint:
 			ent.Delete(wcWaiting)
 			ent.Add(wcSolid | wcInput)
 			w.pos.Set(ent, pos)
-			w.moves.timers.Every(w.addAgro(ent, ent, hp), 1, w.moves.decayN)
+			w.moves.timers.EveryCallback(w.addAgro(ent, ent, hp), "", 1, "decay")
 			ent = w.nextWaiting()
 		}
 	}
@@ -491,7 +658,7 @@ func (w *world) nextWaiting() ecs.Entity {
 		return w.waiting.Entity()
 	}
 	w.enemyCounter++
-	return w.newChar(fmt.Sprintf("enemy%d", w.enemyCounter), 'X', wcAI)
+	return w.newChar("enemy", fmt.Sprintf("enemy%d", w.enemyCounter))
 }
 
 func soulInvolved(a, b ecs.Entity) bool {
@@ -537,12 +704,12 @@ func (w *world) dealAttackDamage(
 		targName := w.getName(targ, "nameless")
 		name := fmt.Sprintf("remains of %s", targName)
 		pos, _ := w.pos.Get(targ)
-		item := w.newItem(pos, name, '%', severed)
-		w.timers.Every(item, 5, w.decayRemains)
+		item := w.newItem("remains", pos, name, severed)
+		w.timers.EveryCallback(item, "", 5, "decayRemains")
 		if severed.Len() > 0 {
 			w.log("%s's remains have dropped on the floor", targName)
 		} else {
-			w.log("empty severed? %v",
+			w.log("empty severed? %v %v",
 				w.getName(targ, "?!?"), targBo.DescribePart(bPart),
 			)
 		}
@@ -576,8 +743,7 @@ func (w *world) dealAttackDamage(
 			targ.Delete(wcBody | wcSolid)
 			w.Glyphs[targ.ID()] = '⟡'
 			for _, head := range heads {
-				head.Add(bcDerived)
-				severed.derived[head.ID()] = targ
+				severed.derive(head, targ)
 			}
 			if soulInvolved(src, targ) {
 				w.log("%s was disembodied by %s", w.getName(targ, "?!?"), w.getName(src, "!?!"))
@@ -691,7 +857,7 @@ func (w *world) addBox(box point.Box, glyph rune) {
 		{n: sz.Y, d: image.Pt(0, -1)},
 	} {
 		for i := 0; i < r.n; i++ {
-			wall := w.AddEntity(wcPosition | wcSolid | wcGlyph | wcBG | wcFG | wcWall)
+			wall := w.prefabs.MustInstantiate("wall")
 			w.Glyphs[wall.ID()] = glyph
 			w.pos.Set(wall, pos)
 			c, _ := wallTable.toColor(last)
@@ -703,25 +869,25 @@ func (w *world) addBox(box point.Box, glyph rune) {
 	}
 
 	floorTable.genTile(w.rng, box, func(pos point.Point, bg termbox.Attribute) {
-		floor := w.AddEntity(wcPosition | wcBG | wcFloor)
+		floor := w.prefabs.MustInstantiate("floor")
 		w.pos.Set(floor, image.Point(pos))
 		w.BG[floor.ID()] = bg
 	})
 }
 
-func (w *world) newItem(pos image.Point, name string, glyph rune, val worldItem) ecs.Entity {
-	ent := w.AddEntity(wcPosition | wcName | wcGlyph | wcItem)
+func (w *world) newItem(prefab string, pos image.Point, name string, val worldItem) ecs.Entity {
+	ent := w.prefabs.MustInstantiate(prefab)
 	w.pos.Set(ent, pos)
-	w.Glyphs[ent.ID()] = glyph
 	w.Names[ent.ID()] = name
 	w.items[ent.ID()] = val
 	return ent
 }
 
-func (w *world) newChar(name string, glyph rune, t ecs.ComponentType) ecs.Entity {
-	ent := w.AddEntity(charMask | wcWaiting | t)
-	w.Glyphs[ent.ID()] = glyph
-	w.Names[ent.ID()] = name
+func (w *world) newChar(prefab, name string) ecs.Entity {
+	ent := w.prefabs.MustInstantiate(prefab)
+	if name != "" {
+		w.Names[ent.ID()] = name
+	}
 	w.bodies[ent.ID()].build(w.rng)
 	return ent
 }
@@ -762,37 +928,26 @@ func (mov *moves) decayN(move ecs.Entity) {
 }
 
 func (w *world) addAgro(a, b ecs.Entity, n int) ecs.Entity {
-	// TODO better support upsert reduction
-	accum := ecs.NilEntity
-	w.moves.Upsert(
-		w.moves.Select(mrAgro.All(), ecs.InA(a.ID()), ecs.InB(b.ID())),
-		func(uc *ecs.UpsertCursor) {
-			if accum == ecs.NilEntity {
-				accum = uc.Emit(mrAgro, a, b)
-			} else {
-				n += w.moves.Mag(uc.R())
-			}
-			w.moves.SetMag(accum, n)
-		})
-	return accum
+	var agro ecs.Entity
+	w.moves.Upsert(nil, func(uc *ecs.UpsertCursor) {
+		agro = uc.Create(mrAgro, a, b)
+	})
+	w.moves.SetMag(agro, n)
+	return agro
 }
 
-func (w *world) getAgro(a, b ecs.Entity) (n int) {
-	for cur := w.moves.Select(mrAgro.All(), ecs.InA(w.Deref(a)), ecs.InB(w.Deref(b))); cur.Scan(); {
-		n += w.moves.Mag(cur.R())
-	}
-	return n
+func (w *world) getAgro(a, b ecs.Entity) int {
+	return ecs.Sum(w.moves.Select(mrAgro.All(), ecs.InA(w.Deref(a)), ecs.InB(w.Deref(b))), w.moves.Mag)
 }
 
 func (w *world) addSpawn(x, y int) ecs.Entity {
-	spawn := w.AddEntity(wcPosition | wcGlyph | wcFG | wcSpawn)
+	spawn := w.prefabs.MustInstantiate("spawn")
 	w.pos.Set(spawn, image.Pt(x, y))
-	w.Glyphs[spawn.ID()] = '✖' // ×
-	w.FG[spawn.ID()] = 54
 	return spawn
 }
 
 func main() {
+	flag.Parse()
 	if err := view.JustKeepRunning(func(v *view.View) (view.Client, error) {
 		w, err := newWorld(v)
 		if err != nil {
@@ -806,7 +961,7 @@ func main() {
 		w.addSpawn(-8, 5)
 		w.addSpawn(8, 5)
 
-		player := w.newChar("you", 'X', wcSoul)
+		player := w.newChar("you", "")
 		w.ui.bar.addAction(newRangeChooser(w, player))
 
 		w.Process()
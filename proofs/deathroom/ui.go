@@ -434,9 +434,25 @@ func (w *world) HandleKey(k view.KeyEvent) (rerr error) {
 		}()
 	}
 
+	// entity inspector keys
+	if !handled && w.inspecting {
+		if w.inspect.HandleKey(k) {
+			proc, handled = false, true
+		} else if k.Ch == '\\' {
+			w.prompt = w.inspect.Prompt(w.prompt.Unwind())
+			proc, handled = false, true
+		}
+	}
+
 	// special keys
 	if !handled {
 		switch k.Ch {
+		case '`':
+			w.inspecting = !w.inspecting
+			if w.inspecting {
+				w.inspect.Filter((wcBody | wcItem | wcSpawn).Any())
+			}
+			proc, handled = false, true
 		case ',':
 			if player != ecs.NilEntity {
 				if itemPrompt, haveItemsHere := w.itemPrompt(w.prompt, player); haveItemsHere {
@@ -508,14 +524,18 @@ func (w *world) Render(termGrid view.Grid) error {
 	}
 
 	hud.HeaderF(">%v souls v %v demons",
-		w.Iter(wcSoul.All()).Count(),
-		w.Iter(wcAI.All()).Count())
+		w.souls.Len(),
+		w.ais.Len())
 
 	hud.AddRenderable(&w.ui.bar, view.AlignLeft|view.AlignBottom)
 	hud.AddRenderable(&w.ui.prompt, view.AlignLeft|view.AlignBottom)
 
 	hud.AddRenderable(&w.ui.perfDash, view.AlignRight|view.AlignBottom)
 
+	if w.inspecting {
+		hud.AddRenderable(&w.inspect, view.AlignLeft|view.AlignTop|view.AlignHFlush)
+	}
+
 	for it := w.Iter((wcSoul | wcBody).All()); it.Next(); {
 		hud.AddRenderable(makeBodySummary(w, it.Entity()),
 			view.AlignBottom|view.AlignRight|view.AlignHFlush)
@@ -85,14 +85,14 @@ Loop:
 }
 
 func newWorld() *world {
-	noise := opensimplex.NewWithSeed(0)
+	noise := opensimplex.New(0)
 	return &world{
 		noise: noise,
 	}
 }
 
 type world struct {
-	noise *opensimplex.Noise
+	noise opensimplex.Noise
 }
 
 type tileType int
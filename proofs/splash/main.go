@@ -132,9 +132,9 @@ func fillClouds(d *display.Display, sky image.Rectangle, now time.Time) {
 	t := int(now.UnixNano() * 10 / int64(time.Second))
 	r := braille.Bounds(sky, braille.Margin)
 	bmp := bitmap.New(r)
-	a := opensimplex.NewWithSeed(0)
-	b := opensimplex.NewWithSeed(100)
-	c := opensimplex.NewWithSeed(200)
+	a := opensimplex.New(0)
+	b := opensimplex.New(100)
+	c := opensimplex.New(200)
 	for y := r.Min.Y; y < r.Max.Y; y++ {
 		for x := r.Min.X; x < r.Max.X; x++ {
 			shape := a.Eval2(float64(x+t*2)/40.0, float64(y)/10.0)